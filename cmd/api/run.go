@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"log/slog"
 	"net"
+	"net/http"
 	"time"
 
 	"buf.build/go/protovalidate"
@@ -86,10 +88,41 @@ func Run(ctx context.Context, cfg *config.APIConfig) {
 		distribution.NewVanilla(nil),
 	)
 
+	// Authenticates the downloads of the custom jars by the local node,
+	// which has no token in the database
+	localToken := rand.Text()
+
+	if cfg.Distribution.Custom.Enable {
+		custom, err := distribution.NewCustom(
+			querier,
+			cfg.Distribution.Custom.Dir,
+			cfg.Distribution.Custom.PublicURL,
+		)
+		if err != nil {
+			log.Fatalln("Failed to create custom distribution:", err)
+		}
+		custom.SetLocalToken(localToken)
+		distroRepo.AddDistribution(pb.Distribution_CUSTOM, custom)
+
+		go ServeCustomDistribution(ctx, &cfg.Distribution.Custom, custom)
+	}
+
 	runners := server.NewRunners(querier)
 
+	if cfg.LocalNode != nil {
+		ports, err := server.NewPortRange(
+			uint32(cfg.LocalNode.Ports.Start),
+			uint32(cfg.LocalNode.Ports.End),
+		)
+		if err != nil {
+			log.Fatalln("Failed to set local node ports:", err)
+		}
+		ports.Reserved = cfg.LocalNode.Proxy.Port
+		runners.SetPortRange(cfg.LocalNode.ID, ports)
+	}
+
 	if cfg.LocalNode != nil && cfg.LocalNode.Enable {
-		r, err := RunLocalNode(ctx, cfg.LocalNode, distroRepo)
+		r, err := RunLocalNode(ctx, cfg.LocalNode, distroRepo, localToken)
 		if err != nil {
 			log.Fatalln("Failed to run local node:", err)
 		}
@@ -163,15 +196,15 @@ func Serve(
 	)
 	pb.RegisterNodeServiceServer(
 		grpcServer,
-		server.NewNodeServer(querier, authRepo, localNodeId),
+		server.NewNodeServer(querier, authRepo, runners, localNodeId),
 	)
 	pb.RegisterInstanceServiceServer(
 		grpcServer,
-		server.NewInstanceServer(querier, authRepo, runners),
+		server.NewInstanceServer(querier, authRepo, runners, distroRepo),
 	)
 	pb.RegisterDistributionServiceServer(
 		grpcServer,
-		distribution.NewServer(distroRepo),
+		server.NewDistributionServer(authRepo, distroRepo),
 	)
 
 	if cfg.Server.EnableReflection {
@@ -191,3 +224,43 @@ func Serve(
 
 	<-ctx.Done()
 }
+
+func ServeCustomDistribution(
+	ctx context.Context,
+	cfg *config.CustomDistributionConfig,
+	handler http.Handler,
+) {
+	start := time.Now()
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   cfg.IP,
+		Port: int(cfg.Port),
+	})
+	if err != nil {
+		log.Fatalln("Failed to listen tcp:", err)
+	}
+
+	slog.Info(
+		"HTTP: Listening",
+		"addr", ln.Addr(),
+		"took", time.Since(start).Round(time.Microsecond),
+	)
+
+	httpServer := &http.Server{Handler: handler}
+
+	go httpServer.Serve(ln)
+	defer func() {
+		start := time.Now()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+
+		err := httpServer.Shutdown(shutdownCtx)
+		slog.Info(
+			"HTTP: Closed server",
+			"error", err,
+			"took", time.Since(start).Round(time.Millisecond),
+		)
+	}()
+
+	<-ctx.Done()
+}
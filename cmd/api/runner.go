@@ -21,6 +21,7 @@ func RunLocalNode(
 	ctx context.Context,
 	cfg *config.APILocalNodeConfig,
 	distros *distribution.Repository,
+	customToken string,
 ) (pb.RunnerServiceClient, error) {
 	start := time.Now()
 
@@ -35,20 +36,43 @@ func RunLocalNode(
 		"took", time.Since(start).Round(time.Microsecond),
 	)
 
+	inbound := runner.NewInbound(cfg.Proxy)
+
+	blocklist, err := runner.NewBlocklist(cfg.Data, inbound.Guard)
+	if err != nil {
+		return nil, fmt.Errorf("load blocklist: %w", err)
+	}
+
+	router, err := runner.NewRouter(cfg.Proxy, inbound)
+	if err != nil {
+		return nil, fmt.Errorf("listen shared proxy: %w", err)
+	}
+	if router != nil {
+		go func() {
+			<-ctx.Done()
+			router.Close()
+		}()
+	}
+
+	downloader := distribution.NewDownloader(nil, cfg.Download)
+	downloader.SetToken(pb.Distribution_CUSTOM, customToken)
+
 	runtime, err := runner.NewDockerRuntime(
 		ctx,
 		cfg.Docker,
 		cfg.Data,
 		docker,
-		nil,
+		downloader,
 		runner.NewTemurinJre("noble"),
+		inbound,
+		router,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create docker runner: %w", err)
 	}
 
-	manager := runner.NewManager(runtime)
-	runnerServer := runner.NewServer(manager, distros)
+	manager := runner.NewManager(runtime, cfg.Monitor)
+	runnerServer := runner.NewServer(manager, distros, inbound.Guard, blocklist)
 
 	ln := bufconn.Listen(1024 * 1024)
 	s := grpc.NewServer()
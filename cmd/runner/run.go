@@ -52,28 +52,55 @@ func Run(ctx context.Context, cfg *config.RunnerConfig) {
 		distribution.NewPaper(nil),
 	)
 
+	inbound := runner.NewInbound(cfg.Proxy)
+
+	blocklist, err := runner.NewBlocklist(cfg.Data, inbound.Guard)
+	if err != nil {
+		log.Fatalln("Failed to load the blocklist:", err)
+	}
+
+	router, err := runner.NewRouter(cfg.Proxy, inbound)
+	if err != nil {
+		log.Fatalln("Failed to listen the shared proxy:", err)
+	}
+	if router != nil {
+		defer router.Close()
+	}
+
+	// The api authenticates the downloads of the custom jars with the
+	// token of the node
+	downloader := distribution.NewDownloader(nil, cfg.Download)
+	downloader.SetToken(pb.Distribution_CUSTOM, cfg.Server.Password)
+
 	runtime, err := runner.NewDockerRuntime(
 		context.Background(),
 		cfg.Docker,
 		cfg.Data,
 		docker,
-		nil,
+		downloader,
 		runner.NewTemurinJre("noble"),
+		inbound,
+		router,
 	)
 	if err != nil {
 		log.Fatalln("Failed to create docker runner:", err)
 	}
 
-	manager := runner.NewManager(runtime)
+	manager := runner.NewManager(runtime, cfg.Monitor)
 
-	Serve(ctx, cfg, distributions, manager)
+	Serve(
+		ctx,
+		cfg,
+		distributions,
+		runner.NewServer(manager, distributions, inbound.Guard, blocklist),
+	)
 }
 
 func Serve(
 	ctx context.Context,
 	cfg *config.RunnerConfig,
 	distributions *distribution.Repository,
-	manager *runner.Manager,
+	instanceServer *runner.Server,
 ) {
 	start := time.Now()
 	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
@@ -121,8 +148,6 @@ func Serve(
 		protovalidate_middleware.UnaryServerInterceptor(validator),
 	))
 
-	instanceServer := runner.NewServer(manager, distributions)
-
 	server := grpc.NewServer(opts...)
 	pb.RegisterDistributionServiceServer(
 		server,
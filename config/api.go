@@ -9,6 +9,8 @@ type APIConfig struct {
 	DB     DBConfig     `json:"db" yaml:"db"`
 	Redis  RedisConfig  `json:"redis" yaml:"redis"`
 
+	Distribution DistributionConfig `json:"distribution" yaml:"distribution"`
+
 	LocalNode *APILocalNodeConfig `json:"runner" yaml:"runner"`
 }
 
@@ -17,6 +19,12 @@ type APILocalNodeConfig struct {
 	ID     dto.Snowflake `json:"id" yaml:"id"`
 	Docker DockerConfig  `json:"docker" yaml:"docker"`
 	Data   DataConfig    `json:"data" yaml:"data"`
+	Proxy  ProxyConfig   `json:"proxy" yaml:"proxy"`
+
+	Ports   PortRangeConfig `json:"ports" yaml:"ports"`
+	Monitor MonitorConfig   `json:"monitor" yaml:"monitor"`
+
+	Download DownloadConfig `json:"download" yaml:"download"`
 }
 
 func WriteApiConfig(name string, cfg *APIConfig) error {
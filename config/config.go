@@ -2,6 +2,7 @@ package config
 
 import (
 	"net"
+	"net/netip"
 	"time"
 )
 
@@ -17,10 +18,92 @@ type DockerConfig struct {
 	NetworkName string `json:"network_name" yaml:"network-name" validate:"required"`
 }
 
+type ProxyConfig struct {
+	// Address of the listener shared by all the instances, the
+	// connections are routed by the hostname. Disabled when the
+	// port is zero
+	IP   net.IP `json:"ip" yaml:"ip"`
+	Port uint16 `json:"port" yaml:"port"`
+
+	// Requires the PROXY protocol header in the connections accepted
+	// by the node, when it is behind a load balancer
+	AcceptProxyProtocol bool `json:"accept_proxy_protocol" yaml:"accept-proxy-protocol"`
+	// CIDRs of the load balancers, the header is only read from them.
+	// When empty it is required from all the connections
+	TrustedProxies []netip.Prefix `json:"trusted_proxies" yaml:"trusted-proxies"`
+
+	Limits ProxyLimitsConfig `json:"limits" yaml:"limits"`
+}
+
+// Rates are per second, and are unlimited when zero
+type ProxyLimitsConfig struct {
+	// New connections from each ip (or ipv6 /64)
+	ConnRate  float64 `json:"conn_rate" yaml:"conn-rate"`
+	ConnBurst int     `json:"conn_burst" yaml:"conn-burst"`
+	// Handshakes from each ip (or ipv6 /64)
+	HandshakeRate  float64 `json:"handshake_rate" yaml:"handshake-rate"`
+	HandshakeBurst int     `json:"handshake_burst" yaml:"handshake-burst"`
+	// Concurrent connections of the node, unlimited when zero
+	MaxConns int `json:"max_conns" yaml:"max-conns"`
+	// When <= 0 the default of 10s is used
+	HandshakeTimeout time.Duration `json:"handshake_timeout" yaml:"handshake-timeout"`
+}
+
+// Periodic status pings of the running instances, to find the servers
+// that stopped answering
+type MonitorConfig struct {
+	// Disabled when zero
+	Interval time.Duration `json:"interval" yaml:"interval"`
+	// When <= 0 the default of 5s is used
+	Timeout time.Duration `json:"timeout" yaml:"timeout"`
+	// Time without replies after which the instance is unresponsive,
+	// when <= 0 the default of 2m is used
+	UnresponsiveAfter time.Duration `json:"unresponsive_after" yaml:"unresponsive-after"`
+	// Restarts the unresponsive instances
+	Restart bool `json:"restart" yaml:"restart"`
+}
+
+// Ports allocated to the instances of a node, inclusive. When zero
+// the default of 25566-25665 is used
+type PortRangeConfig struct {
+	Start uint16 `json:"start" yaml:"start"`
+	End   uint16 `json:"end" yaml:"end"`
+}
+
 type DataConfig struct {
 	DataDir string `json:"data_dir" yaml:"data-dir" validate:"required"`
 }
 
+type DistributionConfig struct {
+	Custom CustomDistributionConfig `json:"custom" yaml:"custom"`
+}
+
+type CustomDistributionConfig struct {
+	Enable bool `json:"enable" yaml:"enable"`
+	// Where the uploaded jars are stored
+	Dir string `json:"dir" yaml:"dir"`
+	// Address of the http server the runners download the jars from.
+	// The runners authenticate with the token of their node, so the
+	// nodes without a token can not use the custom jars
+	IP   net.IP `json:"ip" yaml:"ip"`
+	Port uint16 `json:"port" yaml:"port"`
+	// The url the runners use to reach the http server,
+	// e.g. http://10.0.0.2:8081
+	PublicURL string `json:"public_url" yaml:"public-url"`
+}
+
+type DownloadConfig struct {
+	// Attempts per url, when <= 0 the default of 3 is used
+	Retries int `json:"retries" yaml:"retries"`
+	// Delay before the first retry, doubled after each attempt.
+	// When <= 0 the default of 1s is used
+	Backoff time.Duration `json:"backoff" yaml:"backoff"`
+	// Base urls that replace the scheme and host of the original
+	// download url, keyed by distribution name (paper, vanilla, custom).
+	// They are tried in order after the original url fails
+	Mirrors map[string][]string `json:"mirrors" yaml:"mirrors"`
+}
+
 type AuthConfig struct {
 	JWTExpiration time.Duration `json:"jwt_expiration" yaml:"jwt-expiration" validate:"required"`
 	AllowSignup   bool          `json:"allow_signup" yaml:"allow-signup"`
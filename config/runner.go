@@ -4,6 +4,11 @@ type RunnerConfig struct {
 	Server ServerConfig `json:"server" yaml:"server"`
 	Docker DockerConfig `json:"docker" yaml:"docker"`
 	Data   DataConfig   `json:"data" yaml:"data"`
+	Proxy  ProxyConfig  `json:"proxy" yaml:"proxy"`
+
+	Monitor MonitorConfig `json:"monitor" yaml:"monitor"`
+
+	Download DownloadConfig `json:"download" yaml:"download"`
 }
 
 func WriteRunnerConfig(name string, cfg *RunnerConfig) (err error) {
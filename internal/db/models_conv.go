@@ -22,17 +22,19 @@ func (u *User) IntoPB() *pb.User {
 
 func (n *Node) IntoPB() *pb.Node {
 	return &pb.Node{
-		Id:          uint64(n.ID),
-		CreatedAt:   timestamppb.New(n.CreatedAt),
-		UpdatedAt:   timestamppb.New(n.UpdatedAt),
-		Name:        n.Name,
-		Description: n.Description,
-		Maintenance: n.Maintenance,
-		Token:       n.Token,
-		Endpoint:    n.Endpoint,
-		EndpointTls: n.EndpointTls,
-		FtpPort:     n.FtpPort,
-		GrpcPort:    n.GrpcPort,
+		Id:             uint64(n.ID),
+		CreatedAt:      timestamppb.New(n.CreatedAt),
+		UpdatedAt:      timestamppb.New(n.UpdatedAt),
+		Name:           n.Name,
+		Description:    n.Description,
+		Maintenance:    n.Maintenance,
+		Token:          n.Token,
+		Endpoint:       n.Endpoint,
+		EndpointTls:    n.EndpointTls,
+		FtpPort:        n.FtpPort,
+		GrpcPort:       n.GrpcPort,
+		PortRangeStart: n.PortRangeStart,
+		PortRangeEnd:   n.PortRangeEnd,
 	}
 }
 
@@ -58,5 +60,9 @@ func (i *Instance) IntoPB(state pb.InstanceState, players int32) *pb.Instance {
 		Maintenance:   i.Maintenance,
 		Config:        i.Config,
 		Limits:        i.Limits,
+		VersionBuild:  i.VersionBuild,
+		ResolvedBuild: i.ResolvedBuild,
+		WorldSettings: i.WorldSettings,
+		GameRules:     i.GameRules,
 	}
 }
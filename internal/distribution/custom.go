@@ -0,0 +1,304 @@
+package distribution
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zanz1n/mc-manager/internal/db"
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+var customVersionRegex = regexp.MustCompile(`^[a-zA-Z0-9._+-]+$`)
+
+var (
+	_ Distribution = (*Custom)(nil)
+	_ Uploader     = (*Custom)(nil)
+	_ http.Handler = (*Custom)(nil)
+)
+
+// Custom serves admin uploaded jars. The jars are stored in the
+// filesystem of the api and downloaded by the runners through http,
+// authenticated with the token of their node.
+type Custom struct {
+	db        db.Querier
+	dir       string
+	publicURL string
+	// accepted besides the node tokens, used by the local node
+	localToken string
+}
+
+func NewCustom(db db.Querier, dir string, publicURL string) (*Custom, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	return &Custom{
+		db:        db,
+		dir:       dir,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}, nil
+}
+
+// GetLatest implements Distribution.
+func (d *Custom) GetLatest(ctx context.Context) (Version, error) {
+	v, err := d.db.CustomVersionGetLatest(ctx)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrVersionNotFound
+		}
+		return Version{}, err
+	}
+
+	return d.intoVersion(v), nil
+}
+
+// GetVersion implements Distribution.
+func (d *Custom) GetVersion(ctx context.Context, semver string) (Version, error) {
+	v, err := d.db.CustomVersionGetByVersion(ctx, semver)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = ErrVersionNotFound
+		}
+		return Version{}, err
+	}
+
+	return d.intoVersion(v), nil
+}
+
+// GetAll implements Distribution.
+func (d *Custom) GetAll(ctx context.Context) ([]VersionInfo, error) {
+	versions, err := d.db.CustomVersionGetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]VersionInfo, len(versions))
+	for i, v := range versions {
+		res[i] = VersionInfo{
+			ID:          v.Version,
+			ReleaseTime: v.CreatedAt,
+			Type:        pb.VersionType_VERSION_TYPE_RELEASE,
+			JavaVersion: v.JavaVersion,
+			Support:     pb.SupportStatus_SUPPORT_SUPPORTED,
+		}
+	}
+	return res, nil
+}
+
+// Upload implements Uploader.
+func (d *Custom) Upload(ctx context.Context, info UploadInfo, r io.Reader) (Version, error) {
+	start := time.Now()
+
+	if err := validate.StructCtx(ctx, &info); err != nil {
+		return Version{}, errors.Join(ErrInvalidUpload, err)
+	}
+
+	if !customVersionRegex.MatchString(info.ID) {
+		return Version{}, errors.Join(
+			ErrInvalidUpload,
+			errors.New("version id contains invalid characters"),
+		)
+	}
+
+	file, err := os.CreateTemp(d.dir, ".upload-*")
+	if err != nil {
+		return Version{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hw := &hashWriter{w: file, h: sha256.New()}
+
+	size, err := io.Copy(hw, r)
+	if err != nil {
+		return Version{}, err
+	}
+
+	if size == 0 {
+		return Version{}, errors.Join(
+			ErrInvalidUpload,
+			errors.New("the uploaded jar is empty"),
+		)
+	}
+
+	if err = file.Close(); err != nil {
+		return Version{}, err
+	}
+
+	dataVersion, err := jarDataVersion(file.Name())
+	if err != nil {
+		slog.Warn(
+			"CustomDistribution: Failed to read the data version of the jar",
+			"version", info.ID,
+			"error", err,
+		)
+	}
+
+	// The previous jar is kept until the upsert succeeds, so that the
+	// stored hash always matches the file on disk
+	jarPath := d.jarPath(info.ID)
+	oldPath := jarPath + ".old"
+
+	hadOld := true
+	if err = os.Rename(jarPath, oldPath); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return Version{}, err
+		}
+		hadOld = false
+	}
+
+	restore := func() {
+		if hadOld {
+			err := os.Rename(oldPath, jarPath)
+			if err != nil {
+				slog.Error(
+					"CustomDistribution: Failed to restore previous jar",
+					"version", info.ID,
+					"error", err,
+				)
+			}
+		} else {
+			os.Remove(jarPath)
+		}
+	}
+
+	if err = os.Rename(file.Name(), jarPath); err != nil {
+		restore()
+		return Version{}, err
+	}
+
+	v, err := d.db.CustomVersionUpsert(ctx, db.CustomVersionUpsertParams{
+		Version:     info.ID,
+		Name:        info.Name,
+		JavaVersion: info.JavaVersion,
+		Hash:        hw.Sum(),
+		Size:        size,
+		DataVersion: dataVersion,
+	})
+	if err != nil {
+		restore()
+		return Version{}, err
+	}
+
+	if hadOld {
+		os.Remove(oldPath)
+	}
+
+	slog.Info(
+		"CustomDistribution: Uploaded version",
+		"version", v.Version,
+		"size", v.Size,
+		"took", time.Since(start).Round(time.Millisecond),
+	)
+
+	return d.intoVersion(v), nil
+}
+
+// SetLocalToken sets a token accepted besides the ones of the nodes,
+// for the node run by the api that is not stored in the database.
+func (d *Custom) SetLocalToken(token string) {
+	d.localToken = token
+}
+
+// ServeHTTP implements http.Handler.
+func (d *Custom) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !d.authorize(r.Context(), r.Header.Get("Authorization")) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	name, ok := strings.CutPrefix(r.URL.Path, "/custom/")
+	if ok {
+		name, ok = strings.CutSuffix(name, ".jar")
+	}
+
+	if !ok || !customVersionRegex.MatchString(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	http.ServeFile(w, r, d.jarPath(name))
+}
+
+// authorize reports whether the token is the one of a node.
+func (d *Custom) authorize(ctx context.Context, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	if d.localToken != "" &&
+		subtle.ConstantTimeCompare([]byte(token), []byte(d.localToken)) == 1 {
+		return true
+	}
+
+	_, err := d.db.NodeGetByToken(ctx, token)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("CustomDistribution: Failed to get node by token", "error", err)
+	}
+	return err == nil
+}
+
+func (d *Custom) jarPath(version string) string {
+	return filepath.Join(d.dir, version+".jar")
+}
+
+func (d *Custom) intoVersion(v db.CustomVersion) Version {
+	return Version{
+		ID:           v.Version,
+		Name:         v.Name,
+		URL:          d.publicURL + "/custom/" + url.PathEscape(v.Version) + ".jar",
+		Hash:         v.Hash,
+		HashType:     pb.HashType_SHA256,
+		Distribution: pb.Distribution_CUSTOM,
+		JavaVersion:  v.JavaVersion,
+		DataVersion:  v.DataVersion,
+	}
+}
+
+// jarDataVersion reads the world version from the version.json of the
+// jar, present in the vanilla based jars since 1.14.
+func jarDataVersion(name string) (int32, error) {
+	r, err := zip.OpenReader(name)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+
+	f, err := r.Open("version.json")
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var data struct {
+		WorldVersion int32 `json:"world_version"`
+	}
+	if err = json.NewDecoder(f).Decode(&data); err != nil {
+		return 0, err
+	}
+	return data.WorldVersion, nil
+}
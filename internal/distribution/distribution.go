@@ -8,29 +8,137 @@ import (
 	"crypto/sha3"
 	"crypto/sha512"
 	"errors"
+	"fmt"
 	"hash"
 	"io"
 	"net/http"
 	"os"
+	"slices"
+	"time"
 
+	"github.com/zanz1n/mc-manager/config"
 	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type Distribution interface {
 	GetLatest(ctx context.Context) (Version, error)
 	GetVersion(ctx context.Context, semver string) (Version, error)
 
-	GetAll(ctx context.Context) ([]string, error)
+	GetAll(ctx context.Context) ([]VersionInfo, error)
+}
+
+type VersionInfo struct {
+	ID string `json:"id"`
+	// zero when unknown
+	ReleaseTime time.Time        `json:"release_time"`
+	Type        pb.VersionType   `json:"type"`
+	JavaVersion pb.JavaVersion   `json:"java_version"`
+	Support     pb.SupportStatus `json:"support"`
+}
+
+func (v *VersionInfo) IntoPB() *pb.VersionInfo {
+	rt := (*timestamppb.Timestamp)(nil)
+	if !v.ReleaseTime.IsZero() {
+		rt = timestamppb.New(v.ReleaseTime)
+	}
+
+	return &pb.VersionInfo{
+		Id:          v.ID,
+		Type:        v.Type,
+		ReleaseTime: rt,
+		JavaVersion: v.JavaVersion,
+		Support:     v.Support,
+	}
+}
+
+type GetAllOptions struct {
+	// when empty all the types are returned
+	Types []pb.VersionType
+	// versions with unknown release time are not filtered out
+	Since time.Time
+	Sort  pb.VersionSort
+}
+
+func (o *GetAllOptions) FromPB(data *pb.DistributionGetAllRequest) {
+	since := time.Time{}
+	if data.Since != nil {
+		since = data.Since.AsTime()
+	}
+
+	*o = GetAllOptions{
+		Types: data.Types,
+		Since: since,
+		Sort:  data.Sort,
+	}
+}
+
+func (o *GetAllOptions) Apply(versions []VersionInfo) []VersionInfo {
+	res := make([]VersionInfo, 0, len(versions))
+	for _, v := range versions {
+		if len(o.Types) != 0 && !slices.Contains(o.Types, v.Type) {
+			continue
+		}
+		if !o.Since.IsZero() && !v.ReleaseTime.IsZero() {
+			if v.ReleaseTime.Before(o.Since) {
+				continue
+			}
+		}
+		res = append(res, v)
+	}
+
+	switch o.Sort {
+	case pb.VersionSort_SORT_NEWEST:
+		slices.SortStableFunc(res, func(a, b VersionInfo) int {
+			return b.ReleaseTime.Compare(a.ReleaseTime)
+		})
+	case pb.VersionSort_SORT_OLDEST:
+		slices.SortStableFunc(res, func(a, b VersionInfo) int {
+			return a.ReleaseTime.Compare(b.ReleaseTime)
+		})
+	}
+
+	return res
+}
+
+// Builder is implemented by the distributions that publish
+// more than one build for the same version.
+type Builder interface {
+	GetBuild(ctx context.Context, semver string, build int32) (Version, error)
+	GetBuilds(ctx context.Context, semver string) ([]Version, error)
+}
+
+type Uploader interface {
+	Upload(ctx context.Context, info UploadInfo, r io.Reader) (Version, error)
+}
+
+type UploadInfo struct {
+	ID          string         `json:"id" validate:"required,min=2,max=16"`
+	Name        string         `json:"name" validate:"required,max=128"`
+	JavaVersion pb.JavaVersion `json:"java_version" validate:"required"`
+}
+
+func (i *UploadInfo) FromPB(data *pb.DistributionUploadInfo) {
+	*i = UploadInfo{
+		ID:          data.VersionId,
+		Name:        data.Name,
+		JavaVersion: data.JavaVersion,
+	}
 }
 
 type Version struct {
 	ID           string          `json:"id"`
+	Name         string          `json:"name"`
 	URL          string          `json:"url"`
 	Hash         []byte          `json:"hash"`
 	JVMArgs      []string        `json:"jvm_args"`
 	HashType     pb.HashType     `json:"hash_type"`
 	Distribution pb.Distribution `json:"distribution"`
 	JavaVersion  pb.JavaVersion  `json:"java_version"`
+	Build        int32           `json:"build"`
+	Channel      pb.BuildChannel `json:"channel"`
+	// The data version of the worlds saved by the jar, zero when unknown
+	DataVersion int32 `json:"data_version"`
 }
 
 func (v *Version) IntoPB() *pb.Version {
@@ -41,6 +149,23 @@ func (v *Version) IntoPB() *pb.Version {
 		HashType:     v.HashType,
 		Hash:         v.Hash,
 		JavaVersion:  v.JavaVersion,
+		Name:         v.Name,
+		Build:        v.Build,
+		Channel:      v.Channel,
+	}
+}
+
+func (v *Version) FromPB(data *pb.Version) {
+	*v = Version{
+		ID:           data.Id,
+		Name:         data.Name,
+		URL:          data.Url,
+		Hash:         data.Hash,
+		HashType:     data.HashType,
+		Distribution: data.Distribution,
+		JavaVersion:  data.JavaVersion,
+		Build:        data.Build,
+		Channel:      data.Channel,
 	}
 }
 
@@ -75,40 +200,42 @@ func (v *Version) Download(ctx context.Context, c *http.Client) (io.ReadCloser,
 	if err != nil {
 		return nil, errors.Join(ErrHttp, err)
 	}
+
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, errors.Join(
+			ErrHttp,
+			fmt.Errorf("unexpected http status %s", res.Status),
+		)
+	}
 	return res.Body, nil
 }
 
+// DownloadTo downloads the version with the default [Downloader],
+// without any mirrors.
 func (v *Version) DownloadTo(ctx context.Context, c *http.Client, path string) error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	body, err := v.Download(ctx, c)
-	if err != nil {
-		return err
-	}
-	defer body.Close()
+	return NewDownloader(c, config.DownloadConfig{}).DownloadTo(ctx, v, path)
+}
 
+// VerifyFile checks the hash of the file in path. Versions
+// without hash are always considered valid.
+func (v *Version) VerifyFile(path string) error {
 	hashProto := v.CreateHash()
 	if hashProto == nil {
-		_, err = io.Copy(file, body)
-		return err
+		return nil
 	}
 
-	hw := &hashWriter{
-		w: file,
-		h: hashProto,
+	file, err := os.Open(path)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	_, err = io.Copy(hw, body)
-	if err != nil {
+	if _, err = io.Copy(hashProto, file); err != nil {
 		return err
 	}
 
-	gotHash := hw.Sum()
-	if !bytes.Equal(v.Hash, gotHash) {
+	if !bytes.Equal(v.Hash, hashProto.Sum(nil)) {
 		return errors.Join(
 			ErrHashFailed,
 			errors.New("match failed"),
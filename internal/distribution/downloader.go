@@ -0,0 +1,250 @@
+package distribution
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zanz1n/mc-manager/config"
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+const (
+	defaultDownloadRetries = 3
+	defaultDownloadBackoff = time.Second
+)
+
+// Downloader downloads the server jars into a temporary file, resuming
+// it with http Range requests between the attempts. The file is only
+// renamed into the target path after the hash is verified.
+type Downloader struct {
+	c       *http.Client
+	retries int
+	backoff time.Duration
+	mirrors map[pb.Distribution][]*url.URL
+	tokens  map[pb.Distribution]string
+}
+
+func NewDownloader(c *http.Client, cfg config.DownloadConfig) *Downloader {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	if cfg.Retries <= 0 {
+		cfg.Retries = defaultDownloadRetries
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = defaultDownloadBackoff
+	}
+
+	mirrors := make(map[pb.Distribution][]*url.URL)
+	for name, urls := range cfg.Mirrors {
+		distro, ok := pb.Distribution_value[strings.ToUpper(name)]
+		if !ok {
+			slog.Warn("Downloader: Unknown mirror distribution", "name", name)
+			continue
+		}
+
+		for _, rawUrl := range urls {
+			u, err := url.Parse(rawUrl)
+			if err != nil || u.Scheme == "" || u.Host == "" {
+				slog.Warn("Downloader: Invalid mirror url", "url", rawUrl)
+				continue
+			}
+
+			key := pb.Distribution(distro)
+			mirrors[key] = append(mirrors[key], u)
+		}
+	}
+
+	return &Downloader{
+		c:       c,
+		retries: cfg.Retries,
+		backoff: cfg.Backoff,
+		mirrors: mirrors,
+		tokens:  make(map[pb.Distribution]string),
+	}
+}
+
+// SetToken sets the token sent in the Authorization header when
+// downloading the versions of the distribution. It is only sent to the
+// original url of the versions, never to the mirrors.
+func (d *Downloader) SetToken(distro pb.Distribution, token string) {
+	d.tokens[distro] = token
+}
+
+func (d *Downloader) DownloadTo(ctx context.Context, v *Version, path string) error {
+	start := time.Now()
+	partPath := path + ".part"
+
+	var errs []error
+	for i, u := range d.urls(v) {
+		backoff := d.backoff
+
+		token := ""
+		if i == 0 {
+			token = d.tokens[v.Distribution]
+		}
+
+		for attempt := range d.retries {
+			if attempt != 0 {
+				select {
+				case <-time.After(backoff):
+				case <-ctx.Done():
+					return errors.Join(ErrHttp, ctx.Err())
+				}
+				backoff *= 2
+			}
+
+			err := d.downloadPart(ctx, u, token, partPath)
+			if err == nil {
+				if err = v.VerifyFile(partPath); err != nil {
+					// Corrupted download, restarting it from the beginning
+					os.Remove(partPath)
+				}
+			}
+
+			if err == nil {
+				if err = os.Rename(partPath, path); err != nil {
+					return err
+				}
+
+				slog.Info(
+					"Downloader: Downloaded version",
+					"distribution", v.Distribution,
+					"id", v.ID,
+					"url", u,
+					"took", time.Since(start).Round(time.Millisecond),
+				)
+				return nil
+			}
+
+			slog.Warn(
+				"Downloader: Failed to download version",
+				"distribution", v.Distribution,
+				"id", v.ID,
+				"url", u,
+				"attempt", attempt+1,
+				"error", err,
+			)
+			errs = append(errs, err)
+
+			var serr *httpStatusError
+			if errors.As(err, &serr) && !serr.retryable() {
+				break
+			}
+		}
+	}
+
+	os.Remove(partPath)
+	return errors.Join(append([]error{ErrHttp}, errs...)...)
+}
+
+func (d *Downloader) urls(v *Version) []string {
+	urls := []string{v.URL}
+
+	orig, err := url.Parse(v.URL)
+	if err != nil {
+		return urls
+	}
+
+	for _, mirror := range d.mirrors[v.Distribution] {
+		u := *orig
+		u.Scheme = mirror.Scheme
+		u.Host = mirror.Host
+		u.User = mirror.User
+		u.Path = strings.TrimSuffix(mirror.Path, "/") + orig.Path
+		u.RawPath = ""
+
+		urls = append(urls, u.String())
+	}
+
+	return urls
+}
+
+func (d *Downloader) downloadPart(
+	ctx context.Context,
+	u string,
+	token string,
+	partPath string,
+) error {
+	file, err := os.OpenFile(partPath, os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	offset, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+
+	if offset > 0 {
+		req.Header.Set("Range", "bytes="+strconv.FormatInt(offset, 10)+"-")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+
+	res, err := d.c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+		// The server ignored the range, starting over
+		if offset > 0 {
+			if err = file.Truncate(0); err != nil {
+				return err
+			}
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+		}
+
+	case http.StatusPartialContent:
+
+	case http.StatusRequestedRangeNotSatisfiable:
+		// The part file is already complete
+		if offset > 0 {
+			return nil
+		}
+		fallthrough
+
+	default:
+		return &httpStatusError{code: res.StatusCode, status: res.Status}
+	}
+
+	_, err = io.Copy(file, res.Body)
+	return err
+}
+
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+// Error implements error.
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("unexpected http status %s", e.status)
+}
+
+func (e *httpStatusError) retryable() bool {
+	return e.code >= 500 ||
+		e.code == http.StatusRequestTimeout ||
+		e.code == http.StatusTooManyRequests
+}
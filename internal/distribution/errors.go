@@ -6,6 +6,10 @@ var (
 	ErrHttp                = errors.New("http error while fetching distribution")
 	ErrVersionNotFound     = errors.New("distribution version not found")
 	ErrInvalidDistribution = errors.New("distribution is invalid")
+	ErrUploadUnsupported   = errors.New("distribution does not support uploads")
+	ErrBuildsUnsupported   = errors.New("distribution does not support builds")
+	ErrBuildNotFound       = errors.New("distribution build not found")
+	ErrInvalidUpload       = errors.New("invalid distribution upload")
 
 	ErrHashNotAvailable = errors.New("hash not available for this version")
 	ErrHashFailed       = errors.New("failed to verify hash")
@@ -7,6 +7,8 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"slices"
+	"strings"
 
 	"github.com/zanz1n/mc-manager/internal/pb"
 )
@@ -17,7 +19,10 @@ type paperManifest struct {
 
 type paperVersion struct {
 	Version struct {
-		ID   string `json:"id" validate:"required"`
+		ID      string `json:"id" validate:"required"`
+		Support struct {
+			Status string `json:"status"`
+		} `json:"support"`
 		Java struct {
 			Flags struct {
 				Recomended []string `json:"recommended"`
@@ -30,6 +35,8 @@ type paperVersion struct {
 }
 
 type paperBuild struct {
+	ID        int32                         `json:"id" validate:"required"`
+	Channel   string                        `json:"channel"`
 	Downloads map[string]paperBuildDownload `json:"downloads"`
 }
 
@@ -43,6 +50,11 @@ type paperBuildDownload struct {
 	} `json:"checksums"`
 }
 
+// The number of recent versions checked for a stable build by GetLatest
+const paperLatestVersions = 5
+
+var _ Builder = (*paper)(nil)
+
 type paper struct {
 	c *http.Client
 }
@@ -69,52 +81,82 @@ func (d *paper) GetLatest(ctx context.Context) (Version, error) {
 		return Version{}, errors.Join(ErrHttp, err)
 	}
 
-	if len(data.Versions) == 0 {
-		return Version{}, ErrVersionNotFound
+	// The newest versions may not have any stable build yet, only a
+	// few of them are checked since each one is a request
+	versions := data.Versions[:min(len(data.Versions), paperLatestVersions)]
+	for _, version := range versions {
+		v, err := d.getLatestStable(ctx, version)
+		if errors.Is(err, ErrBuildNotFound) {
+			continue
+		}
+		return v, err
 	}
 
-	// TODO: implement cache of latest version
-	return d.GetVersion(ctx, data.Versions[0].Version.ID)
+	return Version{}, ErrVersionNotFound
 }
 
 // GetVersion implements Distribution.
 func (d *paper) GetVersion(ctx context.Context, semver string) (Version, error) {
-	fetchUrl := fmt.Sprintf(
-		"https://fill.papermc.io/v3/projects/paper/versions/%s",
-		semver,
-	)
+	version, err := d.getPaperVersion(ctx, semver)
+	if err != nil {
+		return Version{}, err
+	}
 
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchUrl, nil)
+	return d.getLatestStable(ctx, version)
+}
+
+// GetBuild implements Builder.
+func (d *paper) GetBuild(ctx context.Context, semver string, build int32) (Version, error) {
+	version, err := d.getPaperVersion(ctx, semver)
 	if err != nil {
-		return Version{}, errors.Join(ErrHttp, err)
+		return Version{}, err
 	}
 
-	res, err := d.c.Do(req)
+	fetchUrl := fmt.Sprintf(
+		"https://fill.papermc.io/v3/projects/paper/versions/%s/builds/%d",
+		version.Version.ID,
+		build,
+	)
+
+	var data paperBuild
+
+	err = getreq(ctx, d.c, fetchUrl, &data)
 	if err != nil {
+		if isNotFound(err) {
+			return Version{}, errors.Join(ErrBuildNotFound, err)
+		}
 		return Version{}, errors.Join(ErrHttp, err)
 	}
-	defer res.Body.Close()
 
-	if res.StatusCode != http.StatusOK {
-		return Version{}, ErrVersionNotFound
-	}
+	return d.intoVersion(version, data)
+}
 
-	var data paperVersion
+// GetBuilds implements Builder.
+func (d *paper) GetBuilds(ctx context.Context, semver string) ([]Version, error) {
+	version, err := d.getPaperVersion(ctx, semver)
+	if err != nil {
+		return nil, err
+	}
 
-	err = json.NewDecoder(res.Body).Decode(&data)
+	builds, err := d.getBuilds(ctx, version)
 	if err != nil {
-		return Version{}, errors.Join(ErrHttp, err)
+		return nil, err
 	}
 
-	if err = validate.StructCtx(ctx, &data); err != nil {
-		return Version{}, errors.Join(ErrHttp, err)
+	res := make([]Version, 0, len(builds))
+	for _, build := range builds {
+		v, err := d.intoVersion(version, build)
+		if err != nil {
+			continue
+		}
+		res = append(res, v)
 	}
 
-	return d.getVersion(ctx, data)
+	return res, nil
 }
 
 // GetAll implements Distribution.
-func (d *paper) GetAll(ctx context.Context) ([]string, error) {
+func (d *paper) GetAll(ctx context.Context) ([]VersionInfo, error) {
 	var data paperManifest
 
 	err := getreq(
@@ -127,37 +169,110 @@ func (d *paper) GetAll(ctx context.Context) ([]string, error) {
 		return nil, errors.Join(ErrHttp, err)
 	}
 
-	res := make([]string, len(data.Versions))
-	for i := range data.Versions {
-		res[i] = data.Versions[i].Version.ID
+	res := make([]VersionInfo, len(data.Versions))
+	for i, v := range data.Versions {
+		vtype := pb.VersionType_VERSION_TYPE_RELEASE
+		if strings.Contains(v.Version.ID, "-pre") || strings.Contains(v.Version.ID, "-rc") {
+			vtype = pb.VersionType_VERSION_TYPE_SNAPSHOT
+		}
+
+		res[i] = VersionInfo{
+			ID:          v.Version.ID,
+			Type:        vtype,
+			JavaVersion: normalizeJavaLts(v.Version.Java.Version.Minimum),
+			Support:     paperSupportStatus(v.Version.Support.Status),
+		}
 	}
 
 	return res, nil
 }
 
-func (d *paper) getVersion(ctx context.Context, version paperVersion) (Version, error) {
+func (d *paper) getPaperVersion(ctx context.Context, semver string) (paperVersion, error) {
 	fetchUrl := fmt.Sprintf(
-		"https://fill.papermc.io/v3/projects/paper/versions/%s/builds/latest",
+		"https://fill.papermc.io/v3/projects/paper/versions/%s",
+		semver,
+	)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fetchUrl, nil)
+	if err != nil {
+		return paperVersion{}, errors.Join(ErrHttp, err)
+	}
+
+	res, err := d.c.Do(req)
+	if err != nil {
+		return paperVersion{}, errors.Join(ErrHttp, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return paperVersion{}, ErrVersionNotFound
+	}
+
+	var data paperVersion
+
+	err = json.NewDecoder(res.Body).Decode(&data)
+	if err != nil {
+		return paperVersion{}, errors.Join(ErrHttp, err)
+	}
+
+	if err = validate.StructCtx(ctx, &data); err != nil {
+		return paperVersion{}, errors.Join(ErrHttp, err)
+	}
+
+	return data, nil
+}
+
+func (d *paper) getBuilds(ctx context.Context, version paperVersion) ([]paperBuild, error) {
+	fetchUrl := fmt.Sprintf(
+		"https://fill.papermc.io/v3/projects/paper/versions/%s/builds",
 		version.Version.ID,
 	)
 
-	var data paperBuild
+	var data []paperBuild
 
-	err := getreq(ctx, d.c, fetchUrl, &data)
+	err := getreqMany(ctx, d.c, fetchUrl, &data)
 	if err != nil {
-		return Version{}, errors.Join(ErrHttp, err)
+		return nil, errors.Join(ErrHttp, err)
+	}
+
+	slices.SortFunc(data, func(a, b paperBuild) int {
+		return int(b.ID - a.ID)
+	})
+
+	return data, nil
+}
+
+// Only the STABLE and RECOMMENDED channels are considered
+// stable, experimental builds are never picked automatically.
+func (d *paper) getLatestStable(ctx context.Context, version paperVersion) (Version, error) {
+	builds, err := d.getBuilds(ctx, version)
+	if err != nil {
+		return Version{}, err
 	}
 
-	var (
-		ok       bool
-		download paperBuildDownload
+	for _, build := range builds {
+		switch paperChannel(build.Channel) {
+		case pb.BuildChannel_CHANNEL_STABLE, pb.BuildChannel_CHANNEL_RECOMMENDED:
+			return d.intoVersion(version, build)
+		}
+	}
+
+	return Version{}, errors.Join(
+		ErrBuildNotFound,
+		fmt.Errorf("no stable build available for %s", version.Version.ID),
 	)
-	for _, v := range data.Downloads {
-		download, ok = v, true
+}
+
+func (d *paper) intoVersion(version paperVersion, build paperBuild) (Version, error) {
+	download, ok := build.Downloads["server:default"]
+	if !ok {
+		for _, v := range build.Downloads {
+			download, ok = v, true
+		}
 	}
 
 	if !ok {
-		return Version{}, ErrVersionNotFound
+		return Version{}, ErrBuildNotFound
 	}
 	javaVersion := normalizeJavaLts(version.Version.Java.Version.Minimum)
 
@@ -175,5 +290,35 @@ func (d *paper) getVersion(ctx context.Context, version paperVersion) (Version,
 		HashType:     htype,
 		Distribution: pb.Distribution_PAPER,
 		JavaVersion:  javaVersion,
+		Build:        build.ID,
+		Channel:      paperChannel(build.Channel),
 	}, nil
 }
+
+func paperChannel(channel string) pb.BuildChannel {
+	switch strings.ToUpper(channel) {
+	case "STABLE":
+		return pb.BuildChannel_CHANNEL_STABLE
+	case "RECOMMENDED":
+		return pb.BuildChannel_CHANNEL_RECOMMENDED
+	case "BETA":
+		return pb.BuildChannel_CHANNEL_BETA
+	case "ALPHA", "EXPERIMENTAL":
+		return pb.BuildChannel_CHANNEL_ALPHA
+	}
+
+	return pb.BuildChannel_CHANNEL_NONE
+}
+
+func paperSupportStatus(status string) pb.SupportStatus {
+	switch strings.ToUpper(status) {
+	case "SUPPORTED":
+		return pb.SupportStatus_SUPPORT_SUPPORTED
+	case "DEPRECATED":
+		return pb.SupportStatus_SUPPORT_DEPRECATED
+	case "UNSUPPORTED":
+		return pb.SupportStatus_SUPPORT_UNSUPPORTED
+	}
+
+	return pb.SupportStatus_SUPPORT_UNKNOWN
+}
@@ -2,6 +2,7 @@ package distribution
 
 import (
 	"context"
+	"io"
 
 	"github.com/zanz1n/mc-manager/internal/pb"
 )
@@ -43,13 +44,77 @@ func (r *Repository) GetVersion(
 	return d.GetVersion(ctx, semver)
 }
 
+// GetBuild returns the latest stable build of the version if build is zero.
+func (r *Repository) GetBuild(
+	ctx context.Context,
+	distro pb.Distribution,
+	semver string,
+	build int32,
+) (Version, error) {
+	d, ok := r.m[distro]
+	if !ok {
+		return Version{}, ErrInvalidDistribution
+	}
+
+	if build == 0 {
+		return d.GetVersion(ctx, semver)
+	}
+
+	b, ok := d.(Builder)
+	if !ok {
+		return Version{}, ErrBuildsUnsupported
+	}
+	return b.GetBuild(ctx, semver, build)
+}
+
+func (r *Repository) GetBuilds(
+	ctx context.Context,
+	distro pb.Distribution,
+	semver string,
+) ([]Version, error) {
+	d, ok := r.m[distro]
+	if !ok {
+		return nil, ErrInvalidDistribution
+	}
+
+	b, ok := d.(Builder)
+	if !ok {
+		return nil, ErrBuildsUnsupported
+	}
+	return b.GetBuilds(ctx, semver)
+}
+
 func (r *Repository) GetAll(
 	ctx context.Context,
 	distro pb.Distribution,
-) ([]string, error) {
+	opts GetAllOptions,
+) ([]VersionInfo, error) {
 	d, ok := r.m[distro]
 	if !ok {
 		return nil, ErrInvalidDistribution
 	}
-	return d.GetAll(ctx)
+
+	versions, err := d.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return opts.Apply(versions), nil
+}
+
+func (r *Repository) Upload(
+	ctx context.Context,
+	distro pb.Distribution,
+	info UploadInfo,
+	rd io.Reader,
+) (Version, error) {
+	d, ok := r.m[distro]
+	if !ok {
+		return Version{}, ErrInvalidDistribution
+	}
+
+	u, ok := d.(Uploader)
+	if !ok {
+		return Version{}, ErrUploadUnsupported
+	}
+	return u.Upload(ctx, info, rd)
 }
@@ -2,8 +2,10 @@ package distribution
 
 import (
 	"context"
+	"errors"
 
 	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/grpc"
 )
 
 var _ pb.DistributionServiceServer = (*Server)(nil)
@@ -35,7 +37,7 @@ func (s *Server) GetVersion(
 	ctx context.Context,
 	req *pb.DistributionGetVersionRequest,
 ) (*pb.Version, error) {
-	v, err := s.r.GetVersion(ctx, req.Distribution, req.VersionId)
+	v, err := s.r.GetBuild(ctx, req.Distribution, req.VersionId, req.Build)
 	if err != nil {
 		return nil, err
 	}
@@ -43,17 +45,78 @@ func (s *Server) GetVersion(
 	return v.IntoPB(), nil
 }
 
+// GetBuilds implements pb.DistributionServiceServer.
+func (s *Server) GetBuilds(
+	ctx context.Context,
+	req *pb.DistributionGetBuildsRequest,
+) (*pb.DistributionGetBuildsResponse, error) {
+	builds, err := s.r.GetBuilds(ctx, req.Distribution, req.VersionId)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pb.Version, len(builds))
+	for i := range builds {
+		res[i] = builds[i].IntoPB()
+	}
+
+	return &pb.DistributionGetBuildsResponse{
+		Builds: res,
+	}, nil
+}
+
 // GetAll implements pb.DistributionServiceServer.
 func (s *Server) GetAll(
 	ctx context.Context,
 	req *pb.DistributionGetAllRequest,
 ) (*pb.DistributionGetAllResponse, error) {
-	v, err := s.r.GetAll(ctx, req.Distribution)
+	var opts GetAllOptions
+	opts.FromPB(req)
+
+	versions, err := s.r.GetAll(ctx, req.Distribution, opts)
 	if err != nil {
 		return nil, err
 	}
 
+	res := make([]*pb.VersionInfo, len(versions))
+	for i := range versions {
+		res[i] = versions[i].IntoPB()
+	}
+
 	return &pb.DistributionGetAllResponse{
-		Versions: v,
+		Versions: res,
 	}, nil
 }
+
+// Upload implements pb.DistributionServiceServer.
+func (s *Server) Upload(
+	stream grpc.ClientStreamingServer[pb.DistributionUploadRequest, pb.Version],
+) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	data := req.GetInfo()
+	if data == nil {
+		return errors.Join(
+			ErrInvalidUpload,
+			errors.New("the first message must contain the upload info"),
+		)
+	}
+
+	var info UploadInfo
+	info.FromPB(data)
+
+	v, err := s.r.Upload(
+		stream.Context(),
+		pb.Distribution_CUSTOM,
+		info,
+		&uploadReader{stream: stream},
+	)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(v.IntoPB())
+}
@@ -3,12 +3,14 @@ package distribution
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"hash"
 	"io"
 	"net/http"
 
 	"github.com/go-playground/validator/v10"
 	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/grpc"
 )
 
 var validate = validator.New()
@@ -25,6 +27,10 @@ func getreq(ctx context.Context, c *http.Client, url string, v any) error {
 	}
 	defer res.Body.Close()
 
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &httpStatusError{code: res.StatusCode, status: res.Status}
+	}
+
 	err = json.NewDecoder(res.Body).Decode(v)
 	if err != nil {
 		return err
@@ -33,6 +39,40 @@ func getreq(ctx context.Context, c *http.Client, url string, v any) error {
 	return validate.StructCtx(ctx, v)
 }
 
+func getreqMany[T any](ctx context.Context, c *http.Client, url string, v *[]T) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return &httpStatusError{code: res.StatusCode, status: res.Status}
+	}
+
+	err = json.NewDecoder(res.Body).Decode(v)
+	if err != nil {
+		return err
+	}
+
+	for i := range *v {
+		if err = validate.StructCtx(ctx, &(*v)[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func isNotFound(err error) bool {
+	var serr *httpStatusError
+	return errors.As(err, &serr) && serr.code == http.StatusNotFound
+}
+
 func normalizeJavaLts(v uint8) pb.JavaVersion {
 	switch {
 	case v <= 8:
@@ -70,3 +110,32 @@ func (h *hashWriter) Write(p []byte) (n int, err error) {
 func (h *hashWriter) Sum() []byte {
 	return h.h.Sum(nil)
 }
+
+var _ io.Reader = (*uploadReader)(nil)
+
+type uploadReader struct {
+	stream grpc.ClientStreamingServer[pb.DistributionUploadRequest, pb.Version]
+	buf    []byte
+}
+
+// Read implements io.Reader.
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		if req.GetInfo() != nil {
+			return 0, errors.Join(
+				ErrInvalidUpload,
+				errors.New("upload info sent more than once"),
+			)
+		}
+		r.buf = req.GetChunk()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
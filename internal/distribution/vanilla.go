@@ -5,6 +5,7 @@ import (
 	"encoding/hex"
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/zanz1n/mc-manager/internal/pb"
 )
@@ -19,9 +20,10 @@ type vanillaManifest struct {
 }
 
 type vanillaManifestVersion struct {
-	ID   string `json:"id" validate:"required"`
-	Type string `json:"type" validate:"required"`
-	URL  string `json:"url" validate:"required,url"`
+	ID          string    `json:"id" validate:"required"`
+	Type        string    `json:"type" validate:"required"`
+	URL         string    `json:"url" validate:"required,url"`
+	ReleaseTime time.Time `json:"releaseTime"`
 }
 
 type vanillaVersion struct {
@@ -101,15 +103,21 @@ func (d *vanilla) GetVersion(ctx context.Context, semver string) (Version, error
 }
 
 // GetAll implements Distribution.
-func (d *vanilla) GetAll(ctx context.Context) ([]string, error) {
+func (d *vanilla) GetAll(ctx context.Context) ([]VersionInfo, error) {
 	data, err := d.getManifest(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	res := make([]string, len(data.Versions))
-	for i := range data.Versions {
-		res[i] = data.Versions[i].ID
+	res := make([]VersionInfo, len(data.Versions))
+	for i, v := range data.Versions {
+		res[i] = VersionInfo{
+			ID:          v.ID,
+			ReleaseTime: v.ReleaseTime,
+			Type:        vanillaVersionType(v.Type),
+			JavaVersion: vanillaJavaVersion(v.ReleaseTime),
+			Support:     pb.SupportStatus_SUPPORT_UNKNOWN,
+		}
 	}
 	return res, nil
 }
@@ -157,3 +165,34 @@ func (d *vanilla) getVersion(
 		JavaVersion:  javaVersion,
 	}, nil
 }
+
+func vanillaVersionType(t string) pb.VersionType {
+	switch t {
+	case "release":
+		return pb.VersionType_VERSION_TYPE_RELEASE
+	case "snapshot":
+		return pb.VersionType_VERSION_TYPE_SNAPSHOT
+	case "old_beta":
+		return pb.VersionType_VERSION_TYPE_OLD_BETA
+	case "old_alpha":
+		return pb.VersionType_VERSION_TYPE_OLD_ALPHA
+	}
+
+	return pb.VersionType_VERSION_TYPE_UNKNOWN
+}
+
+// The manifest does not include the java version, so it is estimated
+// from the release time of the first snapshots that required it:
+// 21w19a (java 16) and 24w14a (java 21).
+func vanillaJavaVersion(releaseTime time.Time) pb.JavaVersion {
+	switch {
+	case releaseTime.IsZero():
+		return pb.JavaVersion_JAVA_UNKNOWN
+	case !releaseTime.Before(time.Date(2024, 4, 3, 0, 0, 0, 0, time.UTC)):
+		return pb.JavaVersion_JAVA21
+	case !releaseTime.Before(time.Date(2021, 5, 12, 0, 0, 0, 0, time.UTC)):
+		return normalizeJavaLts(16)
+	}
+
+	return pb.JavaVersion_JAVA8
+}
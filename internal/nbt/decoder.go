@@ -0,0 +1,273 @@
+package nbt
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+const (
+	maxDepth = 512
+	// Upper bound of the elements allocated at once, bigger
+	// arrays grow as the data is actually read.
+	maxPrealloc = 1 << 16
+)
+
+var ErrMaxDepth = errors.New("nbt: max depth exceeded")
+
+type Decoder struct {
+	r     io.Reader
+	buf   [8]byte
+	depth int
+}
+
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Decode reads a possibly compressed root compound from r.
+func Decode(r io.Reader) (string, Compound, error) {
+	r, err := Decompress(r)
+	if err != nil {
+		return "", nil, err
+	}
+	return NewDecoder(r).Decode()
+}
+
+// Decode reads an uncompressed named root compound.
+func (d *Decoder) Decode() (string, Compound, error) {
+	tagType, err := d.readByte()
+	if err != nil {
+		return "", nil, err
+	}
+
+	if TagType(tagType) != TagCompound {
+		return "", nil, fmt.Errorf(
+			"nbt: expected root %s, got %s",
+			TagCompound,
+			TagType(tagType),
+		)
+	}
+
+	name, err := d.readString()
+	if err != nil {
+		return "", nil, err
+	}
+
+	c, err := d.readCompound()
+	return name, c, err
+}
+
+// DecodeNetwork reads an unnamed root compound, the format used in the
+// packets since 1.20.2. A nil compound is returned if the root is an
+// end tag, which is sent when the value is absent.
+func (d *Decoder) DecodeNetwork() (Compound, error) {
+	tagType, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch TagType(tagType) {
+	case TagEnd:
+		return nil, nil
+	case TagCompound:
+		return d.readCompound()
+	}
+
+	return nil, fmt.Errorf(
+		"nbt: expected root %s, got %s",
+		TagCompound,
+		TagType(tagType),
+	)
+}
+
+func (d *Decoder) readPayload(t TagType) (any, error) {
+	switch t {
+	case TagByte:
+		b, err := d.readByte()
+		return int8(b), err
+	case TagShort:
+		b, err := d.readn(2)
+		return int16(binary.BigEndian.Uint16(b)), err
+	case TagInt:
+		return d.readInt()
+	case TagLong:
+		b, err := d.readn(8)
+		return int64(binary.BigEndian.Uint64(b)), err
+	case TagFloat:
+		b, err := d.readn(4)
+		return math.Float32frombits(binary.BigEndian.Uint32(b)), err
+	case TagDouble:
+		b, err := d.readn(8)
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), err
+	case TagByteArray:
+		return d.readByteArray()
+	case TagString:
+		return d.readString()
+	case TagList:
+		return d.readList()
+	case TagCompound:
+		return d.readCompound()
+	case TagIntArray:
+		return readArray(d, func(b []byte) int32 {
+			return int32(binary.BigEndian.Uint32(b))
+		}, 4)
+	case TagLongArray:
+		return readArray(d, func(b []byte) int64 {
+			return int64(binary.BigEndian.Uint64(b))
+		}, 8)
+	}
+
+	return nil, fmt.Errorf("nbt: invalid tag type %d", t)
+}
+
+func (d *Decoder) readCompound() (Compound, error) {
+	if d.depth++; d.depth > maxDepth {
+		return nil, ErrMaxDepth
+	}
+	defer func() { d.depth-- }()
+
+	c := make(Compound)
+	for {
+		tagType, err := d.readByte()
+		if err != nil {
+			return nil, err
+		}
+
+		if TagType(tagType) == TagEnd {
+			return c, nil
+		}
+
+		name, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		c[name], err = d.readPayload(TagType(tagType))
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (d *Decoder) readList() (List, error) {
+	if d.depth++; d.depth > maxDepth {
+		return List{}, ErrMaxDepth
+	}
+	defer func() { d.depth-- }()
+
+	tagType, err := d.readByte()
+	if err != nil {
+		return List{}, err
+	}
+
+	size, err := d.readLen()
+	if err != nil {
+		return List{}, err
+	}
+
+	list := List{
+		Type:   TagType(tagType),
+		Values: make([]any, 0, min(size, maxPrealloc)),
+	}
+
+	for range size {
+		v, err := d.readPayload(list.Type)
+		if err != nil {
+			return List{}, err
+		}
+		list.Values = append(list.Values, v)
+	}
+
+	return list, nil
+}
+
+func (d *Decoder) readByteArray() ([]byte, error) {
+	size, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, 0, min(size, maxPrealloc))
+	for len(b) < size {
+		chunk := min(size-len(b), maxPrealloc)
+
+		start := len(b)
+		b = append(b, make([]byte, chunk)...)
+		if _, err = io.ReadFull(d.r, b[start:]); err != nil {
+			return nil, err
+		}
+	}
+
+	return b, nil
+}
+
+func readArray[T int32 | int64](d *Decoder, conv func([]byte) T, width int) ([]T, error) {
+	size, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]T, 0, min(size, maxPrealloc))
+	for range size {
+		b, err := d.readn(width)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, conv(b))
+	}
+
+	return res, nil
+}
+
+// Java modified UTF-8 is treated as plain UTF-8, which only
+// differs for the null character and supplementary characters.
+func (d *Decoder) readString() (string, error) {
+	b, err := d.readn(2)
+	if err != nil {
+		return "", err
+	}
+
+	s := make([]byte, binary.BigEndian.Uint16(b))
+	if _, err = io.ReadFull(d.r, s); err != nil {
+		return "", err
+	}
+
+	return string(s), nil
+}
+
+func (d *Decoder) readInt() (int32, error) {
+	b, err := d.readn(4)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.BigEndian.Uint32(b)), nil
+}
+
+func (d *Decoder) readLen() (int, error) {
+	size, err := d.readInt()
+	if err != nil {
+		return 0, err
+	}
+
+	if size < 0 {
+		return 0, fmt.Errorf("nbt: negative length %d", size)
+	}
+	return int(size), nil
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	b, err := d.readn(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+func (d *Decoder) readn(n int) ([]byte, error) {
+	b := d.buf[:n]
+	_, err := io.ReadFull(d.r, b)
+	return b, err
+}
@@ -0,0 +1,319 @@
+package nbt
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+// allTags returns a compound with a value of every tag type.
+func allTags() Compound {
+	return Compound{
+		"byte":       int8(-12),
+		"short":      int16(math.MinInt16),
+		"int":        int32(math.MaxInt32),
+		"long":       int64(-4172144997902289642),
+		"float":      float32(0.5),
+		"double":     math.Pi,
+		"byte_array": []byte{0, 1, 2, 0xff},
+		"string":     "héllo wörld",
+		"empty":      "",
+		"list":       List{Type: TagString, Values: []any{"a", "b"}},
+		// The vanilla server writes the empty lists with the end type
+		"empty_list": List{Type: TagEnd, Values: []any{}},
+		"list_of_lists": List{Type: TagList, Values: []any{
+			List{Type: TagInt, Values: []any{int32(1), int32(2)}},
+			List{Type: TagDouble, Values: []any{}},
+		}},
+		"list_of_compounds": List{Type: TagCompound, Values: []any{
+			Compound{"id": "minecraft:stone", "count": int32(64)},
+			Compound{},
+		}},
+		"compound":         Compound{"nested": Compound{"deep": int8(1)}},
+		"int_array":        []int32{math.MinInt32, 0, math.MaxInt32},
+		"long_array":       []int64{math.MinInt64, 0, math.MaxInt64},
+		"empty_int_array":  []int32{},
+		"empty_long_array": []int64{},
+		"empty_byte_array": []byte{},
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	compressions := map[string]Compression{
+		"none": CompressionNone,
+		"gzip": CompressionGzip,
+		"zlib": CompressionZlib,
+	}
+
+	for name, compression := range compressions {
+		t.Run(name, func(t *testing.T) {
+			want := allTags()
+
+			var buf bytes.Buffer
+			if err := Encode(&buf, "root", want, compression); err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			rootName, got, err := Decode(&buf)
+			if err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if rootName != "root" {
+				t.Fatalf("root name = %q, want %q", rootName, "root")
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("decoded %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestRoundTripNetwork(t *testing.T) {
+	for _, want := range []Compound{allTags(), nil} {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).EncodeNetwork(want); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+
+		got, err := NewDecoder(&buf).DecodeNetwork()
+		if err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("%d bytes left after decoding", buf.Len())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("decoded %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestEncodeDeterministic(t *testing.T) {
+	var a, b bytes.Buffer
+	if err := NewEncoder(&a).Encode("", allTags()); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewEncoder(&b).Encode("", allTags()); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(a.Bytes(), b.Bytes()) {
+		t.Fatal("the same compound was encoded differently")
+	}
+}
+
+func TestDecodeLevelDat(t *testing.T) {
+	b, err := os.ReadFile(path.Join("testdata", "level.dat"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, root, err := Decode(bytes.NewReader(b))
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if name != "" {
+		t.Fatalf("root name = %q, want empty", name)
+	}
+
+	data, ok := root.Compound("Data")
+	if !ok {
+		t.Fatal("Data compound not found")
+	}
+
+	if v, _ := data.Int("DataVersion"); v != 4189 {
+		t.Errorf("DataVersion = %d, want 4189", v)
+	}
+	if v, _ := data.String("LevelName"); v != "world" {
+		t.Errorf("LevelName = %q, want %q", v, "world")
+	}
+	if v, ok := data.Number("Difficulty"); !ok || v != 2 {
+		t.Errorf("Difficulty = %d, want 2", v)
+	}
+	if v, ok := data.Bool("hardcore"); !ok || v {
+		t.Errorf("hardcore = %t, want false", v)
+	}
+
+	version, ok := data.Compound("Version")
+	if !ok {
+		t.Fatal("Version compound not found")
+	}
+	if v, _ := version.String("Name"); v != "1.21.4" {
+		t.Errorf("Version.Name = %q, want %q", v, "1.21.4")
+	}
+
+	settings, ok := data.Compound("WorldGenSettings")
+	if !ok {
+		t.Fatal("WorldGenSettings compound not found")
+	}
+	if v, _ := settings.Long("seed"); v != -4172144997902289642 {
+		t.Errorf("seed = %d, want -4172144997902289642", v)
+	}
+
+	rules, ok := data.Compound("GameRules")
+	if !ok {
+		t.Fatal("GameRules compound not found")
+	}
+	if v, _ := rules.String("keepInventory"); v != "false" {
+		t.Errorf("keepInventory = %q, want %q", v, "false")
+	}
+
+	packs, _ := data.Compound("DataPacks")
+	if enabled, _ := packs.List("Enabled"); !reflect.DeepEqual(enabled.Values, []any{"vanilla"}) {
+		t.Errorf("DataPacks.Enabled = %v, want [vanilla]", enabled.Values)
+	}
+	if events, ok := data.List("ScheduledEvents"); !ok || events.Type != TagEnd || len(events.Values) != 0 {
+		t.Errorf("ScheduledEvents = %+v, want an empty list", events)
+	}
+
+	// Rewritten as the game rules are
+	var buf bytes.Buffer
+	if err = Encode(&buf, name, root, CompressionGzip); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	_, root2, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("decode encoded: %v", err)
+	}
+	if !reflect.DeepEqual(root2, root) {
+		t.Fatal("the level.dat changed after a round trip")
+	}
+}
+
+// nested returns a root compound holding a list named "l" of nested
+// lists, the innermost being empty, for a total of depth levels.
+func nested(depth int) []byte {
+	b := []byte{byte(TagCompound), 0, 0, byte(TagList), 0, 1, 'l'}
+	for range depth - 2 {
+		b = append(b, byte(TagList), 0, 0, 0, 1)
+	}
+	b = append(b, byte(TagEnd), 0, 0, 0, 0)
+	return append(b, byte(TagEnd))
+}
+
+func TestDecodeMaxDepth(t *testing.T) {
+	if _, _, err := NewDecoder(bytes.NewReader(nested(maxDepth))).Decode(); err != nil {
+		t.Fatalf("decode %d levels: %v", maxDepth, err)
+	}
+
+	_, _, err := NewDecoder(bytes.NewReader(nested(maxDepth + 1))).Decode()
+	if !errors.Is(err, ErrMaxDepth) {
+		t.Fatalf("decode %d levels: got %v, want %v", maxDepth+1, err, ErrMaxDepth)
+	}
+}
+
+func TestDecodeLength(t *testing.T) {
+	header := func(t TagType) []byte {
+		return []byte{byte(TagCompound), 0, 0, byte(t), 0, 1, 'v'}
+	}
+	withLen := func(b []byte, size int32) []byte {
+		return binary.BigEndian.AppendUint32(b, uint32(size))
+	}
+
+	tests := map[string][]byte{
+		"byte array":          withLen(header(TagByteArray), math.MaxInt32),
+		"int array":           withLen(header(TagIntArray), math.MaxInt32),
+		"long array":          withLen(header(TagLongArray), math.MaxInt32),
+		"list":                withLen(append(header(TagList), byte(TagCompound)), math.MaxInt32),
+		"negative byte array": withLen(header(TagByteArray), -1),
+		"negative list":       withLen(append(header(TagList), byte(TagInt)), -1),
+		"list of end tags":    withLen(append(header(TagList), byte(TagEnd)), 1),
+		"string":              append(header(TagString), 0xff, 0xff, 'a'),
+	}
+
+	for name, b := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := NewDecoder(bytes.NewReader(b)).Decode()
+			if err == nil {
+				t.Fatal("decoded a truncated or invalid length")
+			}
+		})
+	}
+}
+
+// depthOf returns the nesting of lists and compounds in v.
+func depthOf(v any) int {
+	var values []any
+	switch v := v.(type) {
+	case Compound:
+		for _, v := range v {
+			values = append(values, v)
+		}
+	case List:
+		values = v.Values
+	default:
+		return 0
+	}
+
+	depth := 0
+	for _, v := range values {
+		depth = max(depth, depthOf(v))
+	}
+	return depth + 1
+}
+
+func FuzzDecode(f *testing.F) {
+	level, err := os.ReadFile(path.Join("testdata", "level.dat"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	r, err := Decompress(bytes.NewReader(level))
+	if err != nil {
+		f.Fatal(err)
+	}
+	level, err = io.ReadAll(r)
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Add(level)
+
+	var buf bytes.Buffer
+	if err = NewEncoder(&buf).Encode("", allTags()); err != nil {
+		f.Fatal(err)
+	}
+	f.Add(buf.Bytes())
+	f.Add(nested(maxDepth + 1))
+	f.Add([]byte{byte(TagCompound), 0, 0, byte(TagByteArray), 0, 1, 'v', 0x7f, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		name, c, err := NewDecoder(bytes.NewReader(b)).Decode()
+		if err != nil {
+			return
+		}
+
+		if depth := depthOf(c); depth > maxDepth {
+			t.Fatalf("decoded %d levels, limit is %d", depth, maxDepth)
+		}
+
+		var buf bytes.Buffer
+		if err = NewEncoder(&buf).Encode(name, c); err != nil {
+			t.Fatalf("encode: %v", err)
+		}
+		encoded := bytes.Clone(buf.Bytes())
+
+		// Every value is read from the input, so the repeated keys
+		// are the only difference in size
+		if len(encoded) > len(b) {
+			t.Fatalf("encoded %d bytes from %d", len(encoded), len(b))
+		}
+
+		name2, c2, err := NewDecoder(bytes.NewReader(encoded)).Decode()
+		if err != nil {
+			t.Fatalf("decode encoded: %v", err)
+		}
+
+		// Compared encoded, since NaN floats are never equal
+		buf.Reset()
+		if err = NewEncoder(&buf).Encode(name2, c2); err != nil {
+			t.Fatalf("encode decoded: %v", err)
+		}
+		if name2 != name || !bytes.Equal(buf.Bytes(), encoded) {
+			t.Fatalf("encoded\n%x\nwant\n%x", buf.Bytes(), encoded)
+		}
+	})
+}
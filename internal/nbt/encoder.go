@@ -0,0 +1,247 @@
+package nbt
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+)
+
+type Compression uint8
+
+const (
+	CompressionNone Compression = iota
+	CompressionGzip
+	CompressionZlib
+)
+
+type Encoder struct {
+	w     *bufio.Writer
+	buf   [8]byte
+	depth int
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// Encode writes the named root compound into w with the given compression.
+func Encode(w io.Writer, name string, c Compound, compression Compression) error {
+	var cw io.WriteCloser
+	switch compression {
+	case CompressionGzip:
+		cw = gzip.NewWriter(w)
+	case CompressionZlib:
+		cw = zlib.NewWriter(w)
+	case CompressionNone:
+		return NewEncoder(w).Encode(name, c)
+	default:
+		return fmt.Errorf("nbt: invalid compression %d", compression)
+	}
+
+	if err := NewEncoder(cw).Encode(name, c); err != nil {
+		cw.Close()
+		return err
+	}
+	return cw.Close()
+}
+
+// Encode writes an uncompressed named root compound. The keys are
+// written in lexical order, so the output is deterministic.
+func (e *Encoder) Encode(name string, c Compound) error {
+	e.w.WriteByte(byte(TagCompound))
+	if err := e.writeString(name); err != nil {
+		return err
+	}
+
+	if err := e.writeCompound(c); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+// EncodeNetwork writes an unnamed root compound, the format used in
+// the packets since 1.20.2. A nil compound is written as an end tag.
+func (e *Encoder) EncodeNetwork(c Compound) error {
+	if c == nil {
+		e.w.WriteByte(byte(TagEnd))
+		return e.w.Flush()
+	}
+
+	e.w.WriteByte(byte(TagCompound))
+	if err := e.writeCompound(c); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
+
+func (e *Encoder) writePayload(v any) error {
+	switch v := v.(type) {
+	case int8:
+		return e.w.WriteByte(byte(v))
+	case int16:
+		binary.BigEndian.PutUint16(e.buf[:2], uint16(v))
+		_, err := e.w.Write(e.buf[:2])
+		return err
+	case int32:
+		return e.writeInt(v)
+	case int64:
+		binary.BigEndian.PutUint64(e.buf[:8], uint64(v))
+		_, err := e.w.Write(e.buf[:8])
+		return err
+	case float32:
+		binary.BigEndian.PutUint32(e.buf[:4], math.Float32bits(v))
+		_, err := e.w.Write(e.buf[:4])
+		return err
+	case float64:
+		binary.BigEndian.PutUint64(e.buf[:8], math.Float64bits(v))
+		_, err := e.w.Write(e.buf[:8])
+		return err
+	case []byte:
+		if err := e.writeLen(len(v)); err != nil {
+			return err
+		}
+		_, err := e.w.Write(v)
+		return err
+	case string:
+		return e.writeString(v)
+	case List:
+		return e.writeList(v)
+	case Compound:
+		return e.writeCompound(v)
+	case []int32:
+		if err := e.writeLen(len(v)); err != nil {
+			return err
+		}
+		for _, n := range v {
+			if err := e.writeInt(n); err != nil {
+				return err
+			}
+		}
+		return nil
+	case []int64:
+		if err := e.writeLen(len(v)); err != nil {
+			return err
+		}
+		for _, n := range v {
+			binary.BigEndian.PutUint64(e.buf[:8], uint64(n))
+			if _, err := e.w.Write(e.buf[:8]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	return fmt.Errorf("nbt: unsupported type %T", v)
+}
+
+func (e *Encoder) writeCompound(c Compound) error {
+	if e.depth++; e.depth > maxDepth {
+		return ErrMaxDepth
+	}
+	defer func() { e.depth-- }()
+
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+
+	for _, k := range keys {
+		t, ok := tagTypeOf(c[k])
+		if !ok {
+			return fmt.Errorf("nbt: %s: unsupported type %T", k, c[k])
+		}
+
+		e.w.WriteByte(byte(t))
+		if err := e.writeString(k); err != nil {
+			return err
+		}
+		if err := e.writePayload(c[k]); err != nil {
+			return err
+		}
+	}
+
+	return e.w.WriteByte(byte(TagEnd))
+}
+
+func (e *Encoder) writeList(l List) error {
+	if e.depth++; e.depth > maxDepth {
+		return ErrMaxDepth
+	}
+	defer func() { e.depth-- }()
+
+	t := l.Type
+	e.w.WriteByte(byte(t))
+	if err := e.writeLen(len(l.Values)); err != nil {
+		return err
+	}
+
+	for _, v := range l.Values {
+		if vt, _ := tagTypeOf(v); vt != t {
+			return fmt.Errorf("nbt: list of %s contains a %T", t, v)
+		}
+		if err := e.writePayload(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *Encoder) writeString(s string) error {
+	if len(s) > math.MaxUint16 {
+		return fmt.Errorf("nbt: string of length %d is too long", len(s))
+	}
+
+	binary.BigEndian.PutUint16(e.buf[:2], uint16(len(s)))
+	e.w.Write(e.buf[:2])
+	_, err := e.w.WriteString(s)
+	return err
+}
+
+func (e *Encoder) writeInt(n int32) error {
+	binary.BigEndian.PutUint32(e.buf[:4], uint32(n))
+	_, err := e.w.Write(e.buf[:4])
+	return err
+}
+
+func (e *Encoder) writeLen(n int) error {
+	if n > math.MaxInt32 {
+		return fmt.Errorf("nbt: length %d is too big", n)
+	}
+	return e.writeInt(int32(n))
+}
+
+func tagTypeOf(v any) (TagType, bool) {
+	switch v.(type) {
+	case int8:
+		return TagByte, true
+	case int16:
+		return TagShort, true
+	case int32:
+		return TagInt, true
+	case int64:
+		return TagLong, true
+	case float32:
+		return TagFloat, true
+	case float64:
+		return TagDouble, true
+	case []byte:
+		return TagByteArray, true
+	case string:
+		return TagString, true
+	case List:
+		return TagList, true
+	case Compound:
+		return TagCompound, true
+	case []int32:
+		return TagIntArray, true
+	case []int64:
+		return TagLongArray, true
+	}
+	return TagEnd, false
+}
@@ -0,0 +1,159 @@
+package nbt
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+)
+
+type TagType uint8
+
+const (
+	TagEnd TagType = iota
+	TagByte
+	TagShort
+	TagInt
+	TagLong
+	TagFloat
+	TagDouble
+	TagByteArray
+	TagString
+	TagList
+	TagCompound
+	TagIntArray
+	TagLongArray
+)
+
+func (t TagType) String() string {
+	switch t {
+	case TagEnd:
+		return "TAG_End"
+	case TagByte:
+		return "TAG_Byte"
+	case TagShort:
+		return "TAG_Short"
+	case TagInt:
+		return "TAG_Int"
+	case TagLong:
+		return "TAG_Long"
+	case TagFloat:
+		return "TAG_Float"
+	case TagDouble:
+		return "TAG_Double"
+	case TagByteArray:
+		return "TAG_Byte_Array"
+	case TagString:
+		return "TAG_String"
+	case TagList:
+		return "TAG_List"
+	case TagCompound:
+		return "TAG_Compound"
+	case TagIntArray:
+		return "TAG_Int_Array"
+	case TagLongArray:
+		return "TAG_Long_Array"
+	}
+	return "TAG_Unknown"
+}
+
+// Compound is the decoded form of a TAG_Compound. The values are
+// int8, int16, int32, int64, float32, float64, []byte, string,
+// List, Compound, []int32 or []int64, depending on the tag type.
+type Compound map[string]any
+
+// List is the decoded form of a TAG_List.
+type List struct {
+	Type   TagType
+	Values []any
+}
+
+func (c Compound) Compound(key string) (Compound, bool) {
+	v, ok := c[key].(Compound)
+	return v, ok
+}
+
+func (c Compound) List(key string) (List, bool) {
+	v, ok := c[key].(List)
+	return v, ok
+}
+
+func (c Compound) String(key string) (string, bool) {
+	v, ok := c[key].(string)
+	return v, ok
+}
+
+func (c Compound) Byte(key string) (int8, bool) {
+	v, ok := c[key].(int8)
+	return v, ok
+}
+
+func (c Compound) Bool(key string) (bool, bool) {
+	v, ok := c[key].(int8)
+	return v != 0, ok
+}
+
+func (c Compound) Short(key string) (int16, bool) {
+	v, ok := c[key].(int16)
+	return v, ok
+}
+
+func (c Compound) Int(key string) (int32, bool) {
+	v, ok := c[key].(int32)
+	return v, ok
+}
+
+func (c Compound) Long(key string) (int64, bool) {
+	v, ok := c[key].(int64)
+	return v, ok
+}
+
+func (c Compound) Float(key string) (float32, bool) {
+	v, ok := c[key].(float32)
+	return v, ok
+}
+
+func (c Compound) Double(key string) (float64, bool) {
+	v, ok := c[key].(float64)
+	return v, ok
+}
+
+// Number returns any integer or floating point tag as an int64,
+// since the tag types of some fields changed between versions.
+func (c Compound) Number(key string) (int64, bool) {
+	switch v := c[key].(type) {
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case float32:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Decompress detects gzip and zlib compressed streams by their magic
+// bytes, returning the reader untouched if it is not compressed.
+func Decompress(r io.Reader) (io.Reader, error) {
+	br := bufio.NewReader(r)
+
+	magic, err := br.Peek(2)
+	if err != nil {
+		return br, nil
+	}
+
+	switch {
+	case magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(br)
+	case magic[0] == 0x78 && (uint16(magic[0])<<8|uint16(magic[1]))%31 == 0:
+		return zlib.NewReader(br)
+	}
+
+	return br, nil
+}
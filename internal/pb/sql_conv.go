@@ -61,6 +61,60 @@ func (x *InstanceLimits) Scan(src any) error {
 	return nil
 }
 
+var _ sql.Scanner = (*InstanceWorldSettings)(nil)
+var _ driver.Valuer = (*InstanceWorldSettings)(nil)
+
+// Value implements driver.Valuer.
+func (x *InstanceWorldSettings) Value() (driver.Value, error) {
+	return json.Marshal(x)
+}
+
+// Scan implements sql.Scanner.
+func (x *InstanceWorldSettings) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(src), x); err != nil {
+			return scanErrInstanceWorldSettings(src, err)
+		}
+
+	case []byte:
+		if err := json.Unmarshal(src, x); err != nil {
+			return scanErrInstanceWorldSettings(src, err)
+		}
+
+	default:
+		return scanErrInstanceWorldSettings(src, nil)
+	}
+	return nil
+}
+
+var _ sql.Scanner = (*GameRules)(nil)
+var _ driver.Valuer = (*GameRules)(nil)
+
+// Value implements driver.Valuer.
+func (x *GameRules) Value() (driver.Value, error) {
+	return json.Marshal(x)
+}
+
+// Scan implements sql.Scanner.
+func (x *GameRules) Scan(src any) error {
+	switch src := src.(type) {
+	case string:
+		if err := json.Unmarshal([]byte(src), x); err != nil {
+			return scanErrGameRules(src, err)
+		}
+
+	case []byte:
+		if err := json.Unmarshal(src, x); err != nil {
+			return scanErrGameRules(src, err)
+		}
+
+	default:
+		return scanErrGameRules(src, nil)
+	}
+	return nil
+}
+
 func scanErrInstanceConfig(src any, err error) error {
 	if err != nil {
 		return fmt.Errorf(
@@ -90,3 +144,33 @@ func scanErrInstanceLimits(src any, err error) error {
 		)
 	}
 }
+
+func scanErrInstanceWorldSettings(src any, err error) error {
+	if err != nil {
+		return fmt.Errorf(
+			"Scan: unable to scan type %T into InstanceWorldSettings",
+			src,
+		)
+	} else {
+		return fmt.Errorf(
+			"Scan: unable to scan type %T into InstanceWorldSettings: %w",
+			src,
+			err,
+		)
+	}
+}
+
+func scanErrGameRules(src any, err error) error {
+	if err != nil {
+		return fmt.Errorf(
+			"Scan: unable to scan type %T into GameRules",
+			src,
+		)
+	} else {
+		return fmt.Errorf(
+			"Scan: unable to scan type %T into GameRules: %w",
+			src,
+			err,
+		)
+	}
+}
@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"encoding/json"
+	"errors"
 	"time"
 
 	"github.com/google/uuid"
@@ -87,11 +88,7 @@ type ClientBoundLoginDisconect struct {
 
 // EncodeMCP implements Encodable.
 func (p *ClientBoundLoginDisconect) EncodeMCP(e *Encoder) error {
-	b, err := json.Marshal(p)
-	if err != nil {
-		return err
-	}
-	return e.WriteBytes(b)
+	return e.WriteBytes(p.Message)
 }
 
 // DecodeMCP implements Decodable.
@@ -101,5 +98,9 @@ func (p *ClientBoundLoginDisconect) DecodeMCP(d *Decoder) error {
 		return err
 	}
 
-	return json.Unmarshal(b, p)
+	if !json.Valid(b) {
+		return errors.New("proxy: invalid disconnect message")
+	}
+	p.Message = b
+	return nil
 }
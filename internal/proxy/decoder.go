@@ -3,36 +3,47 @@ package proxy
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"io"
 	"math"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/nbt"
 	"github.com/zanz1n/mc-manager/internal/utils"
 )
 
+// Upper bound of the length of the strings, in characters
+const maxStringLen = 32767
+
 type Decodable interface {
 	DecodeMCP(*Decoder) error
 }
 
 type Decoder struct {
-	buf         *bytes.Buffer
-	maxByteSize uint64
+	buf *bytes.Reader
 }
 
 func NewDecoder(b []byte) *Decoder {
-	return &Decoder{
-		buf:         bytes.NewBuffer(b),
-		maxByteSize: math.MaxUint32,
-	}
+	return &Decoder{buf: bytes.NewReader(b)}
+}
+
+// Len returns the number of unread bytes.
+func (d *Decoder) Len() int {
+	return d.buf.Len()
 }
 
 func (d *Decoder) ReadBool() (bool, error) {
-	b, err := d.buf.ReadByte()
+	b, err := d.ReadByte()
 	return b != 0, err
 }
 
 func (d *Decoder) ReadByte() (byte, error) {
-	return d.buf.ReadByte()
+	b, err := d.buf.ReadByte()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b, err
 }
 
 func (d *Decoder) ReadUint16() (uint16, error) {
@@ -75,37 +86,70 @@ func (d *Decoder) ReadFloat64() (float64, error) {
 	return math.Float64frombits(i), nil
 }
 
-func (d *Decoder) ReadVarInt() (int64, error) {
-	return binary.ReadVarint(d.buf)
+func (d *Decoder) ReadVarInt() (int32, error) {
+	v, err := ReadVarInt(d.buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
 }
 
-func (d *Decoder) ReadVarUint() (uint64, error) {
-	return binary.ReadUvarint(d.buf)
+func (d *Decoder) ReadVarLong() (int64, error) {
+	v, err := ReadVarLong(d.buf)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return v, err
 }
 
+// ReadBytes reads a VarInt prefixed byte array.
 func (d *Decoder) ReadBytes() ([]byte, error) {
-	size, err := d.ReadVarUint()
+	size, err := d.ReadVarInt()
 	if err != nil {
 		return nil, err
 	}
 
-	if size > d.maxByteSize {
-		return nil, io.ErrShortBuffer
+	if size < 0 {
+		return nil, fmt.Errorf("proxy: invalid byte array length %d", size)
 	}
-
 	return d.readn(int(size))
 }
 
+// ReadString reads a string of at most 32767 characters.
 func (d *Decoder) ReadString() (string, error) {
-	b, err := d.ReadBytes()
+	return d.ReadStringMax(maxStringLen)
+}
+
+// ReadStringMax reads a string of at most max characters, as
+// defined by the protocol for each field.
+func (d *Decoder) ReadStringMax(max int) (string, error) {
+	size, err := d.ReadVarInt()
+	if err != nil {
+		return "", err
+	}
+
+	// Each character takes up to 3 bytes
+	if size < 0 || int(size) > max*3 {
+		return "", fmt.Errorf("proxy: invalid string length %d", size)
+	}
+
+	b, err := d.readn(int(size))
 	if err != nil {
 		return "", err
 	}
+
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("proxy: invalid utf-8 string")
+	}
+	if n := utf16Len(b); n > max {
+		return "", fmt.Errorf("proxy: string of %d characters is too long", n)
+	}
 	return utils.UnsafeString(b), nil
 }
 
 func (d *Decoder) ReadLastBytes() []byte {
-	return d.buf.Bytes()
+	b, _ := d.readn(d.buf.Len())
+	return b
 }
 
 func (d *Decoder) ReadUUID() (uuid.UUID, error) {
@@ -113,22 +157,62 @@ func (d *Decoder) ReadUUID() (uuid.UUID, error) {
 	if err != nil {
 		return uuid.Nil, err
 	}
+	return uuid.UUID(b), nil
+}
 
-	id := uuid.UUID{}
-	copy(id[:], b)
+func (d *Decoder) ReadPosition() (Position, error) {
+	v, err := d.ReadUint64()
+	if err != nil {
+		return Position{}, err
+	}
+	return unpackPosition(v), nil
+}
+
+// ReadNBT reads a compound in the format of the protocol version,
+// unnamed since 1.20.2 and named before it. A nil compound is
+// returned if it is absent.
+func (d *Decoder) ReadNBT(protocol int32) (nbt.Compound, error) {
+	dec := nbt.NewDecoder(d.buf)
+	if protocol >= ProtocolNetworkNBT {
+		return dec.DecodeNetwork()
+	}
 
-	return id, nil
+	b, err := d.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	if nbt.TagType(b) == nbt.TagEnd {
+		return nil, nil
+	}
+	d.buf.UnreadByte()
+
+	_, c, err := dec.Decode()
+	return c, err
 }
 
+// readn returns the next n bytes, failing before allocating
+// if there are not enough of them.
 func (d *Decoder) readn(n int) ([]byte, error) {
-	b := make([]byte, n)
-	n2, err := d.buf.Read(b)
-	if err != nil {
-		return b, err
+	if n > d.buf.Len() {
+		return nil, io.ErrUnexpectedEOF
 	}
 
-	if n2 != n {
-		return b, io.ErrShortBuffer
+	b := make([]byte, n)
+	_, err := io.ReadFull(d.buf, b)
+	return b, err
+}
+
+// utf16Len returns the length of the string in java characters.
+func utf16Len(b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r > 0xffff {
+			n += 2
+		} else {
+			n++
+		}
+		b = b[size:]
 	}
-	return b, nil
+	return n
 }
@@ -0,0 +1,119 @@
+package proxy
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/zanz1n/mc-manager/internal/nbt"
+)
+
+// The last protocol versions of the named and unnamed nbt formats
+var nbtProtocols = []int32{ProtocolNetworkNBT - 1, ProtocolNetworkNBT}
+
+func testCompound() nbt.Compound {
+	return nbt.Compound{
+		"text":  "A Minecraft Server",
+		"color": "gold",
+		"bold":  int8(1),
+		"extra": nbt.List{Type: nbt.TagCompound, Values: []any{
+			nbt.Compound{"text": "!", "italic": int8(0)},
+		}},
+		"seed": int64(-4172144997902289642),
+		"pos":  []int32{-48, 71, 160},
+	}
+}
+
+func TestNBTRoundTrip(t *testing.T) {
+	for _, protocol := range nbtProtocols {
+		for _, want := range []nbt.Compound{testCompound(), {}, nil} {
+			e := NewEncoder()
+			if err := e.WriteNBT(protocol, want); err != nil {
+				t.Fatalf("protocol %d: write: %v", protocol, err)
+			}
+			// The following field must be left untouched
+			e.WriteVarInt(25565)
+
+			d := NewDecoder(e.Bytes())
+			got, err := d.ReadNBT(protocol)
+			if err != nil {
+				t.Fatalf("protocol %d: read: %v", protocol, err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("protocol %d: read %+v, want %+v", protocol, got, want)
+			}
+
+			if v, err := d.ReadVarInt(); err != nil || v != 25565 {
+				t.Fatalf("protocol %d: next field = %d, %v", protocol, v, err)
+			}
+		}
+	}
+}
+
+func TestNBTFormat(t *testing.T) {
+	c := nbt.Compound{"a": int8(1)}
+
+	named := NewEncoder()
+	named.WriteNBT(ProtocolNetworkNBT-1, c)
+	// Compound, empty root name, byte "a" = 1, end
+	want := []byte{0x0a, 0x00, 0x00, 0x01, 0x00, 0x01, 'a', 0x01, 0x00}
+	if !bytes.Equal(named.Bytes(), want) {
+		t.Fatalf("named nbt = %x, want %x", named.Bytes(), want)
+	}
+
+	network := NewEncoder()
+	network.WriteNBT(ProtocolNetworkNBT, c)
+	// Without the root name
+	want = []byte{0x0a, 0x01, 0x00, 0x01, 'a', 0x01, 0x00}
+	if !bytes.Equal(network.Bytes(), want) {
+		t.Fatalf("network nbt = %x, want %x", network.Bytes(), want)
+	}
+}
+
+func FuzzReadNBT(f *testing.F) {
+	for _, protocol := range nbtProtocols {
+		for _, c := range []nbt.Compound{testCompound(), nil} {
+			e := NewEncoder()
+			if err := e.WriteNBT(protocol, c); err != nil {
+				f.Fatal(err)
+			}
+			f.Add(e.Bytes(), protocol)
+		}
+	}
+
+	f.Fuzz(func(t *testing.T, b []byte, protocol int32) {
+		d := NewDecoder(b)
+
+		c, err := d.ReadNBT(protocol)
+		if err != nil {
+			return
+		}
+		n := len(b) - d.Len()
+
+		e := NewEncoder()
+		if err = e.WriteNBT(protocol, c); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+		encoded := bytes.Clone(e.Bytes())
+
+		// The repeated keys and the root name are the only
+		// differences in size
+		if len(encoded) > n {
+			t.Fatalf("encoded %d bytes, read %d", len(encoded), n)
+		}
+
+		c2, err := NewDecoder(encoded).ReadNBT(protocol)
+		if err != nil {
+			t.Fatalf("read encoded: %v", err)
+		}
+
+		// Compared encoded, since NaN floats are never equal
+		e = NewEncoder()
+		if err = e.WriteNBT(protocol, c2); err != nil {
+			t.Fatalf("write decoded: %v", err)
+		}
+		if !bytes.Equal(e.Bytes(), encoded) {
+			t.Fatalf("encoded\n%x\nwant\n%x", e.Bytes(), encoded)
+		}
+	})
+}
@@ -3,9 +3,11 @@ package proxy
 import (
 	"bytes"
 	"encoding/binary"
+	"fmt"
 	"math"
 
 	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/nbt"
 	"github.com/zanz1n/mc-manager/internal/utils"
 )
 
@@ -77,18 +79,23 @@ func (e *Encoder) WriteFloat64(f float64) error {
 	return e.write(b)
 }
 
-func (e *Encoder) WriteVarInt(i int64) error {
-	b := binary.AppendVarint(nil, i)
+func (e *Encoder) WriteVarInt(i int32) error {
+	b := AppendVarInt(make([]byte, 0, MaxVarIntLen), i)
 	return e.write(b)
 }
 
-func (e *Encoder) WriteVarUint(i uint64) error {
-	b := binary.AppendUvarint(nil, i)
+func (e *Encoder) WriteVarLong(i int64) error {
+	b := AppendVarLong(make([]byte, 0, MaxVarLongLen), i)
 	return e.write(b)
 }
 
+// WriteBytes writes a VarInt prefixed byte array.
 func (e *Encoder) WriteBytes(b []byte) error {
-	err := e.WriteVarInt(int64(len(b)))
+	if len(b) > math.MaxInt32 {
+		return fmt.Errorf("proxy: byte array of length %d is too long", len(b))
+	}
+
+	err := e.WriteVarInt(int32(len(b)))
 	if err != nil {
 		return err
 	}
@@ -97,6 +104,9 @@ func (e *Encoder) WriteBytes(b []byte) error {
 }
 
 func (e *Encoder) WriteString(s string) error {
+	if n := utf16Len(utils.UnsafeBytes(s)); n > maxStringLen {
+		return fmt.Errorf("proxy: string of %d characters is too long", n)
+	}
 	return e.WriteBytes(utils.UnsafeBytes(s))
 }
 
@@ -108,6 +118,29 @@ func (e *Encoder) WriteUUID(id uuid.UUID) error {
 	return e.write(id[:])
 }
 
+func (e *Encoder) WritePosition(p Position) error {
+	v, err := p.pack()
+	if err != nil {
+		return err
+	}
+	return e.WriteUint64(v)
+}
+
+// WriteNBT writes the compound in the format of the protocol version,
+// unnamed since 1.20.2 and named with an empty name before it. A nil
+// compound is written as absent.
+func (e *Encoder) WriteNBT(protocol int32, c nbt.Compound) error {
+	enc := nbt.NewEncoder(e.buf)
+	if protocol >= ProtocolNetworkNBT {
+		return enc.EncodeNetwork(c)
+	}
+
+	if c == nil {
+		return e.buf.WriteByte(byte(nbt.TagEnd))
+	}
+	return enc.Encode("", c)
+}
+
 func (e *Encoder) write(b []byte) error {
 	_, err := e.buf.Write(b)
 	return err
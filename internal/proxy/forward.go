@@ -0,0 +1,280 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/zanz1n/mc-manager/internal/dto"
+)
+
+const (
+	forwardDialTimeout = 5 * time.Second
+	// Idle time after which the udp sessions are dropped
+	udpSessionTimeout = 2 * time.Minute
+	// Sessions of each udp forwarder, since the source addresses of
+	// the datagrams can be spoofed
+	maxUDPSessions  = 1024
+	maxDatagramSize = 65535
+)
+
+// Forwarder forwards an extra port of the node to the server, without
+// inspecting the traffic. Used by plugins with their own protocols.
+type Forwarder interface {
+	Launch()
+	Close() error
+}
+
+var _ Forwarder = (*TCPForwarder)(nil)
+
+type TCPForwarder struct {
+	id       dto.Snowflake
+	endpoint net.TCPAddr
+	guard    *Guard
+
+	ln *net.TCPListener
+}
+
+func NewTCPForwarder(
+	id dto.Snowflake,
+	port int,
+	endpoint net.TCPAddr,
+	guard *Guard,
+) (*TCPForwarder, error) {
+	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
+		IP:   net.IPv4(0, 0, 0, 0),
+		Port: port,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &TCPForwarder{
+		id:       id,
+		endpoint: endpoint,
+		guard:    guard,
+		ln:       ln,
+	}, nil
+}
+
+func (f *TCPForwarder) Close() error {
+	return f.ln.Close()
+}
+
+func (f *TCPForwarder) Launch() {
+	slog.Info("Proxy: Forwarding port", "id", f.id, "addr", f.ln.Addr())
+
+	for {
+		conn, err := f.ln.AcceptTCP()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error(
+					"Proxy: Closed forwarded port unexpectedly",
+					"id", f.id,
+					"addr", f.ln.Addr(),
+					"error", err,
+				)
+				f.ln.Close()
+			}
+			break
+		}
+
+		go func() {
+			if err := f.handle(conn); err != nil {
+				slog.Log(
+					context.Background(),
+					logLevel(err),
+					"Proxy: Failed to forward conn",
+					"id", f.id,
+					"addr", conn.RemoteAddr(),
+					"error", err,
+				)
+			}
+		}()
+	}
+}
+
+func (f *TCPForwarder) handle(tcpConn net.Conn) error {
+	conn, err := f.guard.accept(tcpConn)
+	if err != nil {
+		tcpConn.Close()
+		return err
+	}
+	defer conn.Close()
+
+	serverConn, err := net.DialTimeout("tcp", f.endpoint.String(), forwardDialTimeout)
+	if err != nil {
+		return err
+	}
+	defer serverConn.Close()
+
+	go io.Copy(conn, serverConn)
+	_, err = io.Copy(serverConn, conn)
+	return err
+}
+
+var _ Forwarder = (*UDPForwarder)(nil)
+
+// UDPForwarder keeps a socket towards the server for each client
+// address, so the server sees each client as a different peer.
+type UDPForwarder struct {
+	id       dto.Snowflake
+	endpoint net.UDPAddr
+	guard    *Guard
+
+	ln       *net.UDPConn
+	sessions map[netip.AddrPort]*udpSession
+	mu       sync.Mutex
+}
+
+type udpSession struct {
+	conn *net.UDPConn
+	// unix nanoseconds of the last datagram from the client
+	last atomic.Int64
+}
+
+func NewUDPForwarder(
+	id dto.Snowflake,
+	port int,
+	endpoint net.UDPAddr,
+	guard *Guard,
+) (*UDPForwarder, error) {
+	ln, err := net.ListenUDP("udp", &net.UDPAddr{
+		IP:   net.IPv4(0, 0, 0, 0),
+		Port: port,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &UDPForwarder{
+		id:       id,
+		endpoint: endpoint,
+		guard:    guard,
+		ln:       ln,
+		sessions: make(map[netip.AddrPort]*udpSession),
+	}, nil
+}
+
+func (f *UDPForwarder) Close() error {
+	err := f.ln.Close()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for addr, s := range f.sessions {
+		s.conn.Close()
+		delete(f.sessions, addr)
+	}
+	return err
+}
+
+func (f *UDPForwarder) Launch() {
+	slog.Info("Proxy: Forwarding port", "id", f.id, "addr", f.ln.LocalAddr())
+
+	b := make([]byte, maxDatagramSize)
+	for {
+		n, addr, err := f.ln.ReadFromUDPAddrPort(b)
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error(
+					"Proxy: Closed forwarded port unexpectedly",
+					"id", f.id,
+					"addr", f.ln.LocalAddr(),
+					"error", err,
+				)
+				f.Close()
+			}
+			break
+		}
+
+		s, err := f.session(addr)
+		if err != nil {
+			slog.Log(
+				context.Background(),
+				logLevel(err),
+				"Proxy: Failed to forward datagram",
+				"id", f.id,
+				"addr", addr,
+				"error", err,
+			)
+			continue
+		}
+
+		s.last.Store(time.Now().UnixNano())
+		s.conn.Write(b[:n])
+	}
+}
+
+// session returns the session of the client, creating it if the
+// address is allowed by the guard and the forwarder is not full.
+func (f *UDPForwarder) session(addr netip.AddrPort) (*udpSession, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.sessions[addr]; ok {
+		return s, nil
+	}
+
+	if len(f.sessions) >= maxUDPSessions {
+		return nil, ErrTooManyConns
+	}
+
+	if err := f.guard.acceptSession(addr.Addr().Unmap()); err != nil {
+		return nil, err
+	}
+
+	conn, err := net.DialUDP("udp", nil, &f.endpoint)
+	if err != nil {
+		f.guard.releaseSession()
+		return nil, err
+	}
+
+	s := &udpSession{conn: conn}
+	s.last.Store(time.Now().UnixNano())
+	f.sessions[addr] = s
+
+	go f.reply(addr, s)
+	return s, nil
+}
+
+// reply forwards the datagrams of the server to the client, until
+// the session is idle for too long.
+func (f *UDPForwarder) reply(addr netip.AddrPort, s *udpSession) {
+	defer func() {
+		f.mu.Lock()
+		if f.sessions[addr] == s {
+			delete(f.sessions, addr)
+		}
+		f.mu.Unlock()
+		s.conn.Close()
+		f.guard.releaseSession()
+	}()
+
+	b := make([]byte, maxDatagramSize)
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(udpSessionTimeout))
+
+		n, err := s.conn.Read(b)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				last := time.Unix(0, s.last.Load())
+				if time.Since(last) < udpSessionTimeout {
+					continue
+				}
+			}
+			return
+		}
+
+		if _, err = f.ln.WriteToUDPAddrPort(b[:n], addr); err != nil {
+			return
+		}
+	}
+}
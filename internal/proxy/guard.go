@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Idle time after which the rate limit state of an address is dropped
+const bucketIdleTimeout = time.Minute
+
+var (
+	ErrAddressBlocked     = errors.New("proxy: address is blocked")
+	ErrConnThrottled      = errors.New("proxy: too many connections from the address")
+	ErrTooManyConns       = errors.New("proxy: too many concurrent connections")
+	ErrHandshakeThrottled = errors.New("proxy: too many handshakes from the address")
+)
+
+// Limits protects the node against connection floods. The rates
+// are per second, and are unlimited when zero.
+type Limits struct {
+	// New connections from each address
+	ConnRate  float64
+	ConnBurst int
+	// Handshakes from each address
+	HandshakeRate  float64
+	HandshakeBurst int
+	// Concurrent connections of the node, udp sessions included
+	MaxConns int
+	// Time the clients have to send the handshake, defaults to 10s
+	HandshakeTimeout time.Duration
+}
+
+type GuardStats struct {
+	Conns               int64
+	Blocked             uint64
+	ThrottledConns      uint64
+	ThrottledHandshakes uint64
+	Rejected            uint64
+}
+
+// Guard enforces the limits and the blocklist on the connections of
+// all the listeners of the node. A nil guard accepts everything.
+type Guard struct {
+	limits Limits
+
+	blocklist atomic.Pointer[[]netip.Prefix]
+	conns     atomic.Int64
+
+	buckets   map[netip.Prefix]*ipBuckets
+	lastSweep time.Time
+	mu        sync.Mutex
+
+	blocked             atomic.Uint64
+	throttledConns      atomic.Uint64
+	throttledHandshakes atomic.Uint64
+	rejected            atomic.Uint64
+}
+
+func NewGuard(limits Limits) *Guard {
+	if limits.HandshakeTimeout <= 0 {
+		limits.HandshakeTimeout = offlineTimeout
+	}
+	if limits.ConnBurst < 1 {
+		limits.ConnBurst = 1
+	}
+	if limits.HandshakeBurst < 1 {
+		limits.HandshakeBurst = 1
+	}
+
+	return &Guard{
+		limits:    limits,
+		buckets:   make(map[netip.Prefix]*ipBuckets),
+		lastSweep: time.Now(),
+	}
+}
+
+// SetBlocklist replaces the blocked addresses, the connections already
+// accepted are kept.
+func (g *Guard) SetBlocklist(prefixes []netip.Prefix) {
+	if g == nil {
+		return
+	}
+	g.blocklist.Store(&prefixes)
+}
+
+func (g *Guard) Stats() GuardStats {
+	if g == nil {
+		return GuardStats{}
+	}
+
+	return GuardStats{
+		Conns:               g.conns.Load(),
+		Blocked:             g.blocked.Load(),
+		ThrottledConns:      g.throttledConns.Load(),
+		ThrottledHandshakes: g.throttledHandshakes.Load(),
+		Rejected:            g.rejected.Load(),
+	}
+}
+
+func (g *Guard) handshakeTimeout() time.Duration {
+	if g == nil {
+		return offlineTimeout
+	}
+	return g.limits.HandshakeTimeout
+}
+
+// accept returns an error if the connection must be dropped, otherwise
+// the connection releases its slot when closed.
+func (g *Guard) accept(conn net.Conn) (net.Conn, error) {
+	if g == nil {
+		return conn, nil
+	}
+
+	addr, ok := connAddr(conn.RemoteAddr())
+	if !ok {
+		return conn, nil
+	}
+
+	if g.isBlocked(addr) {
+		g.blocked.Add(1)
+		return nil, ErrAddressBlocked
+	}
+
+	if g.limits.ConnRate > 0 && !g.take(addr, false) {
+		g.throttledConns.Add(1)
+		return nil, ErrConnThrottled
+	}
+
+	if n := g.conns.Add(1); g.limits.MaxConns > 0 && n > int64(g.limits.MaxConns) {
+		g.conns.Add(-1)
+		g.rejected.Add(1)
+		return nil, ErrTooManyConns
+	}
+
+	return &guardedConn{Conn: conn, g: g}, nil
+}
+
+// acceptSession checks a new udp session of a forwarded port, which
+// is limited as a connection. The slot taken by the session must be
+// released with releaseSession when it is dropped.
+func (g *Guard) acceptSession(addr netip.Addr) error {
+	if g == nil {
+		return nil
+	}
+
+	if g.isBlocked(addr) {
+		g.blocked.Add(1)
+		return ErrAddressBlocked
+	}
+
+	if g.limits.ConnRate > 0 && !g.take(addr, false) {
+		g.throttledConns.Add(1)
+		return ErrConnThrottled
+	}
+
+	if n := g.conns.Add(1); g.limits.MaxConns > 0 && n > int64(g.limits.MaxConns) {
+		g.conns.Add(-1)
+		g.rejected.Add(1)
+		return ErrTooManyConns
+	}
+	return nil
+}
+
+func (g *Guard) releaseSession() {
+	if g != nil {
+		g.conns.Add(-1)
+	}
+}
+
+func (g *Guard) allowHandshake(remote net.Addr) bool {
+	if g == nil || g.limits.HandshakeRate <= 0 {
+		return true
+	}
+
+	addr, ok := connAddr(remote)
+	if !ok {
+		return true
+	}
+
+	if !g.take(addr, true) {
+		g.throttledHandshakes.Add(1)
+		return false
+	}
+	return true
+}
+
+func (g *Guard) isBlocked(addr netip.Addr) bool {
+	blocklist := g.blocklist.Load()
+	if blocklist == nil {
+		return false
+	}
+
+	for _, prefix := range *blocklist {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// take consumes a token of the connection or handshake rate limit of
+// the address. IPv6 addresses share the limits of their /64, since
+// clients usually get a whole one.
+func (g *Guard) take(addr netip.Addr, handshake bool) bool {
+	bits := 32
+	if addr.Is6() {
+		bits = 64
+	}
+	key, _ := addr.Prefix(bits)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(g.lastSweep) > bucketIdleTimeout {
+		for k, b := range g.buckets {
+			if now.Sub(b.conns.last) > bucketIdleTimeout &&
+				now.Sub(b.handshakes.last) > bucketIdleTimeout {
+				delete(g.buckets, k)
+			}
+		}
+		g.lastSweep = now
+	}
+
+	b, ok := g.buckets[key]
+	if !ok {
+		b = &ipBuckets{}
+		g.buckets[key] = b
+	}
+
+	if handshake {
+		return b.handshakes.take(now, g.limits.HandshakeRate, g.limits.HandshakeBurst)
+	}
+	return b.conns.take(now, g.limits.ConnRate, g.limits.ConnBurst)
+}
+
+func connAddr(addr net.Addr) (netip.Addr, bool) {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}, false
+	}
+
+	ip, ok := netip.AddrFromSlice(tcp.IP)
+	return ip.Unmap(), ok
+}
+
+type ipBuckets struct {
+	conns      tokenBucket
+	handshakes tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) take(now time.Time, rate float64, burst int) bool {
+	if b.last.IsZero() {
+		b.tokens = float64(burst)
+	} else {
+		b.tokens += now.Sub(b.last).Seconds() * rate
+		b.tokens = min(b.tokens, float64(burst))
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+var _ net.Conn = (*guardedConn)(nil)
+
+// guardedConn releases the slot of the connection when closed.
+type guardedConn struct {
+	net.Conn
+	g      *Guard
+	closed atomic.Bool
+}
+
+// Close implements net.Conn.
+func (c *guardedConn) Close() error {
+	if c.closed.CompareAndSwap(false, true) {
+		c.g.conns.Add(-1)
+	}
+	return c.Conn.Close()
+}
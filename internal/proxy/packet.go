@@ -3,57 +3,148 @@ package proxy
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
+	"compress/zlib"
+	"errors"
+	"fmt"
 	"io"
 )
 
+const (
+	// Upper bound of the packet length, the biggest 3 byte VarInt
+	MaxPacketLen = 1<<21 - 1
+	// Upper bound of the uncompressed data length of compressed packets
+	MaxUncompressedLen = 1 << 23
+
+	// Compression is disabled until the server sends Set Compression
+	CompressionDisabled = -1
+)
+
+// ProtocolNetworkNBT is the protocol version of 1.20.2, since then the
+// nbt in the packets has no root name.
+const ProtocolNetworkNBT = 764
+
 type Packet struct {
 	ID   int32
 	Data []byte
 }
 
+// WritePacket writes the packet without compression.
 func WritePacket(w io.Writer, p Packet) error {
-	idb := binary.AppendVarint(nil, int64(p.ID))
+	return WriteCompressedPacket(w, p, CompressionDisabled)
+}
+
+// ReadPacket reads a packet without compression.
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	return ReadCompressedPacket(r, CompressionDisabled)
+}
+
+// WriteCompressedPacket writes the packet in the compressed format if
+// threshold is not negative, compressing it if its size is at least
+// the threshold.
+func WriteCompressedPacket(w io.Writer, p Packet, threshold int) error {
+	size := VarIntLen(p.ID) + len(p.Data)
 
-	totalLen := binary.AppendVarint(nil, int64(len(idb)+len(p.Data)))
+	body := make([]byte, 0, size+MaxVarIntLen)
+	if threshold < 0 {
+		body = AppendVarInt(body, p.ID)
+		body = append(body, p.Data...)
+	} else if size < threshold {
+		// A data length of zero marks uncompressed packets
+		body = append(body, 0)
+		body = AppendVarInt(body, p.ID)
+		body = append(body, p.Data...)
+	} else {
+		if size > MaxUncompressedLen {
+			return fmt.Errorf("proxy: packet of %d bytes is too big", size)
+		}
 
-	buf := bytes.NewBuffer(make([]byte, 0, len(totalLen)+len(idb)+len(p.Data)))
-	buf.Write(totalLen)
-	buf.Write(idb)
-	buf.Write(p.Data)
+		buf := bytes.NewBuffer(AppendVarInt(body, int32(size)))
+		zw := zlib.NewWriter(buf)
+		zw.Write(AppendVarInt(make([]byte, 0, MaxVarIntLen), p.ID))
+		zw.Write(p.Data)
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	if len(body) > MaxPacketLen {
+		return fmt.Errorf("proxy: packet of %d bytes is too big", len(body))
+	}
 
-	_, err := w.Write(buf.Bytes())
+	b := AppendVarInt(make([]byte, 0, MaxVarIntLen+len(body)), int32(len(body)))
+	_, err := w.Write(append(b, body...))
 	return err
 }
 
-func ReadPacket(r *bufio.Reader) (Packet, error) {
-	size, err := binary.ReadVarint(r)
+// ReadCompressedPacket reads a packet in the compressed format if
+// threshold is not negative.
+func ReadCompressedPacket(r *bufio.Reader, threshold int) (Packet, error) {
+	size, err := ReadVarInt(r)
 	if err != nil {
 		return Packet{}, err
 	}
+	if size <= 0 || size > MaxPacketLen {
+		return Packet{}, fmt.Errorf("proxy: invalid packet length %d", size)
+	}
 
-	packedId, err := binary.ReadVarint(r)
-	if err != nil {
+	body := make([]byte, size)
+	if _, err = io.ReadFull(r, body); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
 		return Packet{}, err
 	}
 
-	dataLen := int(size) - len(binary.AppendVarint(nil, packedId))
+	if threshold >= 0 {
+		if body, err = decompressPacket(body, threshold); err != nil {
+			return Packet{}, err
+		}
+	}
+
+	br := bytes.NewReader(body)
+	id, err := ReadVarInt(br)
+	if err != nil {
+		return Packet{}, errors.Join(errors.New("proxy: invalid packet id"), err)
+	}
+
+	return Packet{
+		ID:   id,
+		Data: body[len(body)-br.Len():],
+	}, nil
+}
+
+func decompressPacket(body []byte, threshold int) ([]byte, error) {
+	br := bytes.NewReader(body)
+
+	dataLen, err := ReadVarInt(br)
+	if err != nil {
+		return nil, err
+	}
+
+	rest := body[len(body)-br.Len():]
 	if dataLen == 0 {
-		return Packet{ID: int32(packedId)}, nil
+		return rest, nil
 	}
 
-	data := make([]byte, dataLen)
-	n, err := r.Read(data)
+	if int(dataLen) < threshold || dataLen > MaxUncompressedLen {
+		return nil, fmt.Errorf("proxy: invalid uncompressed length %d", dataLen)
+	}
+
+	zr, err := zlib.NewReader(bytes.NewReader(rest))
 	if err != nil {
-		return Packet{}, err
+		return nil, err
 	}
+	defer zr.Close()
 
-	if n != dataLen {
-		return Packet{}, io.ErrUnexpectedEOF
+	data := make([]byte, dataLen)
+	if _, err = io.ReadFull(zr, data); err != nil {
+		return nil, err
 	}
 
-	return Packet{
-		ID:   int32(packedId),
-		Data: data,
-	}, nil
+	// The declared length must match the actual one
+	if n, _ := zr.Read(make([]byte, 1)); n != 0 {
+		return nil, fmt.Errorf("proxy: uncompressed length mismatch")
+	}
+	return data, nil
 }
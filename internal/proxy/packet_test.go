@@ -0,0 +1,343 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"encoding/json"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var notchUUID = uuid.MustParse("069a79f4-44e9-4726-a5be-fca90e38aaf5")
+
+type goldenPacket struct {
+	file string
+	id   int32
+	// decodes into a zero value of the same type
+	new   func() Decodable
+	value Encodable
+}
+
+func goldenPackets() []goldenPacket {
+	statusRes := &ClientBoundStatusRes{
+		Description:       json.RawMessage(`{"text":"A Minecraft Server"}`),
+		EnforceSecureChat: true,
+	}
+	statusRes.Version.Name = "1.21.4"
+	statusRes.Version.Protocol = 769
+	statusRes.Players.Max = 20
+	statusRes.Players.Online = 1
+	statusRes.Players.Sample = []StatusPlayerSample{{ID: notchUUID, Name: "Notch"}}
+
+	return []goldenPacket{
+		{
+			file: "handshake_status.bin",
+			id:   ServerBoundHandshakingID,
+			new:  func() Decodable { return &ServerBoundHandshaking{} },
+			value: &ServerBoundHandshaking{
+				ProtocolVersion: 769,
+				ServerAddress:   "localhost",
+				ServerPort:      25565,
+				Intent:          HandshakingIntentStatus,
+			},
+		},
+		{
+			file: "handshake_login.bin",
+			id:   ServerBoundHandshakingID,
+			new:  func() Decodable { return &ServerBoundHandshaking{} },
+			value: &ServerBoundHandshaking{
+				ProtocolVersion: 769,
+				ServerAddress:   "mc.example.com",
+				ServerPort:      25565,
+				Intent:          HandshakingIntentLogin,
+			},
+		},
+		{
+			file:  "status_request.bin",
+			id:    ServerBoundStatusReqID,
+			new:   func() Decodable { return &ServerBoundStatusReq{} },
+			value: &ServerBoundStatusReq{},
+		},
+		{
+			file:  "status_response.bin",
+			id:    ClientBoundStatusResID,
+			new:   func() Decodable { return &ClientBoundStatusRes{} },
+			value: statusRes,
+		},
+		{
+			file: "login_start_769.bin",
+			id:   ServerBoundLoginStartID,
+			new:  func() Decodable { return &ServerBoundLoginStart{ProtocolVersion: 769} },
+			value: &ServerBoundLoginStart{
+				ProtocolVersion: 769,
+				Name:            "Notch",
+				UUID:            notchUUID,
+			},
+		},
+		{
+			file: "login_start_760.bin",
+			id:   ServerBoundLoginStartID,
+			new:  func() Decodable { return &ServerBoundLoginStart{ProtocolVersion: 760} },
+			value: &ServerBoundLoginStart{
+				ProtocolVersion: 760,
+				Name:            "Notch",
+				UUID:            notchUUID,
+			},
+		},
+		{
+			file: "login_start_758.bin",
+			id:   ServerBoundLoginStartID,
+			new:  func() Decodable { return &ServerBoundLoginStart{ProtocolVersion: 758} },
+			value: &ServerBoundLoginStart{
+				ProtocolVersion: 758,
+				Name:            "Notch",
+			},
+		},
+		{
+			file: "ping_request.bin",
+			id:   ServerBoundStatusPingReqID,
+			new:  func() Decodable { return &ServerBoundStatusPingReq{} },
+			value: &ServerBoundStatusPingReq{
+				Timestamp: time.UnixMilli(1700000000000),
+			},
+		},
+		{
+			file: "pong_response.bin",
+			id:   ClientBoundStatusPongResID,
+			new:  func() Decodable { return &ClientBoundStatusPongRes{} },
+			value: &ClientBoundStatusPongRes{
+				Timestamp: time.UnixMilli(1700000000000),
+			},
+		},
+	}
+}
+
+func readGolden(t testing.TB, name string) []byte {
+	b, err := os.ReadFile(path.Join("testdata", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestGoldenPacketsDecode(t *testing.T) {
+	for _, tc := range goldenPackets() {
+		t.Run(tc.file, func(t *testing.T) {
+			b := readGolden(t, tc.file)
+			r := bufio.NewReader(bytes.NewReader(b))
+
+			p, err := ReadPacket(r)
+			if err != nil {
+				t.Fatalf("read packet: %v", err)
+			}
+			if r.Buffered() != 0 {
+				t.Fatalf("%d bytes left after the packet", r.Buffered())
+			}
+			if p.ID != tc.id {
+				t.Fatalf("packet id = 0x%02x, want 0x%02x", p.ID, tc.id)
+			}
+
+			v := tc.new()
+			d := NewDecoder(p.Data)
+			if err = v.DecodeMCP(d); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if d.Len() != 0 {
+				t.Fatalf("%d bytes left after decoding", d.Len())
+			}
+
+			if !reflect.DeepEqual(v, tc.value) {
+				t.Fatalf("decoded %+v, want %+v", v, tc.value)
+			}
+		})
+	}
+}
+
+func TestGoldenPacketsEncode(t *testing.T) {
+	for _, tc := range goldenPackets() {
+		t.Run(tc.file, func(t *testing.T) {
+			data, err := EncodeMessage(tc.value)
+			if err != nil {
+				t.Fatalf("encode: %v", err)
+			}
+
+			var buf bytes.Buffer
+			if err = WritePacket(&buf, Packet{ID: tc.id, Data: data}); err != nil {
+				t.Fatalf("write packet: %v", err)
+			}
+
+			if want := readGolden(t, tc.file); !bytes.Equal(buf.Bytes(), want) {
+				t.Fatalf("encoded\n%x\nwant\n%x", buf.Bytes(), want)
+			}
+		})
+	}
+}
+
+func FuzzReadPacket(f *testing.F) {
+	for _, tc := range goldenPackets() {
+		f.Add(readGolden(f, tc.file))
+	}
+	// Overlong length prefix
+	f.Add([]byte{0x81, 0x00, 0x00})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r := bufio.NewReader(bytes.NewReader(b))
+
+		p, err := ReadPacket(r)
+		if err != nil {
+			return
+		}
+		n := len(b) - r.Buffered()
+
+		var buf bytes.Buffer
+		if err = WritePacket(&buf, p); err != nil {
+			t.Fatalf("write packet: %v", err)
+		}
+		encoded := buf.Bytes()
+
+		// The overlong VarInts are accepted but never written, so
+		// only the encodings of the same length must match
+		if len(encoded) == n && !bytes.Equal(encoded, b[:n]) {
+			t.Fatalf("encoded\n%x\nwant\n%x", encoded, b[:n])
+		}
+		if len(encoded) > n {
+			t.Fatalf("encoded %d bytes, read %d", len(encoded), n)
+		}
+
+		p2, err := ReadPacket(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil {
+			t.Fatalf("read encoded packet: %v", err)
+		}
+		if p2.ID != p.ID || !bytes.Equal(p2.Data, p.Data) {
+			t.Fatalf("read %+v, want %+v", p2, p)
+		}
+	})
+}
+
+const testThreshold = 256
+
+func TestCompressedPacketThreshold(t *testing.T) {
+	// The id takes one byte of the size
+	sizes := []int{0, testThreshold - 2, testThreshold - 1, testThreshold, 4096, MaxPacketLen * 2}
+
+	for _, n := range sizes {
+		p := Packet{ID: 0x27, Data: bytes.Repeat([]byte("minecraft"), n/9+1)[:n]}
+		compressed := 1+n >= testThreshold
+
+		var buf bytes.Buffer
+		if err := WriteCompressedPacket(&buf, p, testThreshold); err != nil {
+			t.Fatalf("write %d bytes: %v", n, err)
+		}
+
+		r := bufio.NewReader(bytes.NewReader(buf.Bytes()))
+		if _, err := ReadVarInt(r); err != nil {
+			t.Fatalf("read length: %v", err)
+		}
+		dataLen, err := ReadVarInt(r)
+		if err != nil {
+			t.Fatalf("read data length: %v", err)
+		}
+		if compressed && int(dataLen) != 1+n {
+			t.Fatalf("%d bytes: data length = %d, want %d", n, dataLen, 1+n)
+		}
+		if !compressed && dataLen != 0 {
+			t.Fatalf("%d bytes: data length = %d, want 0", n, dataLen)
+		}
+
+		p2, err := ReadCompressedPacket(bufio.NewReader(&buf), testThreshold)
+		if err != nil {
+			t.Fatalf("read %d bytes: %v", n, err)
+		}
+		if p2.ID != p.ID || !bytes.Equal(p2.Data, p.Data) {
+			t.Fatalf("%d bytes: read a different packet", n)
+		}
+	}
+}
+
+// compressed returns the body of a compressed packet with the declared
+// data length.
+func compressed(t testing.TB, dataLen int32, data []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(AppendVarInt(nil, dataLen))
+
+	zw := zlib.NewWriter(&buf)
+	if _, err := zw.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecompressPacketInvalid(t *testing.T) {
+	data := append([]byte{0x27}, make([]byte, testThreshold)...)
+
+	tests := map[string][]byte{
+		"below threshold":      compressed(t, testThreshold-1, data[:testThreshold-1]),
+		"shorter than data":    compressed(t, int32(len(data)-1), data),
+		"longer than data":     compressed(t, int32(len(data)+1), data),
+		"too big":              compressed(t, MaxUncompressedLen+1, data),
+		"negative data length": compressed(t, -1, data),
+		"not zlib":             append(AppendVarInt(nil, int32(len(data))), data...),
+		"empty":                {},
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := decompressPacket(body, testThreshold); err == nil {
+				t.Fatal("decompressed an invalid packet")
+			}
+		})
+	}
+
+	body, err := decompressPacket(compressed(t, int32(len(data)), data), testThreshold)
+	if err != nil {
+		t.Fatalf("decompress: %v", err)
+	}
+	if !bytes.Equal(body, data) {
+		t.Fatal("decompressed a different body")
+	}
+}
+
+func FuzzReadCompressedPacket(f *testing.F) {
+	for _, n := range []int{0, testThreshold - 2, testThreshold - 1, 4096} {
+		var buf bytes.Buffer
+		p := Packet{ID: 0x27, Data: make([]byte, n)}
+		if err := WriteCompressedPacket(&buf, p, testThreshold); err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf.Bytes(), testThreshold)
+	}
+	f.Add(readGolden(f, "handshake_status.bin"), CompressionDisabled)
+	f.Add(readGolden(f, "status_response.bin"), 0)
+
+	f.Fuzz(func(t *testing.T, b []byte, threshold int) {
+		threshold = max(threshold%MaxPacketLen, CompressionDisabled)
+
+		p, err := ReadCompressedPacket(bufio.NewReader(bytes.NewReader(b)), threshold)
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		if err = WriteCompressedPacket(&buf, p, threshold); err != nil {
+			// The compressed packets may grow past the limit
+			return
+		}
+
+		p2, err := ReadCompressedPacket(bufio.NewReader(&buf), threshold)
+		if err != nil {
+			t.Fatalf("read encoded packet: %v", err)
+		}
+		if p2.ID != p.ID || !bytes.Equal(p2.Data, p.Data) {
+			t.Fatalf("read %+v, want %+v", p2, p)
+		}
+	})
+}
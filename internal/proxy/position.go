@@ -0,0 +1,31 @@
+package proxy
+
+import "fmt"
+
+// Position is a block position, packed in a single long in the
+// format used since 1.14: x (26 bits), z (26 bits) and y (12 bits).
+type Position struct {
+	X, Y, Z int32
+}
+
+func (p Position) pack() (uint64, error) {
+	if p.X < -1<<25 || p.X >= 1<<25 ||
+		p.Z < -1<<25 || p.Z >= 1<<25 ||
+		p.Y < -1<<11 || p.Y >= 1<<11 {
+		return 0, fmt.Errorf("proxy: position %v out of range", p)
+	}
+
+	return uint64(p.X&0x3ffffff)<<38 |
+		uint64(p.Z&0x3ffffff)<<12 |
+		uint64(p.Y&0xfff), nil
+}
+
+func unpackPosition(v uint64) Position {
+	// The arithmetic shifts extend the sign of each field
+	n := int64(v)
+	return Position{
+		X: int32(n >> 38),
+		Y: int32(n << 52 >> 52),
+		Z: int32(n << 26 >> 38),
+	}
+}
@@ -0,0 +1,94 @@
+package proxy
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestPositionSample(t *testing.T) {
+	// The example of the protocol documentation
+	const packed = 0x4607632c15b4833f
+	want := Position{X: 18357644, Y: 831, Z: -20882616}
+
+	if p := unpackPosition(packed); p != want {
+		t.Fatalf("unpackPosition(%#x) = %+v, want %+v", uint64(packed), p, want)
+	}
+
+	v, err := want.pack()
+	if err != nil {
+		t.Fatalf("pack: %v", err)
+	}
+	if v != packed {
+		t.Fatalf("pack() = %#x, want %#x", v, uint64(packed))
+	}
+}
+
+func TestPositionRange(t *testing.T) {
+	valid := []Position{
+		{},
+		{X: -1, Y: -1, Z: -1},
+		{X: 1<<25 - 1, Y: 1<<11 - 1, Z: 1<<25 - 1},
+		{X: -1 << 25, Y: -1 << 11, Z: -1 << 25},
+		// The world limits
+		{X: 30_000_000, Y: 319, Z: -30_000_000},
+		{X: -30_000_000, Y: -64, Z: 30_000_000},
+	}
+	for _, p := range valid {
+		v, err := p.pack()
+		if err != nil {
+			t.Errorf("pack %+v: %v", p, err)
+			continue
+		}
+		if p2 := unpackPosition(v); p2 != p {
+			t.Errorf("unpackPosition(pack(%+v)) = %+v", p, p2)
+		}
+	}
+
+	invalid := []Position{
+		{X: 1 << 25},
+		{X: -1<<25 - 1},
+		{Z: 1 << 25},
+		{Z: -1<<25 - 1},
+		{Y: 1 << 11},
+		{Y: -1<<11 - 1},
+	}
+	for _, p := range invalid {
+		if _, err := p.pack(); err == nil {
+			t.Errorf("packed the out of range %+v", p)
+		}
+	}
+}
+
+func FuzzPosition(f *testing.F) {
+	f.Add(uint64(0x4607632c15b4833f))
+	f.Add(uint64(0))
+	f.Add(^uint64(0))
+
+	f.Fuzz(func(t *testing.T, v uint64) {
+		// Every bit belongs to a field, so all values round trip
+		p := unpackPosition(v)
+		v2, err := p.pack()
+		if err != nil {
+			t.Fatalf("pack %+v: %v", p, err)
+		}
+		if v2 != v {
+			t.Fatalf("pack(unpackPosition(%#x)) = %#x", v, v2)
+		}
+
+		e := NewEncoder()
+		if err = e.WritePosition(p); err != nil {
+			t.Fatalf("write %+v: %v", p, err)
+		}
+		if b := e.Bytes(); binary.BigEndian.Uint64(b) != v {
+			t.Fatalf("wrote %x, want %#x", b, v)
+		}
+
+		p2, err := NewDecoder(e.Bytes()).ReadPosition()
+		if err != nil {
+			t.Fatalf("read %+v: %v", p, err)
+		}
+		if p2 != p {
+			t.Fatalf("read %+v, want %+v", p2, p)
+		}
+	})
+}
@@ -2,16 +2,29 @@ package proxy
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net"
 	"sync/atomic"
+	"time"
 
 	"github.com/zanz1n/mc-manager/internal/dto"
 )
 
+var (
+	ErrLoginRejected    = errors.New("proxy: login rejected")
+	ErrTransferRejected = errors.New("proxy: transfers are not accepted")
+)
+
+// LoginFilter decides if the player can join the server, returning
+// the disconnect message if it can not.
+type LoginFilter func(login ServerBoundLoginStart, addr net.Addr) (Component, bool)
+
 type Proxy struct {
 	Players    atomic.Int32
 	MaxPlayers int32
@@ -21,20 +34,30 @@ type Proxy struct {
 	version           string
 	protocolVersion   int32
 	description       json.RawMessage
-	favIcon           string
+	offlineMOTD       json.RawMessage
+	favIcon           atomic.Pointer[string]
 	enforceSecureChat bool
 
 	endpoint   net.TCPAddr
 	launched   atomic.Bool
 	loadedData atomic.Bool
 
-	ln *net.TCPListener
+	inbound         Inbound
+	proxyProtocol   bool
+	loginFilter     LoginFilter
+	acceptTransfers bool
+
+	stats proxyStats
+
+	ln     *net.TCPListener
+	router atomic.Pointer[Router]
 }
 
 func New(
 	maxPlayers int32,
 	id dto.Snowflake,
 	endpoint net.TCPAddr,
+	inbound Inbound,
 ) (*Proxy, error) {
 	ln, err := net.ListenTCP("tcp", &net.TCPAddr{
 		IP:   net.IPv4(0, 0, 0, 0),
@@ -48,28 +71,72 @@ func New(
 		MaxPlayers: maxPlayers,
 		id:         id,
 		endpoint:   endpoint,
+		inbound:    inbound,
 		ln:         ln,
 	}, nil
 }
 
 func (p *Proxy) LoadServerData() error {
-	data, err := getServerInfo(&p.endpoint)
+	data, err := getServerInfo(&p.endpoint, p.proxyProtocol, offlineTimeout)
 	if err != nil {
 		return err
 	}
 
-	p.loadedData.Store(true)
-
 	p.version = data.Version.Name
 	p.protocolVersion = data.Version.Protocol
 	p.description = data.Description
-	p.favIcon = data.FavIcon
+	// The icon set by the manager is kept if the server has none
+	if data.FavIcon != "" {
+		p.SetFavIcon(data.FavIcon)
+	}
 	p.enforceSecureChat = data.EnforceSecureChat
 
+	// Published after the fields are set
+	p.loadedData.Store(true)
 	return nil
 }
 
+// SetOfflineMOTD sets the description returned in the status responses
+// while the server is not ready, it must be called before Launch.
+func (p *Proxy) SetOfflineMOTD(c Component) {
+	p.offlineMOTD = c.JSON()
+}
+
+// SetProxyProtocol makes the proxy send the PROXY protocol header
+// with the address of the client to the server, it must be called
+// before Launch.
+func (p *Proxy) SetProxyProtocol(enabled bool) {
+	p.proxyProtocol = enabled
+}
+
+// SetLoginFilter sets the filter of the players, checked before the
+// connection is forwarded to the server. It must be called before
+// Launch.
+func (p *Proxy) SetLoginFilter(f LoginFilter) {
+	p.loginFilter = f
+}
+
+// SetAcceptTransfers makes the proxy accept the players transferred
+// by other servers, the others are disconnected before reaching the
+// server. It must be called before Launch.
+func (p *Proxy) SetAcceptTransfers(accept bool) {
+	p.acceptTransfers = accept
+}
+
+// SetFavIcon sets the icon returned in the status responses, encoded
+// as a base64 png data uri.
+func (p *Proxy) SetFavIcon(icon string) {
+	p.favIcon.Store(&icon)
+}
+
+func (p *Proxy) Stats() Stats {
+	return p.stats.load()
+}
+
 func (p *Proxy) Close() error {
+	if r := p.router.Load(); r != nil {
+		r.Remove(p)
+	}
 	return p.ln.Close()
 }
 
@@ -97,95 +164,270 @@ func (p *Proxy) Launch() {
 			break
 		}
 
-		go func() {
-			var err error
-			if p.Active.Load() {
-				err = p.handleOnline(conn)
-			} else {
-				err = p.handleOffline(conn)
-			}
-			if err != nil {
-				slog.Warn(
-					"Proxy: Failed to handle conn",
-					"addr", conn.RemoteAddr(),
-					"error", err,
-				)
-			}
-		}()
+		go p.accept(conn)
+	}
+}
+
+func (p *Proxy) accept(conn net.Conn) {
+	c, err := p.inbound.accept(conn)
+	if err != nil {
+		conn.Close()
+		slog.Log(
+			context.Background(),
+			logLevel(err),
+			"Proxy: Failed to accept conn",
+			"id", p.id,
+			"addr", conn.RemoteAddr(),
+			"error", err,
+		)
+		return
 	}
+	p.serve(c)
 }
 
-func (p *Proxy) handleOnline(conn *net.TCPConn) error {
+// serve handles the connection, which may already have been
+// accepted by the router.
+func (p *Proxy) serve(conn net.Conn) {
+	p.stats.conns.Add(1)
+	defer p.stats.conns.Add(-1)
+
+	var err error
+	if p.Active.Load() {
+		err = p.handleOnline(conn)
+	} else {
+		err = p.handleOffline(conn)
+	}
+	if err != nil {
+		slog.Log(
+			context.Background(),
+			logLevel(err),
+			"Proxy: Failed to handle conn",
+			"id", p.id,
+			"addr", conn.RemoteAddr(),
+			"error", err,
+		)
+	}
+}
+
+func (p *Proxy) handleOnline(conn net.Conn) error {
 	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(p.inbound.Guard.handshakeTimeout()))
+
+	bufread := bufio.NewReader(conn)
+
+	// The handshake is read to be checked, and then sent to the
+	// server with the rest. The legacy ping is forwarded as is
+	var prefix bytes.Buffer
+	first, err := bufread.Peek(1)
+	if err != nil {
+		return err
+	}
+	if first[0] != legacyPingID {
+		packet, handshake, err := readHandshake(bufread)
+		if err != nil {
+			return err
+		}
+		p.stats.handshake(handshake)
+
+		if err = p.allowHandshake(conn, handshake); err != nil {
+			return err
+		}
+		if err = p.allowTransfer(conn, handshake); err != nil {
+			return err
+		}
+		if err = WritePacket(&prefix, packet); err != nil {
+			return err
+		}
+
+		if handshake.Intent != HandshakingIntentStatus && p.loginFilter != nil {
+			login, err := p.checkLogin(conn, bufread, handshake)
+			if err != nil {
+				return err
+			}
+			if err = WritePacket(&prefix, login); err != nil {
+				return err
+			}
+		}
+	}
+	conn.SetReadDeadline(time.Time{})
 
 	serverConn, err := net.DialTCP("tcp", nil, &p.endpoint)
 	if err != nil {
+		p.stats.failedDials.Add(1)
 		return err
 	}
 	defer serverConn.Close()
 
-	go io.Copy(conn, serverConn)
-	_, err = io.Copy(serverConn, conn)
+	if p.proxyProtocol {
+		err = WriteProxyHeader(serverConn, conn.RemoteAddr(), conn.LocalAddr())
+		if err != nil {
+			return err
+		}
+	}
+
+	toServer := countingWriter{w: serverConn, n: &p.stats.bytesIn}
+	toClient := countingWriter{w: conn, n: &p.stats.bytesOut}
+
+	if _, err = prefix.WriteTo(toServer); err != nil {
+		return err
+	}
+
+	go io.Copy(toClient, serverConn)
+	_, err = io.Copy(toServer, bufread)
 	return err
 }
 
-func (p *Proxy) handleOffline(conn *net.TCPConn) error {
+func (p *Proxy) handleOffline(conn net.Conn) error {
 	defer conn.Close()
-	if !p.loadedData.Load() {
-		return errors.New("server data not loaded yet")
-	}
+	conn.SetDeadline(time.Now().Add(offlineTimeout))
+	conn.SetReadDeadline(time.Now().Add(p.inbound.Guard.handshakeTimeout()))
 
 	bufread := bufio.NewReader(conn)
 
-	packet, err := ReadPacket(bufread)
+	// Clients older than 1.7 send the legacy server list ping
+	first, err := bufread.Peek(1)
 	if err != nil {
 		return err
 	}
+	if first[0] == legacyPingID {
+		return p.handleLegacyPing(conn, bufread)
+	}
 
-	var handshake ServerBoundHandshaking
-	err = handshake.DecodeMCP(NewDecoder(packet.Data))
+	_, handshake, err := readHandshake(bufread)
 	if err != nil {
 		return err
 	}
+	p.stats.handshake(handshake)
+
+	if err = p.allowHandshake(conn, handshake); err != nil {
+		return err
+	}
+	if err = p.allowTransfer(conn, handshake); err != nil {
+		return err
+	}
+	conn.SetReadDeadline(time.Now().Add(offlineTimeout))
 
 	if handshake.Intent == HandshakingIntentStatus {
-		var status ClientBoundStatusRes
-		status.Version.Name = p.version
-		status.Version.Protocol = p.protocolVersion
-		status.Players.Max = p.MaxPlayers
-		status.Players.Online = 0
-		status.Description = p.description
-		status.FavIcon = p.favIcon
-		status.EnforceSecureChat = p.enforceSecureChat
-
-		data, err := EncodeMessage(&status)
-		if err != nil {
-			return err
-		}
+		return p.handleStatus(conn, bufread, handshake.ProtocolVersion)
+	}
 
-		err = WritePacket(conn, Packet{
-			ID:   ClientBoundStatusResID,
-			Data: data,
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		data, err := EncodeMessage(&ClientBoundLoginDisconect{
-			Message: []byte(`{"text":"Starting server ..."}`),
-		})
-		if err != nil {
+	if p.loginFilter != nil {
+		if _, err = p.checkLogin(conn, bufread, handshake); err != nil {
 			return err
 		}
+	}
 
-		err = WritePacket(conn, Packet{
-			ID:   ClientBoundLoginDisconectID,
-			Data: data,
-		})
-		if err != nil {
-			return err
-		}
+	return writeDisconnect(conn, Text("Starting server ..."))
+}
+
+// checkLogin reads the Login Start packet and checks the player with
+// the login filter, disconnecting it if rejected. The packet is
+// returned to be forwarded.
+func (p *Proxy) checkLogin(
+	conn net.Conn,
+	r *bufio.Reader,
+	handshake ServerBoundHandshaking,
+) (Packet, error) {
+	packet, err := ReadPacket(r)
+	if err != nil {
+		return packet, err
 	}
 
-	return nil
+	if packet.ID != ServerBoundLoginStartID {
+		return packet, fmt.Errorf("expected login start, got packet 0x%02x", packet.ID)
+	}
+
+	login := ServerBoundLoginStart{ProtocolVersion: handshake.ProtocolVersion}
+	if err = login.DecodeMCP(NewDecoder(packet.Data)); err != nil {
+		return packet, err
+	}
+
+	if message, ok := p.loginFilter(login, conn.RemoteAddr()); !ok {
+		slog.Info(
+			"Proxy: Rejected login",
+			"id", p.id,
+			"name", login.Name,
+			"uuid", login.UUID,
+			"addr", conn.RemoteAddr(),
+		)
+		writeDisconnect(conn, message)
+		return packet, ErrLoginRejected
+	}
+
+	return packet, nil
+}
+
+// allowHandshake checks the handshake rate limit of the client,
+// disconnecting it with a message if it is trying to log in.
+func (p *Proxy) allowHandshake(conn net.Conn, handshake ServerBoundHandshaking) error {
+	if p.inbound.Guard.allowHandshake(conn.RemoteAddr()) {
+		return nil
+	}
+
+	if handshake.Intent != HandshakingIntentStatus {
+		message := Text("Too many connection attempts, try again later").
+			WithColor("red")
+		writeDisconnect(conn, message)
+	}
+	return ErrHandshakeThrottled
+}
+
+// allowTransfer disconnects the transferred players if the server
+// does not accept them, with the message of the vanilla server.
+func (p *Proxy) allowTransfer(conn net.Conn, handshake ServerBoundHandshaking) error {
+	if handshake.Intent != HandshakingIntentTransfer || p.acceptTransfers {
+		return nil
+	}
+
+	writeDisconnect(conn, Text("Server does not accept transfers"))
+	return ErrTransferRejected
+}
+
+func readHandshake(r *bufio.Reader) (Packet, ServerBoundHandshaking, error) {
+	var handshake ServerBoundHandshaking
+
+	packet, err := ReadPacket(r)
+	if err != nil {
+		return packet, handshake, err
+	}
+
+	if packet.ID != ServerBoundHandshakingID {
+		return packet, handshake, fmt.Errorf(
+			"expected handshake, got packet 0x%02x",
+			packet.ID,
+		)
+	}
+
+	err = handshake.DecodeMCP(NewDecoder(packet.Data))
+	return packet, handshake, err
+}
+
+// writeDisconnect sends the disconnect packet of the login state.
+func writeDisconnect(conn net.Conn, message Component) error {
+	data, err := EncodeMessage(&ClientBoundLoginDisconect{
+		Message: message.JSON(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return WritePacket(conn, Packet{
+		ID:   ClientBoundLoginDisconectID,
+		Data: data,
+	})
+}
+
+// logLevel returns the level of the connection errors, the ones
+// caused by the guard are frequent during floods and the rejected
+// logins are already logged.
+func logLevel(err error) slog.Level {
+	if errors.Is(err, ErrAddressBlocked) ||
+		errors.Is(err, ErrConnThrottled) ||
+		errors.Is(err, ErrTooManyConns) ||
+		errors.Is(err, ErrHandshakeThrottled) ||
+		errors.Is(err, ErrLoginRejected) ||
+		errors.Is(err, ErrTransferRejected) {
+		return slog.LevelDebug
+	}
+	return slog.LevelWarn
 }
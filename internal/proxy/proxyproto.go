@@ -0,0 +1,238 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+const (
+	proxyV2Version = 0x20
+	proxyV2Local   = 0x00
+	proxyV2Proxy   = 0x01
+
+	proxyV2TCP4 = 0x11
+	proxyV2TCP6 = 0x21
+
+	// Upper bound of the v1 header line, defined by the spec
+	maxProxyV1Len = 107
+)
+
+var ErrInvalidProxyHeader = errors.New("proxy: invalid PROXY protocol header")
+
+// Inbound configures the connections accepted by the listeners.
+type Inbound struct {
+	// Requires a PROXY protocol header in the connections, used when
+	// the node is behind a load balancer
+	ProxyProtocol bool
+	// The addresses the header is accepted from, when empty it is
+	// required from all of them
+	TrustedProxies []netip.Prefix
+	// Shared by all the listeners of the node, nil when the
+	// connections are not limited
+	Guard *Guard
+}
+
+// accept reads the PROXY protocol header if required, returning the
+// connection with the address of the client if it passes the guard.
+func (in *Inbound) accept(conn net.Conn) (net.Conn, error) {
+	conn, err := in.readProxyHeader(conn)
+	if err != nil {
+		return nil, err
+	}
+	return in.Guard.accept(conn)
+}
+
+func (in *Inbound) readProxyHeader(conn net.Conn) (net.Conn, error) {
+	if !in.ProxyProtocol || !in.trusted(conn.RemoteAddr()) {
+		return conn, nil
+	}
+
+	conn.SetReadDeadline(time.Now().Add(offlineTimeout))
+	defer conn.SetReadDeadline(time.Time{})
+
+	r := bufio.NewReader(conn)
+	src, err := ReadProxyHeader(r)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &bufferedConn{Conn: conn, r: r}
+	if src != nil {
+		c.remoteAddr = src
+	}
+	return c, nil
+}
+
+func (in *Inbound) trusted(addr net.Addr) bool {
+	if len(in.TrustedProxies) == 0 {
+		return true
+	}
+
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+	ip, _ := netip.AddrFromSlice(tcp.IP)
+
+	for _, prefix := range in.TrustedProxies {
+		if prefix.Contains(ip.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteProxyHeader writes a PROXY protocol v2 header with the
+// addresses of the client connection.
+func WriteProxyHeader(w io.Writer, src, dst net.Addr) error {
+	srcTCP, ok1 := src.(*net.TCPAddr)
+	dstTCP, ok2 := dst.(*net.TCPAddr)
+
+	b := bytes.NewBuffer(make([]byte, 0, 52))
+	b.Write(proxyV2Signature)
+
+	// Unknown addresses are sent with the local command, so the
+	// backend uses the address of the connection
+	if !ok1 || !ok2 {
+		b.Write([]byte{proxyV2Version | proxyV2Local, 0, 0, 0})
+		_, err := w.Write(b.Bytes())
+		return err
+	}
+
+	b.WriteByte(proxyV2Version | proxyV2Proxy)
+
+	src4, dst4 := srcTCP.IP.To4(), dstTCP.IP.To4()
+	if src4 != nil && dst4 != nil {
+		b.Write([]byte{proxyV2TCP4, 0, 12})
+		b.Write(src4)
+		b.Write(dst4)
+	} else {
+		b.Write([]byte{proxyV2TCP6, 0, 36})
+		b.Write(srcTCP.IP.To16())
+		b.Write(dstTCP.IP.To16())
+	}
+
+	b.Write(binary.BigEndian.AppendUint16(nil, uint16(srcTCP.Port)))
+	b.Write(binary.BigEndian.AppendUint16(nil, uint16(dstTCP.Port)))
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// ReadProxyHeader reads a PROXY protocol v1 or v2 header, returning the
+// source address. The address is nil for the local command and for
+// unknown protocols, which must be handled with the connection address.
+func ReadProxyHeader(r *bufio.Reader) (net.Addr, error) {
+	sig, err := r.Peek(len(proxyV2Signature))
+	if err == nil && bytes.Equal(sig, proxyV2Signature) {
+		return readProxyHeaderV2(r)
+	}
+
+	prefix, err := r.Peek(6)
+	if err == nil && string(prefix) == "PROXY " {
+		return readProxyHeaderV1(r)
+	}
+
+	return nil, ErrInvalidProxyHeader
+}
+
+func readProxyHeaderV2(r *bufio.Reader) (net.Addr, error) {
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	verCmd, fam := header[12], header[13]
+	size := binary.BigEndian.Uint16(header[14:])
+
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+
+	if verCmd&0xf0 != proxyV2Version {
+		return nil, errors.Join(ErrInvalidProxyHeader, errors.New("unsupported version"))
+	}
+
+	switch verCmd & 0x0f {
+	case proxyV2Local:
+		return nil, nil
+	case proxyV2Proxy:
+	default:
+		return nil, errors.Join(ErrInvalidProxyHeader, errors.New("invalid command"))
+	}
+
+	switch fam {
+	case proxyV2TCP4:
+		if len(body) < 12 {
+			return nil, ErrInvalidProxyHeader
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(body[0:4]),
+			Port: int(binary.BigEndian.Uint16(body[8:10])),
+		}, nil
+
+	case proxyV2TCP6:
+		if len(body) < 36 {
+			return nil, ErrInvalidProxyHeader
+		}
+		return &net.TCPAddr{
+			IP:   net.IP(body[0:16]),
+			Port: int(binary.BigEndian.Uint16(body[32:34])),
+		}, nil
+	}
+
+	// Other families (udp, unix) are ignored
+	return nil, nil
+}
+
+func readProxyHeaderV1(r *bufio.Reader) (net.Addr, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if line = append(line, b); len(line) > maxProxyV1Len {
+			return nil, errors.Join(ErrInvalidProxyHeader, errors.New("line too long"))
+		}
+		if b == '\n' {
+			break
+		}
+	}
+
+	s, ok := strings.CutSuffix(string(line), "\r\n")
+	if !ok {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	fields := strings.Split(s, " ")
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return nil, nil
+	}
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return nil, ErrInvalidProxyHeader
+	}
+
+	ip := net.ParseIP(fields[2])
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if ip == nil || err != nil {
+		return nil, errors.Join(
+			ErrInvalidProxyHeader,
+			fmt.Errorf("invalid source address %s:%s", fields[2], fields[4]),
+		)
+	}
+
+	return &net.TCPAddr{IP: ip, Port: int(port)}, nil
+}
@@ -0,0 +1,250 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The query protocol (GameSpy4) is served over udp by the server when
+// enable-query is set.
+
+const (
+	queryTypeHandshake = 0x09
+	queryTypeStat      = 0x00
+
+	// The session ids only use the lower 4 bits of each byte
+	querySessionMask = 0x0F0F0F0F
+)
+
+var (
+	queryMagic = []byte{0xFE, 0xFD}
+	// Sent before the key values and before the players in the full stat
+	queryFullStatPadding    = []byte("splitnum\x00\x80\x00")
+	queryFullPlayersPadding = []byte("\x01player_\x00\x00")
+)
+
+var ErrInvalidQueryResponse = errors.New("proxy: invalid query response")
+
+type QueryBasicStat struct {
+	MOTD       string
+	GameType   string
+	Map        string
+	NumPlayers int
+	MaxPlayers int
+	HostPort   uint16
+	HostIP     string
+}
+
+type QueryFullStat struct {
+	Hostname   string
+	GameType   string
+	GameID     string
+	Version    string
+	Map        string
+	NumPlayers int
+	MaxPlayers int
+	HostPort   uint16
+	HostIP     string
+
+	// The software of the server, e.g. "Paper on 1.21.4", empty
+	// in vanilla
+	ServerMod string
+	// Names and versions of the plugins, e.g. "LuckPerms 5.4.102"
+	Plugins []string
+	Players []string
+
+	// All the key values sent by the server
+	Values map[string]string
+}
+
+// QueryBasic requests the basic stat of the server.
+func QueryBasic(addr *net.UDPAddr, timeout time.Duration) (QueryBasicStat, error) {
+	var stat QueryBasicStat
+
+	b, err := queryStat(addr, timeout, false)
+	if err != nil {
+		return stat, err
+	}
+
+	r := bytes.NewBuffer(b)
+	fields := make([]string, 5)
+	for i := range fields {
+		if fields[i], err = readQueryString(r); err != nil {
+			return stat, err
+		}
+	}
+
+	stat.MOTD = fields[0]
+	stat.GameType = fields[1]
+	stat.Map = fields[2]
+	stat.NumPlayers, _ = strconv.Atoi(fields[3])
+	stat.MaxPlayers, _ = strconv.Atoi(fields[4])
+
+	// The only little endian field of the protocol
+	if r.Len() < 2 {
+		return stat, errors.Join(ErrInvalidQueryResponse, errors.New("missing host port"))
+	}
+	stat.HostPort = binary.LittleEndian.Uint16(r.Next(2))
+
+	stat.HostIP, err = readQueryString(r)
+	return stat, err
+}
+
+// QueryFull requests the full stat of the server, with the players
+// and plugins.
+func QueryFull(addr *net.UDPAddr, timeout time.Duration) (QueryFullStat, error) {
+	stat := QueryFullStat{Values: make(map[string]string)}
+
+	b, err := queryStat(addr, timeout, true)
+	if err != nil {
+		return stat, err
+	}
+
+	if !bytes.HasPrefix(b, queryFullStatPadding) {
+		return stat, errors.Join(ErrInvalidQueryResponse, errors.New("missing padding"))
+	}
+	r := bytes.NewBuffer(b[len(queryFullStatPadding):])
+
+	for {
+		key, err := readQueryString(r)
+		if err != nil {
+			return stat, err
+		}
+		if key == "" {
+			break
+		}
+
+		if stat.Values[key], err = readQueryString(r); err != nil {
+			return stat, err
+		}
+	}
+
+	stat.Hostname = stat.Values["hostname"]
+	stat.GameType = stat.Values["gametype"]
+	stat.GameID = stat.Values["game_id"]
+	stat.Version = stat.Values["version"]
+	stat.Map = stat.Values["map"]
+	stat.NumPlayers, _ = strconv.Atoi(stat.Values["numplayers"])
+	stat.MaxPlayers, _ = strconv.Atoi(stat.Values["maxplayers"])
+	stat.HostIP = stat.Values["hostip"]
+	if port, err := strconv.ParseUint(stat.Values["hostport"], 10, 16); err == nil {
+		stat.HostPort = uint16(port)
+	}
+	stat.ServerMod, stat.Plugins = parseQueryPlugins(stat.Values["plugins"])
+
+	if !bytes.HasPrefix(r.Bytes(), queryFullPlayersPadding) {
+		return stat, errors.Join(ErrInvalidQueryResponse, errors.New("missing players padding"))
+	}
+	r.Next(len(queryFullPlayersPadding))
+
+	stat.Players = []string{}
+	for {
+		name, err := readQueryString(r)
+		if err != nil {
+			return stat, err
+		}
+		if name == "" {
+			break
+		}
+		stat.Players = append(stat.Players, name)
+	}
+
+	return stat, nil
+}
+
+// parseQueryPlugins parses the plugins value in the bukkit format,
+// "<server mod>: <plugin>; <plugin>".
+func parseQueryPlugins(s string) (string, []string) {
+	mod, list, ok := strings.Cut(s, ":")
+	if !ok {
+		return strings.TrimSpace(s), nil
+	}
+
+	var plugins []string
+	for _, plugin := range strings.Split(list, ";") {
+		if plugin = strings.TrimSpace(plugin); plugin != "" {
+			plugins = append(plugins, plugin)
+		}
+	}
+	return strings.TrimSpace(mod), plugins
+}
+
+// queryStat does the handshake and requests the stat, returning the
+// payload of the response.
+func queryStat(addr *net.UDPAddr, timeout time.Duration, full bool) ([]byte, error) {
+	conn, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	session := rand.Int32() & querySessionMask
+
+	token, err := queryRequest(conn, queryTypeHandshake, session, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := strconv.ParseInt(string(bytes.TrimRight(token, "\x00")), 10, 32)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidQueryResponse, err)
+	}
+
+	payload := binary.BigEndian.AppendUint32(nil, uint32(challenge))
+	if full {
+		payload = append(payload, 0x00, 0x00, 0x00, 0x00)
+	}
+
+	return queryRequest(conn, queryTypeStat, session, payload)
+}
+
+func queryRequest(conn *net.UDPConn, kind byte, session int32, payload []byte) ([]byte, error) {
+	req := append([]byte{}, queryMagic...)
+	req = append(req, kind)
+	req = binary.BigEndian.AppendUint32(req, uint32(session))
+	req = append(req, payload...)
+
+	if _, err := conn.Write(req); err != nil {
+		return nil, err
+	}
+
+	b := make([]byte, maxDatagramSize)
+	n, err := conn.Read(b)
+	if err != nil {
+		return nil, err
+	}
+	b = b[:n]
+
+	if len(b) < 5 || b[0] != kind || int32(binary.BigEndian.Uint32(b[1:5])) != session {
+		return nil, errors.Join(
+			ErrInvalidQueryResponse,
+			fmt.Errorf("unexpected response to request 0x%02x", kind),
+		)
+	}
+	return b[5:], nil
+}
+
+func readQueryString(r *bytes.Buffer) (string, error) {
+	s, err := r.ReadString(0x00)
+	if err != nil {
+		return "", errors.Join(ErrInvalidQueryResponse, err)
+	}
+	return s[:len(s)-1], nil
+}
+
+// Query requests the full stat to the server, the query port must be
+// the same as the game one.
+func (p *Proxy) Query(timeout time.Duration) (QueryFullStat, error) {
+	return QueryFull(&net.UDPAddr{
+		IP:   p.endpoint.IP,
+		Port: p.endpoint.Port,
+	}, timeout)
+}
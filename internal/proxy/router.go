@@ -0,0 +1,273 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/zanz1n/mc-manager/internal/dto"
+)
+
+// DefaultRoute matches the connections without any other route.
+const DefaultRoute = "*"
+
+var domainRegex = regexp.MustCompile(
+	`^(\*|(\*\.)?[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)*)$`,
+)
+
+var ErrDomainInUse = errors.New("proxy: domain already in use")
+
+// Router is a listener shared by the instances of the node, routing the
+// connections to their proxies by the hostname sent in the handshake.
+type Router struct {
+	routes map[string]*Proxy
+	mu     sync.RWMutex
+
+	ln      *net.TCPListener
+	inbound Inbound
+}
+
+func NewRouter(addr net.TCPAddr, inbound Inbound) (*Router, error) {
+	ln, err := net.ListenTCP("tcp", &addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Router{
+		routes:  make(map[string]*Proxy),
+		ln:      ln,
+		inbound: inbound,
+	}, nil
+}
+
+func ValidateDomain(domain string) error {
+	if len(domain) > 253 || !domainRegex.MatchString(domain) {
+		return fmt.Errorf("invalid domain %q", domain)
+	}
+	return nil
+}
+
+// Check returns an error if any of the domains is invalid or routed
+// to the proxy of another instance.
+func (r *Router) Check(id dto.Snowflake, domains []string) error {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.check(id, domains)
+}
+
+// Add routes the domains to the proxy, which is removed from the
+// router when closed. Exact domains take precedence over the
+// wildcard ones (*.example.com), and the default route (*) is
+// used when nothing else matches.
+func (r *Router) Add(p *Proxy, domains []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.check(p.id, domains); err != nil {
+		return err
+	}
+
+	for _, domain := range domains {
+		r.routes[strings.ToLower(domain)] = p
+	}
+	p.router.Store(r)
+	return nil
+}
+
+func (r *Router) Remove(p *Proxy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for domain, route := range r.routes {
+		if route == p {
+			delete(r.routes, domain)
+		}
+	}
+}
+
+func (r *Router) check(id dto.Snowflake, domains []string) error {
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if err := ValidateDomain(domain); err != nil {
+			return err
+		}
+
+		if route, ok := r.routes[domain]; ok && route.id != id {
+			return errors.Join(ErrDomainInUse, errors.New(domain))
+		}
+	}
+	return nil
+}
+
+// lookup returns the proxy of the exact domain, of the most specific
+// wildcard domain, or the default one.
+func (r *Router) lookup(host string) (*Proxy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, ok := r.routes[host]; ok {
+		return p, true
+	}
+
+	for rest := host; ; {
+		_, after, ok := strings.Cut(rest, ".")
+		if !ok {
+			break
+		}
+		if p, ok := r.routes["*."+after]; ok {
+			return p, true
+		}
+		rest = after
+	}
+
+	p, ok := r.routes[DefaultRoute]
+	return p, ok
+}
+
+func (r *Router) Close() error {
+	return r.ln.Close()
+}
+
+func (r *Router) Launch() {
+	slog.Info("Router: Listening", "addr", r.ln.Addr())
+
+	for {
+		conn, err := r.ln.AcceptTCP()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				slog.Error("Router: Closed listener unexpectedly", "error", err)
+				r.ln.Close()
+			} else {
+				slog.Info("Router: Closed listener")
+			}
+			break
+		}
+
+		go func() {
+			if err := r.handle(conn); err != nil {
+				slog.Log(
+					context.Background(),
+					logLevel(err),
+					"Router: Failed to handle conn",
+					"addr", conn.RemoteAddr(),
+					"error", err,
+				)
+			}
+		}()
+	}
+}
+
+func (r *Router) handle(tcpConn net.Conn) error {
+	conn, err := r.inbound.accept(tcpConn)
+	if err != nil {
+		tcpConn.Close()
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(r.inbound.Guard.handshakeTimeout()))
+
+	bufread := bufio.NewReader(conn)
+
+	// The legacy ping has no hostname
+	first, err := bufread.Peek(1)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	if first[0] == legacyPingID {
+		p, ok := r.lookup(DefaultRoute)
+		if !ok {
+			conn.Close()
+			return nil
+		}
+
+		conn.SetDeadline(time.Time{})
+		p.serve(&bufferedConn{Conn: conn, r: bufread})
+		return nil
+	}
+
+	packet, handshake, err := readHandshake(bufread)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	p, ok := r.lookup(normalizeHost(handshake.ServerAddress))
+	if !ok {
+		defer conn.Close()
+		return writeUnknownServer(conn, bufread, handshake)
+	}
+
+	// The handshake is sent again to the proxy
+	var prefix bytes.Buffer
+	if err = WritePacket(&prefix, packet); err != nil {
+		conn.Close()
+		return err
+	}
+
+	conn.SetDeadline(time.Time{})
+	p.serve(&bufferedConn{
+		Conn: conn,
+		r:    io.MultiReader(&prefix, bufread),
+	})
+	return nil
+}
+
+func writeUnknownServer(conn net.Conn, r *bufio.Reader, handshake ServerBoundHandshaking) error {
+	message := Text("Unknown server").WithColor("red")
+
+	if handshake.Intent == HandshakingIntentStatus {
+		return serveStatus(conn, r, func() ClientBoundStatusRes {
+			var status ClientBoundStatusRes
+			status.Version.Name = "Unknown"
+			status.Version.Protocol = handshake.ProtocolVersion
+			status.Description = message.JSON()
+			return status
+		})
+	}
+
+	return writeDisconnect(conn, message)
+}
+
+// normalizeHost removes the data appended to the hostname by modded
+// clients and bungeecord ip forwarding, and the trailing dot of fully
+// qualified names.
+func normalizeHost(host string) string {
+	host, _, _ = strings.Cut(host, "\x00")
+	host = strings.TrimSuffix(host, ".")
+	return strings.ToLower(host)
+}
+
+var _ net.Conn = (*bufferedConn)(nil)
+
+// bufferedConn is a connection with data that was already read.
+type bufferedConn struct {
+	net.Conn
+	r io.Reader
+
+	// The address of the client, when the connection was accepted
+	// from a proxy
+	remoteAddr net.Addr
+}
+
+// Read implements net.Conn.
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// RemoteAddr implements net.Conn.
+func (c *bufferedConn) RemoteAddr() net.Addr {
+	if c.remoteAddr != nil {
+		return c.remoteAddr
+	}
+	return c.Conn.RemoteAddr()
+}
@@ -3,6 +3,8 @@ package proxy
 import (
 	"fmt"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 var _ Encodable = (HandshakingIntent)(0)
@@ -18,7 +20,7 @@ const (
 
 // EncodeMCP implements Encodable.
 func (h HandshakingIntent) EncodeMCP(e *Encoder) error {
-	return e.WriteVarInt(int64(h))
+	return e.WriteVarInt(int32(h))
 }
 
 // DecodeMCP implements Decodable.
@@ -54,7 +56,7 @@ type ServerBoundHandshaking struct {
 
 // EncodeMCP implements Encodable.
 func (p *ServerBoundHandshaking) EncodeMCP(e *Encoder) error {
-	err := e.WriteVarInt(int64(p.ProtocolVersion))
+	err := e.WriteVarInt(p.ProtocolVersion)
 	if err != nil {
 		return err
 	}
@@ -72,13 +74,13 @@ func (p *ServerBoundHandshaking) EncodeMCP(e *Encoder) error {
 
 // DecodeMCP implements Decodable.
 func (p *ServerBoundHandshaking) DecodeMCP(d *Decoder) error {
-	protocolVersion, err := d.ReadVarInt()
+	var err error
+	p.ProtocolVersion, err = d.ReadVarInt()
 	if err != nil {
 		return err
 	}
-	p.ProtocolVersion = int32(protocolVersion)
 
-	p.ServerAddress, err = d.ReadString()
+	p.ServerAddress, err = d.ReadStringMax(255)
 	if err != nil {
 		return err
 	}
@@ -132,3 +134,103 @@ func (p *ServerBoundStatusPingReq) DecodeMCP(d *Decoder) error {
 	p.Timestamp = time.UnixMilli(int64(unix))
 	return nil
 }
+
+// Protocol versions that changed the Login Start packet
+const (
+	// 1.19 added the chat signing key
+	protocolLoginSigData = 759
+	// 1.19.1 added the optional uuid
+	protocolLoginUUID = 760
+	// 1.19.3 removed the chat signing key
+	protocolLoginNoSigData = 761
+)
+
+var _ Encodable = (*ServerBoundLoginStart)(nil)
+var _ Decodable = (*ServerBoundLoginStart)(nil)
+
+const ServerBoundLoginStartID = 0x00
+
+// ServerBoundLoginStart is encoded in the format of ProtocolVersion,
+// which is not part of the packet. The chat signing key sent by
+// 1.19 to 1.19.2 is skipped.
+type ServerBoundLoginStart struct {
+	ProtocolVersion int32
+
+	Name string
+	// Nil when not sent, before 1.19.1 and optionally until 1.20.2
+	UUID uuid.UUID
+}
+
+// EncodeMCP implements Encodable.
+func (p *ServerBoundLoginStart) EncodeMCP(e *Encoder) error {
+	if err := e.WriteString(p.Name); err != nil {
+		return err
+	}
+
+	if p.ProtocolVersion >= protocolLoginSigData &&
+		p.ProtocolVersion < protocolLoginNoSigData {
+		if err := e.WriteBool(false); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case p.ProtocolVersion >= ProtocolNetworkNBT:
+		return e.WriteUUID(p.UUID)
+
+	case p.ProtocolVersion >= protocolLoginUUID:
+		if err := e.WriteBool(p.UUID != uuid.Nil); err != nil {
+			return err
+		}
+		if p.UUID != uuid.Nil {
+			return e.WriteUUID(p.UUID)
+		}
+	}
+
+	return nil
+}
+
+// DecodeMCP implements Decodable.
+func (p *ServerBoundLoginStart) DecodeMCP(d *Decoder) error {
+	var err error
+	p.Name, err = d.ReadStringMax(16)
+	if err != nil {
+		return err
+	}
+
+	if p.ProtocolVersion >= protocolLoginSigData &&
+		p.ProtocolVersion < protocolLoginNoSigData {
+		hasSigData, err := d.ReadBool()
+		if err != nil {
+			return err
+		}
+
+		if hasSigData {
+			if _, err = d.ReadUint64(); err != nil {
+				return err
+			}
+			if _, err = d.ReadBytes(); err != nil {
+				return err
+			}
+			if _, err = d.ReadBytes(); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch {
+	case p.ProtocolVersion >= ProtocolNetworkNBT:
+		p.UUID, err = d.ReadUUID()
+		return err
+
+	case p.ProtocolVersion >= protocolLoginUUID:
+		hasUUID, err := d.ReadBool()
+		if err != nil || !hasUUID {
+			return err
+		}
+		p.UUID, err = d.ReadUUID()
+		return err
+	}
+
+	return nil
+}
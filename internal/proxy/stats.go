@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Distinct handshakes counted by each proxy, the protocol version
+	// is sent by the clients and can be any value
+	maxHandshakeKeys = 64
+	// Groups the protocol versions received once the limit is reached
+	HandshakeOtherVersion int32 = -1
+)
+
+type HandshakeKey struct {
+	Intent          HandshakingIntent
+	ProtocolVersion int32
+}
+
+// Stats are the traffic counters of a proxy, since it was created.
+type Stats struct {
+	// Forwarded from the players to the server
+	BytesIn uint64
+	// Forwarded from the server to the players
+	BytesOut    uint64
+	Conns       int64
+	FailedDials uint64
+	Handshakes  map[HandshakeKey]uint64
+}
+
+type proxyStats struct {
+	bytesIn     atomic.Uint64
+	bytesOut    atomic.Uint64
+	conns       atomic.Int64
+	failedDials atomic.Uint64
+
+	handshakes map[HandshakeKey]uint64
+	mu         sync.Mutex
+}
+
+func (s *proxyStats) handshake(h ServerBoundHandshaking) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.handshakes == nil {
+		s.handshakes = make(map[HandshakeKey]uint64)
+	}
+
+	key := HandshakeKey{
+		Intent:          h.Intent,
+		ProtocolVersion: h.ProtocolVersion,
+	}
+	if _, ok := s.handshakes[key]; !ok && len(s.handshakes) >= maxHandshakeKeys {
+		key.ProtocolVersion = HandshakeOtherVersion
+	}
+	s.handshakes[key]++
+}
+
+func (s *proxyStats) load() Stats {
+	s.mu.Lock()
+	handshakes := make(map[HandshakeKey]uint64, len(s.handshakes))
+	for k, v := range s.handshakes {
+		handshakes[k] = v
+	}
+	s.mu.Unlock()
+
+	return Stats{
+		BytesIn:     s.bytesIn.Load(),
+		BytesOut:    s.bytesOut.Load(),
+		Conns:       s.conns.Load(),
+		FailedDials: s.failedDials.Load(),
+		Handshakes:  handshakes,
+	}
+}
+
+// countingWriter adds the written bytes to the counter as they are
+// written, so long connections are counted before they end.
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Uint64
+}
+
+func (w countingWriter) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n.Add(uint64(n))
+	return n, err
+}
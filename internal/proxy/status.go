@@ -0,0 +1,181 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+const (
+	offlineTimeout = 10 * time.Second
+
+	legacyPingID = 0xfe
+	legacyKickID = 0xff
+
+	// The protocol version of 1.16, the first one with hex colors
+	ProtocolHexColors = 735
+)
+
+func (p *Proxy) handleStatus(conn net.Conn, r *bufio.Reader, protocol int32) error {
+	return serveStatus(conn, r, func() ClientBoundStatusRes {
+		return p.statusResponse(protocol)
+	})
+}
+
+// serveStatus answers the status request and the ping of the client,
+// closing the connection after the pong.
+func serveStatus(conn net.Conn, r *bufio.Reader, status func() ClientBoundStatusRes) error {
+	sent := false
+
+	for {
+		packet, err := ReadPacket(r)
+		if err != nil {
+			return err
+		}
+
+		switch packet.ID {
+		case ServerBoundStatusReqID:
+			if sent {
+				return fmt.Errorf("status requested more than once")
+			}
+			sent = true
+
+			res := status()
+			data, err := EncodeMessage(&res)
+			if err != nil {
+				return err
+			}
+
+			err = WritePacket(conn, Packet{
+				ID:   ClientBoundStatusResID,
+				Data: data,
+			})
+			if err != nil {
+				return err
+			}
+
+		case ServerBoundStatusPingReqID:
+			var ping ServerBoundStatusPingReq
+			if err = ping.DecodeMCP(NewDecoder(packet.Data)); err != nil {
+				return err
+			}
+
+			data, err := EncodeMessage(&ClientBoundStatusPongRes{
+				Timestamp: ping.Timestamp,
+			})
+			if err != nil {
+				return err
+			}
+
+			return WritePacket(conn, Packet{
+				ID:   ClientBoundStatusPongResID,
+				Data: data,
+			})
+
+		default:
+			return fmt.Errorf("unexpected status packet 0x%02x", packet.ID)
+		}
+	}
+}
+
+// statusResponse returns the status of the sleeping server adapted to
+// the protocol version of the client. If the server data was not loaded
+// yet, the client protocol is used so it is not shown as incompatible.
+func (p *Proxy) statusResponse(protocol int32) ClientBoundStatusRes {
+	var status ClientBoundStatusRes
+	status.Players.Max = p.MaxPlayers
+	status.Players.Online = 0
+
+	if p.loadedData.Load() {
+		status.Version.Name = p.version
+		status.Version.Protocol = p.protocolVersion
+		status.Description = p.description
+		status.EnforceSecureChat = p.enforceSecureChat
+	} else {
+		status.Version.Name = "Starting"
+		status.Version.Protocol = protocol
+		status.Description = Text("Starting server ...").JSON()
+	}
+
+	if p.offlineMOTD != nil {
+		status.Description = p.offlineMOTD
+	}
+	if icon := p.favIcon.Load(); icon != nil {
+		status.FavIcon = *icon
+	}
+
+	if protocol < ProtocolHexColors && bytes.Contains(status.Description, []byte("#")) {
+		if c, err := ParseJSON(status.Description); err == nil {
+			status.Description = c.NamedColors().JSON()
+		}
+	}
+
+	return status
+}
+
+// handleLegacyPing answers the server list ping of the clients older
+// than 1.7. Since 1.4 the client sends 0xfe 0x01, older ones only
+// send 0xfe and expect a simpler response.
+func (p *Proxy) handleLegacyPing(conn net.Conn, r *bufio.Reader) error {
+	if _, err := r.ReadByte(); err != nil {
+		return err
+	}
+
+	// The newer clients send the payload right away
+	conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+	next, err := r.ReadByte()
+	modern := err == nil && next == 0x01
+
+	status := p.statusResponse(0)
+
+	var motd Component
+	if c, err := ParseJSON(status.Description); err == nil {
+		motd = c
+	}
+
+	var s string
+	if modern {
+		// Legacy clients never match the protocol of the server
+		s = strings.Join([]string{
+			"§1",
+			"127",
+			status.Version.Name,
+			strings.ReplaceAll(motd.Legacy(), "\n", " "),
+			strconv.Itoa(int(status.Players.Online)),
+			strconv.Itoa(int(status.Players.Max)),
+		}, "\x00")
+	} else {
+		s = strings.Join([]string{
+			strings.ReplaceAll(strings.ReplaceAll(motd.PlainText(), "\n", " "), "§", ""),
+			strconv.Itoa(int(status.Players.Online)),
+			strconv.Itoa(int(status.Players.Max)),
+		}, "§")
+	}
+
+	return writeLegacyKick(conn, s)
+}
+
+// writeLegacyKick writes the pre-netty kick packet, a string of
+// UTF-16 characters prefixed by its length.
+func writeLegacyKick(conn net.Conn, s string) error {
+	chars := utf16.Encode([]rune(s))
+	if len(chars) > 0xffff {
+		chars = chars[:0xffff]
+	}
+
+	b := make([]byte, 3, 3+len(chars)*2)
+	b[0] = legacyKickID
+	binary.BigEndian.PutUint16(b[1:], uint16(len(chars)))
+	for _, c := range chars {
+		b = binary.BigEndian.AppendUint16(b, c)
+	}
+
+	_, err := conn.Write(b)
+	return err
+}
@@ -0,0 +1,660 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const LegacyChar = '§'
+
+// Component is a minecraft json text component. Only the text
+// and the formatting fields are supported.
+type Component struct {
+	Text          string      `json:"text"`
+	Color         string      `json:"color,omitempty"`
+	Bold          *bool       `json:"bold,omitempty"`
+	Italic        *bool       `json:"italic,omitempty"`
+	Underlined    *bool       `json:"underlined,omitempty"`
+	Strikethrough *bool       `json:"strikethrough,omitempty"`
+	Obfuscated    *bool       `json:"obfuscated,omitempty"`
+	Extra         []Component `json:"extra,omitempty"`
+}
+
+// Style is the resolved formatting of a piece of text.
+type Style struct {
+	// a named color or #rrggbb, empty for the default one
+	Color         string
+	Bold          bool
+	Italic        bool
+	Underlined    bool
+	Strikethrough bool
+	Obfuscated    bool
+}
+
+type textSpan struct {
+	Text  string
+	Style Style
+}
+
+func Text(s string) Component {
+	return Component{Text: s}
+}
+
+func (c Component) WithColor(color string) Component {
+	c.Color = color
+	return c
+}
+
+func (c Component) WithStyle(s Style) Component {
+	c.Color = s.Color
+	c.Bold = boolPtr(s.Bold)
+	c.Italic = boolPtr(s.Italic)
+	c.Underlined = boolPtr(s.Underlined)
+	c.Strikethrough = boolPtr(s.Strikethrough)
+	c.Obfuscated = boolPtr(s.Obfuscated)
+	return c
+}
+
+func (c Component) Append(extra ...Component) Component {
+	c.Extra = append(c.Extra[:len(c.Extra):len(c.Extra)], extra...)
+	return c
+}
+
+// ParseText parses json components, legacy formatted text if it
+// contains any § code, or MiniMessage style tags otherwise.
+func ParseText(s string) Component {
+	trimmed := strings.TrimSpace(s)
+	if len(trimmed) > 0 && strings.ContainsRune(`{["`, rune(trimmed[0])) {
+		if c, err := ParseJSON([]byte(trimmed)); err == nil {
+			return c
+		}
+	}
+
+	if strings.ContainsRune(s, LegacyChar) {
+		return ParseLegacy(s, LegacyChar)
+	}
+	return ParseMini(s)
+}
+
+func ParseJSON(b []byte) (Component, error) {
+	var c Component
+	err := json.Unmarshal(b, &c)
+	return c, err
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Components can also be
+// plain strings or arrays, where the first element is the parent.
+func (c *Component) UnmarshalJSON(b []byte) error {
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return errors.New("text: empty component")
+	}
+
+	switch b[0] {
+	case '"':
+		*c = Component{}
+		return json.Unmarshal(b, &c.Text)
+
+	case '[':
+		var list []Component
+		if err := json.Unmarshal(b, &list); err != nil {
+			return err
+		}
+		if len(list) == 0 {
+			return errors.New("text: empty component array")
+		}
+
+		*c = list[0]
+		c.Extra = append(c.Extra, list[1:]...)
+		return nil
+	}
+
+	type component Component
+	var v component
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*c = Component(v)
+	return nil
+}
+
+func (c Component) JSON() json.RawMessage {
+	b, err := json.Marshal(c)
+	if err != nil {
+		// Components only contain strings and bools
+		panic(err)
+	}
+	return b
+}
+
+// NamedColors returns the component with the hex colors replaced
+// by the nearest named ones, for the clients older than 1.16.
+func (c Component) NamedColors() Component {
+	if code, ok := legacyColorCode(c.Color); ok {
+		c.Color = legacyColorNames[code]
+	}
+
+	if len(c.Extra) > 0 {
+		extra := make([]Component, len(c.Extra))
+		for i, e := range c.Extra {
+			extra[i] = e.NamedColors()
+		}
+		c.Extra = extra
+	}
+	return c
+}
+
+// PlainText returns the text without any formatting.
+func (c Component) PlainText() string {
+	var b strings.Builder
+	for _, span := range c.spans(Style{}, nil) {
+		b.WriteString(span.Text)
+	}
+	return b.String()
+}
+
+func (c Component) spans(parent Style, out []textSpan) []textSpan {
+	s := parent
+	if c.Color != "" {
+		s.Color = c.Color
+	}
+	mergeBool(&s.Bold, c.Bold)
+	mergeBool(&s.Italic, c.Italic)
+	mergeBool(&s.Underlined, c.Underlined)
+	mergeBool(&s.Strikethrough, c.Strikethrough)
+	mergeBool(&s.Obfuscated, c.Obfuscated)
+
+	if c.Text != "" {
+		// Merge the adjacent spans with the same style
+		if n := len(out); n > 0 && out[n-1].Style == s {
+			out[n-1].Text += c.Text
+		} else {
+			out = append(out, textSpan{Text: c.Text, Style: s})
+		}
+	}
+
+	for _, extra := range c.Extra {
+		out = extra.spans(s, out)
+	}
+	return out
+}
+
+func componentFromSpans(spans []textSpan) Component {
+	merged := spans[:1]
+	for _, span := range spans[1:] {
+		if last := &merged[len(merged)-1]; last.Style == span.Style {
+			last.Text += span.Text
+		} else {
+			merged = append(merged, span)
+		}
+	}
+	spans = merged
+
+	if len(spans) == 1 {
+		return Text(spans[0].Text).withSpanStyle(spans[0].Style)
+	}
+
+	c := Component{Extra: make([]Component, len(spans))}
+	for i, span := range spans {
+		c.Extra[i] = Text(span.Text).withSpanStyle(span.Style)
+	}
+	return c
+}
+
+// withSpanStyle only sets the enabled fields, since the spans
+// do not inherit any formatting.
+func (c Component) withSpanStyle(s Style) Component {
+	c.Color = s.Color
+	if s.Bold {
+		c.Bold = boolPtr(true)
+	}
+	if s.Italic {
+		c.Italic = boolPtr(true)
+	}
+	if s.Underlined {
+		c.Underlined = boolPtr(true)
+	}
+	if s.Strikethrough {
+		c.Strikethrough = boolPtr(true)
+	}
+	if s.Obfuscated {
+		c.Obfuscated = boolPtr(true)
+	}
+	return c
+}
+
+// ParseLegacy parses text formatted with legacy codes prefixed by char,
+// usually § or &. The bungeecord hex format (§x§r§r§g§g§b§b) is also
+// supported.
+func ParseLegacy(s string, char rune) Component {
+	var (
+		spans []textSpan
+		style Style
+		text  strings.Builder
+	)
+
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, textSpan{Text: text.String(), Style: style})
+			text.Reset()
+		}
+	}
+
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != char || i+1 >= len(runes) {
+			text.WriteRune(runes[i])
+			continue
+		}
+
+		code := toLowerASCII(runes[i+1])
+
+		if code == 'x' {
+			if hex, ok := parseLegacyHex(runes[i+2:], char); ok {
+				flush()
+				style = Style{Color: hex}
+				i += 13
+				continue
+			}
+		}
+
+		if name, ok := legacyColorNames[code]; ok {
+			flush()
+			style = Style{Color: name}
+		} else if code == 'r' {
+			flush()
+			style = Style{}
+		} else if field := style.format(code); field != nil {
+			if !*field {
+				flush()
+				*field = true
+			}
+		} else {
+			text.WriteRune(runes[i])
+			continue
+		}
+		i++
+	}
+	flush()
+
+	if len(spans) == 0 {
+		return Text("")
+	}
+	return componentFromSpans(spans)
+}
+
+func parseLegacyHex(runes []rune, char rune) (string, bool) {
+	if len(runes) < 12 {
+		return "", false
+	}
+
+	hex := make([]rune, 0, 6)
+	for i := 0; i < 12; i += 2 {
+		if runes[i] != char || !isHexDigit(runes[i+1]) {
+			return "", false
+		}
+		hex = append(hex, toLowerASCII(runes[i+1]))
+	}
+	return "#" + string(hex), true
+}
+
+// Legacy returns the text formatted with § codes. Hex colors are
+// replaced by the nearest named color.
+func (c Component) Legacy() string {
+	var (
+		b    strings.Builder
+		prev Style
+	)
+
+	for _, span := range c.spans(Style{}, nil) {
+		s := span.Style
+		if s != prev {
+			// Colors reset the formatting, so it is written again
+			if s.Color != prev.Color || !s.hasFormats(prev) {
+				if code, ok := legacyColorCode(s.Color); ok {
+					b.WriteRune(LegacyChar)
+					b.WriteRune(code)
+				} else {
+					b.WriteRune(LegacyChar)
+					b.WriteRune('r')
+				}
+				prev = Style{Color: s.Color}
+			}
+
+			for _, code := range legacyFormatCodes {
+				if *s.format(code) && !*prev.format(code) {
+					b.WriteRune(LegacyChar)
+					b.WriteRune(code)
+				}
+			}
+			prev = s
+		}
+
+		b.WriteString(span.Text)
+	}
+
+	return b.String()
+}
+
+// ParseMini parses text formatted with MiniMessage style tags, like
+// <red>, <#ff0000>, <color:gold>, <bold> or <b>, and their closing
+// tags. Unknown tags are kept as text, a literal < can be escaped
+// with a backslash.
+func ParseMini(s string) Component {
+	type frame struct {
+		tag   string
+		style Style
+	}
+
+	var (
+		spans []textSpan
+		text  strings.Builder
+		stack = []frame{{}}
+	)
+
+	flush := func() {
+		if text.Len() > 0 {
+			spans = append(spans, textSpan{
+				Text:  text.String(),
+				Style: stack[len(stack)-1].style,
+			})
+			text.Reset()
+		}
+	}
+
+	for len(s) > 0 {
+		if strings.HasPrefix(s, `\<`) || strings.HasPrefix(s, `\\`) {
+			text.WriteByte(s[1])
+			s = s[2:]
+			continue
+		}
+
+		if s[0] != '<' {
+			text.WriteByte(s[0])
+			s = s[1:]
+			continue
+		}
+
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			text.WriteString(s)
+			break
+		}
+		tag := s[1:end]
+
+		if name, ok := strings.CutPrefix(tag, "/"); ok {
+			name = miniTagName(name)
+			for i := len(stack) - 1; i > 0; i-- {
+				if name == "" || stack[i].tag == name {
+					flush()
+					stack = stack[:i]
+					break
+				}
+			}
+			s = s[end+1:]
+			continue
+		}
+
+		switch name, style, ok := applyMiniTag(tag, stack[len(stack)-1].style); {
+		case !ok:
+			text.WriteString(s[:end+1])
+		case name == "newline":
+			text.WriteByte('\n')
+		case name == "reset":
+			flush()
+			stack = stack[:1]
+		default:
+			flush()
+			stack = append(stack, frame{tag: name, style: style})
+		}
+		s = s[end+1:]
+	}
+	flush()
+
+	if len(spans) == 0 {
+		return Text("")
+	}
+	return componentFromSpans(spans)
+}
+
+// applyMiniTag returns the canonical name of the tag and the style
+// with it applied.
+func applyMiniTag(tag string, s Style) (string, Style, bool) {
+	tag = strings.ToLower(tag)
+
+	negate := false
+	if rest, ok := strings.CutPrefix(tag, "!"); ok {
+		tag, negate = rest, true
+	}
+
+	name, arg, hasArg := strings.Cut(tag, ":")
+	if isValidColor(name) && !hasArg && !negate {
+		s.Color = name
+		return "color", s, true
+	}
+	name = miniTagName(name)
+
+	switch name {
+	case "newline", "reset":
+		return name, s, !hasArg && !negate
+
+	case "color":
+		if negate || !hasArg || !isValidColor(arg) {
+			return "", s, false
+		}
+		s.Color = arg
+		return name, s, true
+	}
+
+	for code, format := range legacyFormatNames {
+		if name == format && !hasArg {
+			*s.format(code) = !negate
+			return name, s, true
+		}
+	}
+	return "", s, false
+}
+
+func miniTagName(name string) string {
+	name = strings.ToLower(name)
+	switch name {
+	case "colour", "c":
+		return "color"
+	case "b":
+		return "bold"
+	case "i", "em":
+		return "italic"
+	case "u":
+		return "underlined"
+	case "st":
+		return "strikethrough"
+	case "obf":
+		return "obfuscated"
+	case "br":
+		return "newline"
+	}
+
+	if isValidColor(name) {
+		return "color"
+	}
+	return name
+}
+
+// Mini returns the text formatted with MiniMessage style tags.
+func (c Component) Mini() string {
+	var (
+		b    strings.Builder
+		prev Style
+	)
+
+	for _, span := range c.spans(Style{}, nil) {
+		s := span.Style
+		if s != prev {
+			if prev != (Style{}) {
+				b.WriteString("<reset>")
+			}
+			if s.Color != "" {
+				b.WriteString("<" + s.Color + ">")
+			}
+			for _, code := range legacyFormatCodes {
+				if *s.format(code) {
+					b.WriteString("<" + legacyFormatNames[code] + ">")
+				}
+			}
+			prev = s
+		}
+
+		b.WriteString(strings.NewReplacer(`\`, `\\`, "<", `\<`).Replace(span.Text))
+	}
+
+	return b.String()
+}
+
+// format returns the field of the style for the legacy format code.
+func (s *Style) format(code rune) *bool {
+	switch code {
+	case 'k':
+		return &s.Obfuscated
+	case 'l':
+		return &s.Bold
+	case 'm':
+		return &s.Strikethrough
+	case 'n':
+		return &s.Underlined
+	case 'o':
+		return &s.Italic
+	}
+	return nil
+}
+
+// hasFormats reports whether all the formats enabled in o
+// are also enabled in s.
+func (s Style) hasFormats(o Style) bool {
+	for _, code := range legacyFormatCodes {
+		if *o.format(code) && !*s.format(code) {
+			return false
+		}
+	}
+	return true
+}
+
+var legacyFormatCodes = []rune{'k', 'l', 'm', 'n', 'o'}
+
+var legacyFormatNames = map[rune]string{
+	'k': "obfuscated",
+	'l': "bold",
+	'm': "strikethrough",
+	'n': "underlined",
+	'o': "italic",
+}
+
+var legacyColorNames = map[rune]string{
+	'0': "black",
+	'1': "dark_blue",
+	'2': "dark_green",
+	'3': "dark_aqua",
+	'4': "dark_red",
+	'5': "dark_purple",
+	'6': "gold",
+	'7': "gray",
+	'8': "dark_gray",
+	'9': "blue",
+	'a': "green",
+	'b': "aqua",
+	'c': "red",
+	'd': "light_purple",
+	'e': "yellow",
+	'f': "white",
+}
+
+var namedColors = map[string][3]uint8{
+	"black":        {0x00, 0x00, 0x00},
+	"dark_blue":    {0x00, 0x00, 0xaa},
+	"dark_green":   {0x00, 0xaa, 0x00},
+	"dark_aqua":    {0x00, 0xaa, 0xaa},
+	"dark_red":     {0xaa, 0x00, 0x00},
+	"dark_purple":  {0xaa, 0x00, 0xaa},
+	"gold":         {0xff, 0xaa, 0x00},
+	"gray":         {0xaa, 0xaa, 0xaa},
+	"dark_gray":    {0x55, 0x55, 0x55},
+	"blue":         {0x55, 0x55, 0xff},
+	"green":        {0x55, 0xff, 0x55},
+	"aqua":         {0x55, 0xff, 0xff},
+	"red":          {0xff, 0x55, 0x55},
+	"light_purple": {0xff, 0x55, 0xff},
+	"yellow":       {0xff, 0xff, 0x55},
+	"white":        {0xff, 0xff, 0xff},
+}
+
+func isValidColor(color string) bool {
+	if _, ok := namedColors[color]; ok {
+		return true
+	}
+	_, ok := parseHexColor(color)
+	return ok
+}
+
+func parseHexColor(color string) ([3]uint8, bool) {
+	hex, ok := strings.CutPrefix(color, "#")
+	if !ok || len(hex) != 6 {
+		return [3]uint8{}, false
+	}
+
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return [3]uint8{}, false
+	}
+	return [3]uint8{uint8(n >> 16), uint8(n >> 8), uint8(n)}, true
+}
+
+// legacyColorCode returns the code of the color, or of the
+// nearest named color if it is a hex one.
+func legacyColorCode(color string) (rune, bool) {
+	rgb, ok := namedColors[color]
+	if !ok {
+		if rgb, ok = parseHexColor(color); !ok {
+			return 0, false
+		}
+	}
+
+	var (
+		best     rune
+		bestDist = -1
+	)
+	for code, name := range legacyColorNames {
+		c := namedColors[name]
+		dr := int(c[0]) - int(rgb[0])
+		dg := int(c[1]) - int(rgb[1])
+		db := int(c[2]) - int(rgb[2])
+
+		dist := dr*dr + dg*dg + db*db
+		if bestDist < 0 || dist < bestDist || (dist == bestDist && code < best) {
+			best, bestDist = code, dist
+		}
+	}
+	return best, true
+}
+
+func isHexDigit(r rune) bool {
+	return (r >= '0' && r <= '9') || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func toLowerASCII(r rune) rune {
+	if r >= 'A' && r <= 'Z' {
+		return r + ('a' - 'A')
+	}
+	return r
+}
+
+func mergeBool(dst *bool, v *bool) {
+	if v != nil {
+		*dst = *v
+	}
+}
+
+func boolPtr(v bool) *bool {
+	return &v
+}
@@ -2,15 +2,66 @@ package proxy
 
 import (
 	"bufio"
+	"fmt"
 	"net"
+	"time"
 )
 
-func getServerInfo(addr *net.TCPAddr) (ClientBoundStatusRes, error) {
-	conn, err := net.DialTCP("tcp", nil, addr)
+// PingResult is the status returned by a server and the time it took
+// to connect and reply.
+type PingResult struct {
+	Latency time.Duration
+	Status  ClientBoundStatusRes
+}
+
+// PingBackend requests the status directly to the server.
+func (p *Proxy) PingBackend(timeout time.Duration) (PingResult, error) {
+	return ping(&p.endpoint, p.proxyProtocol, timeout)
+}
+
+// PingPublic requests the status through the listener of the proxy,
+// the way the players do.
+func (p *Proxy) PingPublic(timeout time.Duration) (PingResult, error) {
+	addr := &net.TCPAddr{
+		IP:   net.IPv4(127, 0, 0, 1),
+		Port: p.ln.Addr().(*net.TCPAddr).Port,
+	}
+	return ping(addr, p.inbound.ProxyProtocol && p.inbound.trusted(addr), timeout)
+}
+
+func ping(addr *net.TCPAddr, proxyProtocol bool, timeout time.Duration) (PingResult, error) {
+	start := time.Now()
+
+	status, err := getServerInfo(addr, proxyProtocol, timeout)
+	if err != nil {
+		return PingResult{}, err
+	}
+
+	return PingResult{
+		Latency: time.Since(start),
+		Status:  status,
+	}, nil
+}
+
+func getServerInfo(
+	addr *net.TCPAddr,
+	proxyProtocol bool,
+	timeout time.Duration,
+) (ClientBoundStatusRes, error) {
+	conn, err := net.DialTimeout("tcp", addr.String(), timeout)
 	if err != nil {
 		return ClientBoundStatusRes{}, err
 	}
 	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	// The server rejects connections without the header
+	if proxyProtocol {
+		err = WriteProxyHeader(conn, conn.LocalAddr(), conn.RemoteAddr())
+		if err != nil {
+			return ClientBoundStatusRes{}, err
+		}
+	}
 
 	rd := bufio.NewReader(conn)
 
@@ -32,6 +83,11 @@ func getServerInfo(addr *net.TCPAddr) (ClientBoundStatusRes, error) {
 		if err != nil {
 			return ClientBoundStatusRes{}, err
 		}
+
+		err = WritePacket(conn, Packet{ID: ServerBoundStatusReqID})
+		if err != nil {
+			return ClientBoundStatusRes{}, err
+		}
 	}
 
 	packet, err := ReadPacket(rd)
@@ -39,6 +95,13 @@ func getServerInfo(addr *net.TCPAddr) (ClientBoundStatusRes, error) {
 		return ClientBoundStatusRes{}, err
 	}
 
+	if packet.ID != ClientBoundStatusResID {
+		return ClientBoundStatusRes{}, fmt.Errorf(
+			"expected status response, got packet 0x%02x",
+			packet.ID,
+		)
+	}
+
 	var data ClientBoundStatusRes
 	err = data.DecodeMCP(NewDecoder(packet.Data))
 	return data, err
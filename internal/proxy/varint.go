@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+)
+
+const (
+	MaxVarIntLen  = 5
+	MaxVarLongLen = 10
+)
+
+var (
+	ErrVarIntTooBig  = errors.New("proxy: VarInt is too big")
+	ErrVarLongTooBig = errors.New("proxy: VarLong is too big")
+)
+
+// AppendVarInt appends the unsigned LEB128 encoding of the two's
+// complement of v, so negative values always take 5 bytes.
+func AppendVarInt(b []byte, v int32) []byte {
+	return appendUleb128(b, uint64(uint32(v)))
+}
+
+func AppendVarLong(b []byte, v int64) []byte {
+	return appendUleb128(b, uint64(v))
+}
+
+func VarIntLen(v int32) int {
+	n, u := 1, uint32(v)
+	for u >= 0x80 {
+		u >>= 7
+		n++
+	}
+	return n
+}
+
+func ReadVarInt(r io.ByteReader) (int32, error) {
+	v, err := readUleb128(r, MaxVarIntLen, ErrVarIntTooBig)
+	if err != nil {
+		return 0, err
+	}
+	if v > 0xffffffff {
+		return 0, ErrVarIntTooBig
+	}
+	return int32(uint32(v)), nil
+}
+
+func ReadVarLong(r io.ByteReader) (int64, error) {
+	v, err := readUleb128(r, MaxVarLongLen, ErrVarLongTooBig)
+	return int64(v), err
+}
+
+func appendUleb128(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+func readUleb128(r io.ByteReader, maxLen int, errTooBig error) (uint64, error) {
+	var v uint64
+	for i := 0; i < maxLen; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			if i > 0 && err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+
+		// The tenth byte only holds the highest bit of a uint64
+		if i == 9 && b > 1 {
+			return 0, errTooBig
+		}
+
+		v |= uint64(b&0x7f) << (7 * i)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+	return 0, errTooBig
+}
@@ -0,0 +1,159 @@
+package proxy
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"testing"
+)
+
+// The sample values of the protocol documentation
+var varIntSamples = []struct {
+	v int32
+	b []byte
+}{
+	{0, []byte{0x00}},
+	{1, []byte{0x01}},
+	{2, []byte{0x02}},
+	{127, []byte{0x7f}},
+	{128, []byte{0x80, 0x01}},
+	{255, []byte{0xff, 0x01}},
+	{25565, []byte{0xdd, 0xc7, 0x01}},
+	{2097151, []byte{0xff, 0xff, 0x7f}},
+	{math.MaxInt32, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+	{-1, []byte{0xff, 0xff, 0xff, 0xff, 0x0f}},
+	{math.MinInt32, []byte{0x80, 0x80, 0x80, 0x80, 0x08}},
+}
+
+var varLongSamples = []struct {
+	v int64
+	b []byte
+}{
+	{0, []byte{0x00}},
+	{1, []byte{0x01}},
+	{2, []byte{0x02}},
+	{127, []byte{0x7f}},
+	{128, []byte{0x80, 0x01}},
+	{255, []byte{0xff, 0x01}},
+	{math.MaxInt32, []byte{0xff, 0xff, 0xff, 0xff, 0x07}},
+	{math.MaxInt64, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f}},
+	{-1, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	{math.MinInt32, []byte{0x80, 0x80, 0x80, 0x80, 0xf8, 0xff, 0xff, 0xff, 0xff, 0x01}},
+	{math.MinInt64, []byte{0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x80, 0x01}},
+}
+
+func TestVarIntSamples(t *testing.T) {
+	for _, tc := range varIntSamples {
+		if b := AppendVarInt(nil, tc.v); !bytes.Equal(b, tc.b) {
+			t.Errorf("AppendVarInt(%d) = %x, want %x", tc.v, b, tc.b)
+		}
+		if n := VarIntLen(tc.v); n != len(tc.b) {
+			t.Errorf("VarIntLen(%d) = %d, want %d", tc.v, n, len(tc.b))
+		}
+		if v, err := ReadVarInt(bytes.NewReader(tc.b)); err != nil || v != tc.v {
+			t.Errorf("ReadVarInt(%x) = %d, %v, want %d", tc.b, v, err, tc.v)
+		}
+	}
+}
+
+func TestVarLongSamples(t *testing.T) {
+	for _, tc := range varLongSamples {
+		if b := AppendVarLong(nil, tc.v); !bytes.Equal(b, tc.b) {
+			t.Errorf("AppendVarLong(%d) = %x, want %x", tc.v, b, tc.b)
+		}
+		if v, err := ReadVarLong(bytes.NewReader(tc.b)); err != nil || v != tc.v {
+			t.Errorf("ReadVarLong(%x) = %d, %v, want %d", tc.b, v, err, tc.v)
+		}
+	}
+}
+
+func TestVarLongTooBig(t *testing.T) {
+	tests := [][]byte{
+		// Bits beyond the 64th
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x02},
+		// An eleventh byte
+		{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x81, 0x00},
+	}
+
+	for _, b := range tests {
+		if _, err := ReadVarLong(bytes.NewReader(b)); !errors.Is(err, ErrVarLongTooBig) {
+			t.Errorf("ReadVarLong(%x) error = %v, want %v", b, err, ErrVarLongTooBig)
+		}
+	}
+}
+
+func FuzzReadVarInt(f *testing.F) {
+	for _, tc := range varIntSamples {
+		f.Add(tc.b)
+	}
+	// Overlong zero and a sixth byte
+	f.Add([]byte{0x80, 0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0x01})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r := bytes.NewReader(b)
+
+		v, err := ReadVarInt(r)
+		if err != nil {
+			return
+		}
+		n := len(b) - r.Len()
+
+		encoded := AppendVarInt(nil, v)
+		if len(encoded) != VarIntLen(v) {
+			t.Fatalf("encoded %d bytes, VarIntLen = %d", len(encoded), VarIntLen(v))
+		}
+
+		// The overlong VarInts are accepted but never written, so
+		// only the encodings of the same length must match
+		if len(encoded) == n && !bytes.Equal(encoded, b[:n]) {
+			t.Fatalf("encoded %x, want %x", encoded, b[:n])
+		}
+		if len(encoded) > n {
+			t.Fatalf("encoded %d bytes, read %d", len(encoded), n)
+		}
+
+		v2, err := ReadVarInt(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("read encoded %x: %v", encoded, err)
+		}
+		if v2 != v {
+			t.Fatalf("read %d, want %d", v2, v)
+		}
+	})
+}
+
+func FuzzReadVarLong(f *testing.F) {
+	for _, tc := range varLongSamples {
+		f.Add(tc.b)
+	}
+	// Overlong zero and bits beyond the 64th
+	f.Add([]byte{0x80, 0x00})
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r := bytes.NewReader(b)
+
+		v, err := ReadVarLong(r)
+		if err != nil {
+			return
+		}
+		n := len(b) - r.Len()
+
+		encoded := AppendVarLong(nil, v)
+		if len(encoded) == n && !bytes.Equal(encoded, b[:n]) {
+			t.Fatalf("encoded %x, want %x", encoded, b[:n])
+		}
+		if len(encoded) > n {
+			t.Fatalf("encoded %d bytes, read %d", len(encoded), n)
+		}
+
+		v2, err := ReadVarLong(bytes.NewReader(encoded))
+		if err != nil {
+			t.Fatalf("read encoded %x: %v", encoded, err)
+		}
+		if v2 != v {
+			t.Fatalf("read %d, want %d", v2, v)
+		}
+	})
+}
@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Files that can be downloaded again or are useless to restore.
+var backupExcluded = []string{
+	"*.jar",
+	"*.part",
+	".upload-*",
+	".world-*",
+	"logs",
+	"cache",
+	"libraries",
+	"versions",
+}
+
+type Backup struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+func (b *Backup) IntoPB() *pb.RunnerBackup {
+	return &pb.RunnerBackup{
+		Name:      b.Name,
+		Size:      uint64(b.Size),
+		CreatedAt: timestamppb.New(b.CreatedAt),
+	}
+}
+
+func createBackup(
+	ctx context.Context,
+	dataDir string,
+	backupDir string,
+	reason string,
+) (Backup, error) {
+	now := time.Now()
+
+	name := now.UTC().Format("20060102-150405")
+	if reason != "" {
+		name += "-" + reason
+	}
+	name += ".zip"
+
+	if err := os.MkdirAll(backupDir, os.ModePerm); err != nil {
+		return Backup{}, err
+	}
+
+	file, err := os.CreateTemp(backupDir, ".backup-*")
+	if err != nil {
+		return Backup{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	zw := zip.NewWriter(file)
+
+	err = zipDir(ctx, zw, dataDir, "", isBackupExcluded)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if err = zw.Close(); err != nil {
+		return Backup{}, err
+	}
+
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	if err = file.Close(); err != nil {
+		return Backup{}, err
+	}
+
+	if err = os.Rename(file.Name(), path.Join(backupDir, name)); err != nil {
+		return Backup{}, err
+	}
+
+	return Backup{
+		Name:      name,
+		Size:      size,
+		CreatedAt: now,
+	}, nil
+}
+
+func isBackupExcluded(rel string) bool {
+	// Only top level entries are matched
+	if strings.ContainsRune(filepath.ToSlash(rel), '/') {
+		return false
+	}
+
+	for _, pattern := range backupExcluded {
+		if ok, _ := filepath.Match(pattern, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// zipDir adds the regular files of the directory into the archive,
+// with their paths relative to root prefixed with prefix.
+func zipDir(
+	ctx context.Context,
+	zw *zip.Writer,
+	root string,
+	prefix string,
+	excluded func(rel string) bool,
+) error {
+	return filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil || rel == "." {
+			return err
+		}
+
+		if excluded != nil && excluded(rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		return addZipFile(zw, p, prefix+filepath.ToSlash(rel))
+	})
+}
+
+func addZipFile(zw *zip.Writer, p string, name string) error {
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	w, err := zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(w, file)
+	return err
+}
@@ -0,0 +1,166 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"path"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/zanz1n/mc-manager/config"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"github.com/zanz1n/mc-manager/internal/proxy"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type BlockedAddress struct {
+	Prefix    netip.Prefix `json:"prefix"`
+	Reason    string       `json:"reason"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+func (a *BlockedAddress) IntoPB() *pb.BlockedAddress {
+	return &pb.BlockedAddress{
+		Address:   a.Prefix.String(),
+		Reason:    a.Reason,
+		CreatedAt: timestamppb.New(a.CreatedAt),
+	}
+}
+
+func BlocklistIntoPB(list []BlockedAddress) *pb.Blocklist {
+	res := make([]*pb.BlockedAddress, len(list))
+	for i, a := range list {
+		res[i] = a.IntoPB()
+	}
+	return &pb.Blocklist{Addresses: res}
+}
+
+// Blocklist is the list of addresses the proxies of the node refuse
+// connections from, stored in the data directory.
+type Blocklist struct {
+	path  string
+	guard *proxy.Guard
+
+	list []BlockedAddress
+	mu   sync.Mutex
+}
+
+func NewBlocklist(dataCfg config.DataConfig, guard *proxy.Guard) (*Blocklist, error) {
+	dir, err := filepath.Abs(dataCfg.DataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Blocklist{
+		path:  path.Join(dir, "blocklist.json"),
+		guard: guard,
+	}
+
+	b.list, err = readJSONList[BlockedAddress](b.path)
+	if err != nil {
+		return nil, err
+	}
+	b.apply()
+
+	return b, nil
+}
+
+func (b *Blocklist) Get() []BlockedAddress {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return slices.Clone(b.list)
+}
+
+// Block adds an ip address or cidr to the list, updating the reason
+// if it is already blocked.
+func (b *Blocklist) Block(address string, reason string) ([]BlockedAddress, error) {
+	prefix, err := parseBlockedAddress(address)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidAddress, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := slices.Clone(b.list)
+	i := slices.IndexFunc(list, func(a BlockedAddress) bool {
+		return a.Prefix == prefix
+	})
+	if i >= 0 {
+		list[i].Reason = reason
+	} else {
+		list = append(list, BlockedAddress{
+			Prefix:    prefix,
+			Reason:    reason,
+			CreatedAt: time.Now(),
+		})
+	}
+
+	if err = b.save(list); err != nil {
+		return nil, err
+	}
+	return slices.Clone(b.list), nil
+}
+
+func (b *Blocklist) Unblock(address string) ([]BlockedAddress, error) {
+	prefix, err := parseBlockedAddress(address)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidAddress, err)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	list := slices.DeleteFunc(slices.Clone(b.list), func(a BlockedAddress) bool {
+		return a.Prefix == prefix
+	})
+	if len(list) == len(b.list) {
+		return nil, errors.Join(ErrAddressNotBlocked, errors.New(prefix.String()))
+	}
+
+	if err = b.save(list); err != nil {
+		return nil, err
+	}
+	return slices.Clone(b.list), nil
+}
+
+func (b *Blocklist) save(list []BlockedAddress) error {
+	if err := writeJSONList(b.path, list); err != nil {
+		return errors.Join(ErrBlocklist, err)
+	}
+
+	b.list = list
+	b.apply()
+	return nil
+}
+
+func (b *Blocklist) apply() {
+	prefixes := make([]netip.Prefix, len(b.list))
+	for i, a := range b.list {
+		prefixes[i] = a.Prefix
+	}
+	b.guard.SetBlocklist(prefixes)
+}
+
+// parseBlockedAddress parses an ip address or a cidr, returning the
+// masked prefix. IPv4-mapped addresses are stored as IPv4.
+func parseBlockedAddress(s string) (netip.Prefix, error) {
+	if prefix, err := netip.ParsePrefix(s); err == nil {
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil || addr.Zone() != "" {
+		return netip.Prefix{}, fmt.Errorf("invalid ip address or cidr %q", s)
+	}
+
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
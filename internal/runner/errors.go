@@ -42,4 +42,108 @@ var (
 		codes.Internal,
 		"failed to send command to instance",
 	)
+	ErrBackup = status.Error(
+		codes.Internal,
+		"failed to backup instance",
+	)
+	ErrWorldRead = status.Error(
+		codes.Internal,
+		"failed to read the instance world",
+	)
+	ErrInvalidProperty = status.Error(
+		codes.InvalidArgument,
+		"invalid server property",
+	)
+	ErrProperties = status.Error(
+		codes.Internal,
+		"failed to access the server properties",
+	)
+	ErrInvalidPlayerList = status.Error(
+		codes.InvalidArgument,
+		"invalid player list change",
+	)
+	ErrPlayerList = status.Error(
+		codes.Internal,
+		"failed to edit the player list",
+	)
+	ErrOpLevelRunning = status.Error(
+		codes.FailedPrecondition,
+		"the instance must be stopped to set an operator level other than the default",
+	)
+	ErrUUIDResolve = status.Error(
+		codes.NotFound,
+		"failed to resolve the player uuid",
+	)
+	ErrInstanceRunning = status.Error(
+		codes.FailedPrecondition,
+		"the instance must be stopped",
+	)
+	ErrInvalidWorld = status.Error(
+		codes.InvalidArgument,
+		"invalid world",
+	)
+	ErrWorldExists = status.Error(
+		codes.AlreadyExists,
+		"world already exists",
+	)
+	ErrWorldNotFound = status.Error(
+		codes.NotFound,
+		"world not found",
+	)
+	ErrInvalidUUID = status.Error(
+		codes.InvalidArgument,
+		"invalid uuid",
+	)
+	ErrInvalidGameRule = status.Error(
+		codes.InvalidArgument,
+		"invalid game rule",
+	)
+	ErrInstanceNotReady = status.Error(
+		codes.Unavailable,
+		"the instance is still starting",
+	)
+	ErrGameRules = status.Error(
+		codes.Internal,
+		"failed to access the game rules",
+	)
+	ErrInvalidIcon = status.Error(
+		codes.InvalidArgument,
+		"invalid server icon",
+	)
+	ErrDomainConflict = status.Error(
+		codes.AlreadyExists,
+		"the instance domain is used by another instance",
+	)
+	ErrPortConflict = status.Error(
+		codes.AlreadyExists,
+		"the instance port is used by another instance",
+	)
+	ErrInvalidTransfer = status.Error(
+		codes.InvalidArgument,
+		"invalid player transfer",
+	)
+	ErrTransferUnsupported = status.Error(
+		codes.FailedPrecondition,
+		"the server does not support transfers, 1.20.5 or newer is required",
+	)
+	ErrTransferTimeout = status.Error(
+		codes.DeadlineExceeded,
+		"the server did not confirm the transfer",
+	)
+	ErrPlayerNotFound = status.Error(
+		codes.NotFound,
+		"player not found",
+	)
+	ErrInvalidAddress = status.Error(
+		codes.InvalidArgument,
+		"invalid ip address",
+	)
+	ErrAddressNotBlocked = status.Error(
+		codes.NotFound,
+		"the address is not blocked",
+	)
+	ErrBlocklist = status.Error(
+		codes.Internal,
+		"failed to save the blocklist",
+	)
 )
@@ -0,0 +1,215 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"strconv"
+
+	"github.com/zanz1n/mc-manager/internal/nbt"
+)
+
+type gameRuleType uint8
+
+const (
+	gameRuleBool gameRuleType = iota
+	gameRuleInt
+)
+
+type gameRule struct {
+	Type gameRuleType
+	// the data version of the release that added the rule,
+	// zero for the rules older than 1.9
+	Since int32
+}
+
+// Game rules of the vanilla server. Rules that are not listed here are
+// still accepted if they are present in the level.dat, so modded and
+// newer rules can be changed too.
+var gameRules = map[string]gameRule{
+	"commandBlockOutput":       {gameRuleBool, 0},
+	"doDaylightCycle":          {gameRuleBool, 0},
+	"doEntityDrops":            {gameRuleBool, 0},
+	"doFireTick":               {gameRuleBool, 0},
+	"doMobLoot":                {gameRuleBool, 0},
+	"doMobSpawning":            {gameRuleBool, 0},
+	"doTileDrops":              {gameRuleBool, 0},
+	"keepInventory":            {gameRuleBool, 0},
+	"logAdminCommands":         {gameRuleBool, 0},
+	"mobGriefing":              {gameRuleBool, 0},
+	"naturalRegeneration":      {gameRuleBool, 0},
+	"randomTickSpeed":          {gameRuleInt, 0},
+	"reducedDebugInfo":         {gameRuleBool, 0},
+	"sendCommandFeedback":      {gameRuleBool, 0},
+	"showDeathMessages":        {gameRuleBool, 0},
+	"spawnRadius":              {gameRuleInt, 0},
+	"spectatorsGenerateChunks": {gameRuleBool, 0},
+
+	// 1.9
+	"disableElytraMovementCheck": {gameRuleBool, 169},
+	// 1.11
+	"doWeatherCycle":    {gameRuleBool, 819},
+	"maxEntityCramming": {gameRuleInt, 819},
+	// 1.12
+	"announceAdvancements":  {gameRuleBool, 1139},
+	"doLimitedCrafting":     {gameRuleBool, 1139},
+	"maxCommandChainLength": {gameRuleInt, 1139},
+	// 1.14.3
+	"disableRaids": {gameRuleBool, 1968},
+	// 1.15
+	"doImmediateRespawn": {gameRuleBool, 2225},
+	"doInsomnia":         {gameRuleBool, 2225},
+	"drowningDamage":     {gameRuleBool, 2225},
+	"fallDamage":         {gameRuleBool, 2225},
+	"fireDamage":         {gameRuleBool, 2225},
+	// 1.15.2
+	"doPatrolSpawning": {gameRuleBool, 2230},
+	"doTraderSpawning": {gameRuleBool, 2230},
+	// 1.16
+	"forgiveDeadPlayers": {gameRuleBool, 2566},
+	"universalAnger":     {gameRuleBool, 2566},
+	// 1.17
+	"freezeDamage":              {gameRuleBool, 2724},
+	"playersSleepingPercentage": {gameRuleInt, 2724},
+	// 1.19
+	"doWardenSpawning": {gameRuleBool, 3105},
+	// 1.19.3
+	"blockExplosionDropDecay": {gameRuleBool, 3218},
+	"globalSoundEvents":       {gameRuleBool, 3218},
+	"lavaSourceConversion":    {gameRuleBool, 3218},
+	"mobExplosionDropDecay":   {gameRuleBool, 3218},
+	"snowAccumulationHeight":  {gameRuleInt, 3218},
+	"tntExplosionDropDecay":   {gameRuleBool, 3218},
+	"waterSourceConversion":   {gameRuleBool, 3218},
+	// 1.19.4
+	"commandModificationBlockLimit": {gameRuleInt, 3337},
+	"doVinesSpread":                 {gameRuleBool, 3337},
+	// 1.20.2
+	"enderPearlsVanishOnDeath": {gameRuleBool, 3578},
+	// 1.20.3
+	"maxCommandForkCount":              {gameRuleInt, 3698},
+	"playersNetherPortalCreativeDelay": {gameRuleInt, 3698},
+	"playersNetherPortalDefaultDelay":  {gameRuleInt, 3698},
+	// 1.20.5
+	"projectilesCanBreakBlocks": {gameRuleBool, 3837},
+	"spawnChunkRadius":          {gameRuleInt, 3837},
+	// 1.21.2
+	"disablePlayerMovementCheck": {gameRuleBool, 4080},
+}
+
+// validateGameRules checks the names and the values of the rules against
+// the world data version and the rules present in its level.dat.
+func validateGameRules(rules map[string]string, v WorldVersion, current map[string]string) error {
+	for name, value := range rules {
+		rule, known := gameRules[name]
+		cur, present := current[name]
+
+		switch {
+		case present && !known:
+			// The rules are stored as strings, so the type is guessed
+			// from the current value
+			if cur == "true" || cur == "false" {
+				rule.Type = gameRuleBool
+			} else {
+				rule.Type = gameRuleInt
+			}
+		case !known:
+			return fmt.Errorf("unknown game rule %q", name)
+		case !present && v.DataVersion > 0 && v.DataVersion < rule.Since:
+			return fmt.Errorf(
+				"game rule %q requires the data version %d, the world has %d",
+				name, rule.Since, v.DataVersion,
+			)
+		}
+
+		switch rule.Type {
+		case gameRuleBool:
+			if value != "true" && value != "false" {
+				return fmt.Errorf("game rule %q must be true or false", name)
+			}
+		case gameRuleInt:
+			if _, err := strconv.ParseInt(value, 10, 32); err != nil {
+				return fmt.Errorf("game rule %q must be an integer", name)
+			}
+		}
+	}
+	return nil
+}
+
+func readGameRules(worldDir string) (map[string]string, error) {
+	data, err := readLevelDat(worldDir)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string)
+	if rules, ok := data.Compound("GameRules"); ok {
+		for k := range rules {
+			if v, ok := rules.String(k); ok {
+				res[k] = v
+			}
+		}
+	}
+	return res, nil
+}
+
+// writeGameRules sets the rules in the level.dat, it must only be
+// used while the server is not running. The previous file is kept as
+// level.dat_old, like the server does.
+func writeGameRules(worldDir string, rules map[string]string) error {
+	p := path.Join(worldDir, "level.dat")
+
+	file, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	name, root, err := nbt.Decode(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	data, ok := root.Compound("Data")
+	if !ok {
+		return errors.New("level.dat: missing Data compound")
+	}
+
+	current, ok := data.Compound("GameRules")
+	if !ok {
+		current = make(nbt.Compound, len(rules))
+		data["GameRules"] = current
+	}
+	for k, v := range rules {
+		current[k] = v
+	}
+
+	tmp, err := os.CreateTemp(worldDir, ".level.dat-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	err = nbt.Encode(tmp, name, root, nbt.CompressionGzip)
+	if err2 := tmp.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(p, p+"_old"); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), p)
+}
+
+func mergeGameRules(current, rules map[string]string) map[string]string {
+	res := maps.Clone(current)
+	if res == nil {
+		res = make(map[string]string, len(rules))
+	}
+	maps.Copy(res, rules)
+	return res
+}
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+const (
+	serverIconFile = "server-icon.png"
+	serverIconSize = 64
+	// Upper bound of the decoded image dimensions
+	maxIconPixels = 4096 * 4096
+)
+
+// convertIcon decodes the png, jpeg or gif image, crops it to a square
+// and scales it to the size required by the server.
+func convertIcon(data []byte) ([]byte, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidIcon, err)
+	}
+	if config.Width*config.Height > maxIconPixels {
+		return nil, errors.Join(
+			ErrInvalidIcon,
+			errors.New("the image dimensions are too big"),
+		)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Join(ErrInvalidIcon, err)
+	}
+
+	b := src.Bounds()
+	if b.Dx() == 0 || b.Dy() == 0 {
+		return nil, errors.Join(ErrInvalidIcon, errors.New("empty image"))
+	}
+
+	// Already in the right format
+	if format == "png" && b.Dx() == serverIconSize && b.Dy() == serverIconSize {
+		return data, nil
+	}
+
+	side := min(b.Dx(), b.Dy())
+	crop := image.Rect(0, 0, side, side).Add(image.Pt(
+		b.Min.X+(b.Dx()-side)/2,
+		b.Min.Y+(b.Dy()-side)/2,
+	))
+
+	var buf bytes.Buffer
+	if err = png.Encode(&buf, scaleImage(src, crop, serverIconSize)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleImage scales the rect of the image into a size x size image,
+// averaging the source pixels covered by each destination pixel.
+func scaleImage(src image.Image, rect image.Rectangle, size int) *image.NRGBA {
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	side := rect.Dx()
+
+	for y := range size {
+		y0 := rect.Min.Y + y*side/size
+		y1 := max(rect.Min.Y+(y+1)*side/size, y0+1)
+
+		for x := range size {
+			x0 := rect.Min.X + x*side/size
+			x1 := max(rect.Min.X+(x+1)*side/size, x0+1)
+
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// premultiplied alpha, so transparent pixels
+					// do not darken the result
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+uint64(cr), g+uint64(cg), b+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+
+	return dst
+}
+
+func writeServerIcon(dataDir string, icon []byte) error {
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return err
+	}
+
+	p := path.Join(dataDir, serverIconFile)
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, icon, 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// readServerIcon returns the icon of the server encoded as the favicon
+// of the status response, or an empty string if there is none.
+func readServerIcon(dataDir string) string {
+	b, err := os.ReadFile(path.Join(dataDir, serverIconFile))
+	if err != nil {
+		return ""
+	}
+	return iconFavicon(b)
+}
+
+func iconFavicon(icon []byte) string {
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(icon)
+}
@@ -0,0 +1,44 @@
+package runner
+
+import (
+	"net"
+
+	"github.com/zanz1n/mc-manager/config"
+	"github.com/zanz1n/mc-manager/internal/proxy"
+)
+
+// NewInbound returns the settings of the connections accepted by the
+// shared listener and the proxies of the instances.
+func NewInbound(cfg config.ProxyConfig) proxy.Inbound {
+	return proxy.Inbound{
+		ProxyProtocol:  cfg.AcceptProxyProtocol,
+		TrustedProxies: cfg.TrustedProxies,
+		Guard: proxy.NewGuard(proxy.Limits{
+			ConnRate:         cfg.Limits.ConnRate,
+			ConnBurst:        cfg.Limits.ConnBurst,
+			HandshakeRate:    cfg.Limits.HandshakeRate,
+			HandshakeBurst:   cfg.Limits.HandshakeBurst,
+			MaxConns:         cfg.Limits.MaxConns,
+			HandshakeTimeout: cfg.Limits.HandshakeTimeout,
+		}),
+	}
+}
+
+// NewRouter launches the listener shared by the instances, returning
+// nil if it is disabled. The caller must close it.
+func NewRouter(cfg config.ProxyConfig, inbound proxy.Inbound) (*proxy.Router, error) {
+	if cfg.Port == 0 {
+		return nil, nil
+	}
+
+	router, err := proxy.NewRouter(
+		net.TCPAddr{IP: cfg.IP, Port: int(cfg.Port)},
+		inbound,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	go router.Launch()
+	return router, nil
+}
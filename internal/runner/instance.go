@@ -2,6 +2,7 @@ package runner
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"log/slog"
 	"sync"
@@ -24,6 +25,12 @@ const (
 	TiB = GiB * 1024
 )
 
+// The query protocol is used to list the players and plugins
+const (
+	queryInterval = 15 * time.Second
+	queryTimeout  = 2 * time.Second
+)
+
 type Event struct {
 	Type pb.EventType `json:"type"`
 	Data []byte       `json:"data"`
@@ -83,6 +90,20 @@ type InstanceConfig struct {
 
 	AllowPirate bool `json:"allow_pirate"`
 	PVP         bool `json:"pvp"`
+
+	MOTD        string `json:"motd"`
+	OfflineMOTD string `json:"offline_motd"`
+
+	// routed by the shared listener of the node
+	Domains []string `json:"domains"`
+
+	ProxyProtocol    bool   `json:"proxy_protocol"`
+	WhitelistMessage string `json:"whitelist_message"`
+
+	// extra ports forwarded to the server
+	Ports []PortMapping `json:"ports"`
+
+	AcceptTransfers bool `json:"accept_transfers"`
 }
 
 func (i *InstanceConfig) FromPB(data *pb.InstanceConfig) {
@@ -94,6 +115,13 @@ func (i *InstanceConfig) FromPB(data *pb.InstanceConfig) {
 		SimulationDistance: uint8(data.SimulationDistance),
 		AllowPirate:        data.AllowPirate,
 		PVP:                data.Pvp,
+		MOTD:               data.Motd,
+		OfflineMOTD:        data.OfflineMotd,
+		Domains:            data.Domains,
+		ProxyProtocol:      data.ProxyProtocol,
+		WhitelistMessage:   data.WhitelistMessage,
+		Ports:              PortMappingsFromPB(data.Ports),
+		AcceptTransfers:    data.AcceptTransfers,
 	}
 }
 
@@ -106,6 +134,41 @@ func (i *InstanceConfig) IntoPB() *pb.InstanceConfig {
 		SimulationDistance: uint32(i.SimulationDistance),
 		AllowPirate:        i.AllowPirate,
 		Pvp:                i.PVP,
+		Motd:               i.MOTD,
+		OfflineMotd:        i.OfflineMOTD,
+		Domains:            i.Domains,
+		ProxyProtocol:      i.ProxyProtocol,
+		WhitelistMessage:   i.WhitelistMessage,
+		Ports:              PortMappingsIntoPB(i.Ports),
+		AcceptTransfers:    i.AcceptTransfers,
+	}
+}
+
+type WorldSettings struct {
+	Seed              string `json:"seed"`
+	LevelType         string `json:"level_type"`
+	GeneratorSettings string `json:"generator_settings"`
+	Hardcore          bool   `json:"hardcore"`
+	Gamemode          string `json:"gamemode"`
+}
+
+func (w *WorldSettings) FromPB(data *pb.InstanceWorldSettings) {
+	*w = WorldSettings{
+		Seed:              data.GetSeed(),
+		LevelType:         data.GetLevelType(),
+		GeneratorSettings: data.GetGeneratorSettings(),
+		Hardcore:          data.GetHardcore(),
+		Gamemode:          data.GetGamemode(),
+	}
+}
+
+func (w *WorldSettings) IntoPB() *pb.InstanceWorldSettings {
+	return &pb.InstanceWorldSettings{
+		Seed:              w.Seed,
+		LevelType:         w.LevelType,
+		GeneratorSettings: w.GeneratorSettings,
+		Hardcore:          w.Hardcore,
+		Gamemode:          w.Gamemode,
 	}
 }
 
@@ -116,6 +179,9 @@ type InstanceCreateData struct {
 	Version distribution.Version `json:"version"`
 	Limits  InstanceLimits       `json:"limits"`
 	Config  InstanceConfig       `json:"config"`
+
+	WorldSettings WorldSettings     `json:"world_settings"`
+	GameRules     map[string]string `json:"game_rules"`
 }
 
 func newInstance(data InstanceCreateData) (*Instance, error) {
@@ -123,6 +189,9 @@ func newInstance(data InstanceCreateData) (*Instance, error) {
 	if err != nil {
 		return nil, errors.Join(ErrInvalidCreateData, err)
 	}
+	if err = data.Config.validatePorts(); err != nil {
+		return nil, errors.Join(ErrInvalidCreateData, err)
+	}
 
 	now := time.Now().Round(time.Millisecond)
 
@@ -133,8 +202,11 @@ func newInstance(data InstanceCreateData) (*Instance, error) {
 		Version:    data.Version,
 		Limits:     data.Limits,
 		Config:     data.Config,
-		lnLogs:     make(map[chan<- Event]struct{}),
-		ln:         make(map[chan<- Event]struct{}),
+
+		WorldSettings: data.WorldSettings,
+		GameRules:     data.GameRules,
+		lnLogs:        make(map[chan<- Event]struct{}),
+		ln:            make(map[chan<- Event]struct{}),
 	}, nil
 }
 
@@ -150,9 +222,17 @@ type Instance struct {
 	Limits  InstanceLimits
 	Config  InstanceConfig
 
-	state  atomic.Int32
-	proxy  *proxy.Proxy
-	closed atomic.Bool
+	// only applied when the world does not exist
+	WorldSettings WorldSettings
+	// applied when the server is ready
+	GameRules map[string]string
+
+	state    atomic.Int32
+	proxy    *proxy.Proxy
+	forwards []proxy.Forwarder
+	health   atomic.Pointer[Health]
+	query    atomic.Pointer[proxy.QueryFullStat]
+	closed   atomic.Bool
 
 	lnLogs map[chan<- Event]struct{}
 	ln     map[chan<- Event]struct{}
@@ -166,7 +246,12 @@ func (i *Instance) IntoPB() *pb.RunningInstance {
 		players = i.proxy.Players.Load()
 	}
 
-	return &pb.RunningInstance{
+	var health *pb.InstanceHealth
+	if h := i.health.Load(); h != nil {
+		health = h.IntoPB()
+	}
+
+	res := &pb.RunningInstance{
 		Id:          uint64(i.ID),
 		ContainerId: i.ContainerID,
 		LaunchedAt:  timestamppb.New(i.LaunchedAt),
@@ -177,6 +262,30 @@ func (i *Instance) IntoPB() *pb.RunningInstance {
 		Limits:      i.Limits.IntoPB(),
 		Config:      i.Config.IntoPB(),
 		State:       i.GetState(),
+		Health:      health,
+	}
+
+	if query := i.query.Load(); query != nil {
+		res.PlayerNames = query.Players
+		res.Map = query.Map
+		res.GameType = query.GameType
+		res.ServerMod = query.ServerMod
+		res.Plugins = query.Plugins
+	}
+
+	return res
+}
+
+// createData returns the data the instance was launched with.
+func (i *Instance) createData() InstanceCreateData {
+	return InstanceCreateData{
+		ID:            i.ID,
+		Name:          i.Name,
+		Version:       i.Version,
+		Limits:        i.Limits,
+		Config:        i.Config,
+		WorldSettings: i.WorldSettings,
+		GameRules:     i.GameRules,
 	}
 }
 
@@ -198,6 +307,40 @@ func (i *Instance) SendCommand(cmd string) error {
 	return err
 }
 
+// SendCommandWait sends the command and waits until a log line
+// containing any of the matches is printed by the server.
+func (i *Instance) SendCommandWait(ctx context.Context, cmd string, matches ...[]byte) error {
+	_, err := i.SendCommandReply(ctx, cmd, matches...)
+	return err
+}
+
+// SendCommandReply is like SendCommandWait, but returns the log line
+// containing the match.
+func (i *Instance) SendCommandReply(ctx context.Context, cmd string, matches ...[]byte) ([]byte, error) {
+	ch := i.AttachListener(true)
+	defer i.DetachListener(ch)
+
+	if err := i.SendCommand(cmd); err != nil {
+		return nil, err
+	}
+
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return nil, ErrInstanceNotFound
+			}
+			for _, match := range matches {
+				if bytes.Contains(e.Data, match) {
+					return e.Data, nil
+				}
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
 func (i *Instance) AttachListener(logs bool) chan Event {
 	i.mu.Lock()
 	defer i.mu.Unlock()
@@ -268,6 +411,9 @@ func (i *Instance) SendEvent(e Event) {
 func (i *Instance) launch() {
 	i.Launched.Store(true)
 	go i.proxy.Launch()
+	for _, f := range i.forwards {
+		go f.Launch()
+	}
 	go i.backgroundLogs()
 	go i.loadProxyServerData()
 }
@@ -334,6 +480,8 @@ func (i *Instance) checkForReadyLog(line []byte) (available bool) {
 			i.proxy.Active.Store(true)
 			i.SetState(pb.InstanceState_STATE_RUNNING)
 			i.SendEvent(Event{Type: pb.EventType_EVENT_AVAILABLE})
+			go i.applyGameRules()
+			go i.pollQuery()
 
 			slog.Info(
 				"Instance: Minecraft server ready",
@@ -346,7 +494,41 @@ func (i *Instance) checkForReadyLog(line []byte) (available bool) {
 	return
 }
 
+// pollQuery requests the full stat of the server periodically, until
+// the instance is closed.
+func (i *Instance) pollQuery() {
+	for !i.closed.Load() {
+		stat, err := i.proxy.Query(queryTimeout)
+		if err != nil {
+			slog.Debug("Instance: Failed to query server", "id", i.ID, "error", err)
+			i.query.Store(nil)
+		} else {
+			i.query.Store(&stat)
+		}
+
+		time.Sleep(queryInterval)
+	}
+}
+
+// applyGameRules sets the desired game rules through the console, so
+// they are kept even if the world was regenerated.
+func (i *Instance) applyGameRules() {
+	for name, value := range i.GameRules {
+		if err := i.SendCommand("gamerule " + name + " " + value); err != nil {
+			slog.Warn(
+				"Instance: Failed to apply game rule",
+				"id", i.ID,
+				"rule", name,
+				"error", err,
+			)
+			return
+		}
+	}
+}
+
 func (i *Instance) close() {
+	i.closed.Store(true)
+
 	if err := i.proxy.Close(); err != nil {
 		slog.Warn(
 			"Instance: Failed to close proxy",
@@ -354,6 +536,15 @@ func (i *Instance) close() {
 			"error", err,
 		)
 	}
+	for _, f := range i.forwards {
+		if err := f.Close(); err != nil {
+			slog.Warn(
+				"Instance: Failed to close forwarded port",
+				"id", i.ID,
+				"error", err,
+			)
+		}
+	}
 
 	// i.stream.Close()
 
@@ -0,0 +1,158 @@
+package runner
+
+import (
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"github.com/zanz1n/mc-manager/internal/proxy"
+)
+
+// Time the player lists are cached by the login filter, the server
+// writes the files right after they are edited through the console
+const playerAccessTTL = 5 * time.Second
+
+// playerAccess checks the logins received by the proxy against the
+// whitelist and the ban lists of the server, so the rejected players
+// never reach it.
+type playerAccess struct {
+	dataDir          string
+	whitelistMessage string
+
+	loadedAt   time.Time
+	whitelist  bool
+	onlineMode bool
+	allowed    []PlayerListEntry
+	banned     []PlayerListEntry
+	bannedIPs  []PlayerListEntry
+	mu         sync.Mutex
+}
+
+func newPlayerAccess(dataDir string, whitelistMessage string) *playerAccess {
+	return &playerAccess{
+		dataDir:          dataDir,
+		whitelistMessage: whitelistMessage,
+	}
+}
+
+// Filter implements proxy.LoginFilter. The messages match the ones
+// of the vanilla server.
+func (a *playerAccess) Filter(login proxy.ServerBoundLoginStart, addr net.Addr) (proxy.Component, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if time.Since(a.loadedAt) > playerAccessTTL {
+		// Failures are left for the server to handle
+		if err := a.load(); err != nil {
+			return proxy.Component{}, true
+		}
+	}
+	now := time.Now()
+
+	if ip := addrIP(addr); ip.IsValid() {
+		for _, ban := range a.bannedIPs {
+			entry, err := netip.ParseAddr(ban.IP)
+			if err == nil && entry.Unmap() == ip && !isBanExpired(ban, now) {
+				return banMessage("Your IP address is banned from this server.", ban), false
+			}
+		}
+	}
+
+	for _, ban := range a.banned {
+		if a.matches(ban, login) && !isBanExpired(ban, now) {
+			return banMessage("You are banned from this server.", ban), false
+		}
+	}
+
+	if a.whitelist {
+		for _, entry := range a.allowed {
+			if a.matches(entry, login) {
+				return proxy.Component{}, true
+			}
+		}
+
+		if a.whitelistMessage != "" {
+			return proxy.ParseText(a.whitelistMessage), false
+		}
+		return proxy.Text("You are not white-listed on this server!"), false
+	}
+
+	return proxy.Component{}, true
+}
+
+// matches compares the uuids when the server is in online mode, since
+// the names can change. Offline servers use uuids derived from the
+// names, which the clients do not send.
+func (a *playerAccess) matches(entry PlayerListEntry, login proxy.ServerBoundLoginStart) bool {
+	if a.onlineMode && login.UUID != uuid.Nil && entry.UUID != uuid.Nil {
+		return entry.UUID == login.UUID
+	}
+	return strings.EqualFold(entry.Name, login.Name)
+}
+
+func (a *playerAccess) load() error {
+	config, err := readMcPropertiesFile(a.dataDir)
+	if err != nil {
+		return err
+	}
+
+	a.whitelist = false
+	if v, _ := config.Get("white-list"); v == "true" {
+		a.whitelist = true
+	}
+	a.onlineMode = isOnlineMode(config)
+
+	whitelist, err := readPlayerList(a.dataDir, pb.PlayerList_PLAYER_LIST_WHITELIST)
+	if err != nil {
+		return err
+	}
+	// The operators bypass the whitelist
+	ops, err := readPlayerList(a.dataDir, pb.PlayerList_PLAYER_LIST_OPS)
+	if err != nil {
+		return err
+	}
+	a.allowed = append(whitelist, ops...)
+
+	a.banned, err = readPlayerList(a.dataDir, pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS)
+	if err != nil {
+		return err
+	}
+	a.bannedIPs, err = readPlayerList(a.dataDir, pb.PlayerList_PLAYER_LIST_BANNED_IPS)
+	if err != nil {
+		return err
+	}
+
+	a.loadedAt = time.Now()
+	return nil
+}
+
+func isBanExpired(ban PlayerListEntry, now time.Time) bool {
+	return !ban.ExpiresAt.IsZero() && ban.ExpiresAt.Before(now)
+}
+
+func banMessage(title string, ban PlayerListEntry) proxy.Component {
+	c := proxy.Text(title)
+	if ban.Reason != "" {
+		c = c.Append(proxy.Text("\nReason: " + ban.Reason))
+	}
+	if !ban.ExpiresAt.IsZero() {
+		c = c.Append(proxy.Text(
+			"\nYour ban will be removed on " + ban.ExpiresAt.Format(mcDateFormat),
+		))
+	}
+	return c
+}
+
+func addrIP(addr net.Addr) netip.Addr {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return netip.Addr{}
+	}
+
+	ip, _ := netip.AddrFromSlice(tcp.IP)
+	return ip.Unmap()
+}
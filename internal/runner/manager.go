@@ -1,26 +1,42 @@
 package runner
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"log/slog"
+	"os"
+	"path"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/config"
 	"github.com/zanz1n/mc-manager/internal/dto"
+	"github.com/zanz1n/mc-manager/internal/pb"
 )
 
 type Manager struct {
 	m  map[dto.Snowflake]*Instance
 	mu sync.RWMutex
 
-	rt Runtime
+	// serializes the edits of the instance files
+	fmu sync.Mutex
+
+	rt      Runtime
+	uuids   *uuidResolver
+	monitor config.MonitorConfig
 }
 
-func NewManager(rt Runtime) *Manager {
+func NewManager(rt Runtime, monitor config.MonitorConfig) *Manager {
 	return &Manager{
-		m:  make(map[dto.Snowflake]*Instance),
-		rt: rt,
+		m:       make(map[dto.Snowflake]*Instance),
+		rt:      rt,
+		uuids:   newUUIDResolver(nil),
+		monitor: monitorDefaults(monitor),
 	}
 }
 
@@ -38,7 +54,9 @@ func (m *Manager) Launch(ctx context.Context, data InstanceCreateData) (*Instanc
 	if err != nil {
 		return nil, err
 	}
-	m.insert(i)
+	if err = m.insert(i); err != nil {
+		return nil, err
+	}
 
 	err = m.rt.Create(ctx, i)
 	if err != nil {
@@ -51,6 +69,8 @@ func (m *Manager) Launch(ctx context.Context, data InstanceCreateData) (*Instanc
 		return nil, err
 	}
 
+	m.opAdmin(ctx, i)
+
 	err = m.rt.Launch(ctx, i)
 	if err != nil {
 		m.remove(i.ID)
@@ -69,6 +89,10 @@ func (m *Manager) Launch(ctx context.Context, data InstanceCreateData) (*Instanc
 		"took", time.Since(start).Round(time.Microsecond),
 	)
 
+	if m.monitor.Interval > 0 {
+		go m.monitorInstance(i)
+	}
+
 	return i, nil
 }
 
@@ -107,6 +131,18 @@ func (m *Manager) GetMany(ctx context.Context, ids []uint64) ([]*Instance, error
 	return instances, nil
 }
 
+// GetAll returns the instances of the node, in no particular order.
+func (m *Manager) GetAll(ctx context.Context) []*Instance {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	instances := make([]*Instance, 0, len(m.m))
+	for _, i := range m.m {
+		instances = append(instances, i)
+	}
+	return instances
+}
+
 func (m *Manager) Stop(ctx context.Context, id dto.Snowflake) error {
 	start := time.Now()
 
@@ -135,11 +171,16 @@ func (m *Manager) Stop(ctx context.Context, id dto.Snowflake) error {
 	return err
 }
 
-func (m *Manager) insert(i *Instance) {
+func (m *Manager) insert(i *Instance) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	if err := m.checkPorts(i); err != nil {
+		return err
+	}
+
 	m.m[i.ID] = i
+	return nil
 }
 
 func (m *Manager) remove(id dto.Snowflake) (*Instance, bool) {
@@ -153,3 +194,845 @@ func (m *Manager) remove(id dto.Snowflake) (*Instance, bool) {
 
 	return i, ok
 }
+
+// WorldVersion reads the version of the instance world, the
+// instance does not need to be running.
+func (m *Manager) WorldVersion(ctx context.Context, id dto.Snowflake) (WorldVersion, error) {
+	v, err := readWorldVersion(m.rt.DataDir(id))
+	if err != nil {
+		return WorldVersion{}, errors.Join(ErrWorldRead, err)
+	}
+	return v, nil
+}
+
+// Backup archives the instance data directory. If the instance is
+// running, saving is disabled while the files are copied.
+func (m *Manager) Backup(ctx context.Context, id dto.Snowflake, reason string) (Backup, error) {
+	start := time.Now()
+
+	resume, err := m.pauseSaving(ctx, id)
+	if err != nil {
+		return Backup{}, errors.Join(ErrBackup, err)
+	}
+	defer resume()
+
+	b, err := createBackup(ctx, m.rt.DataDir(id), m.rt.BackupDir(id), reason)
+	if err != nil {
+		slog.Error(
+			"Manager: Failed to backup instance",
+			"id", id,
+			"took", time.Since(start).Round(time.Millisecond),
+			"error", err,
+		)
+		return Backup{}, errors.Join(ErrBackup, err)
+	}
+
+	slog.Info(
+		"Manager: Created instance backup",
+		"id", id,
+		"name", b.Name,
+		"size", b.Size,
+		"took", time.Since(start).Round(time.Millisecond),
+	)
+
+	return b, nil
+}
+
+func (m *Manager) GetProperties(ctx context.Context, id dto.Snowflake) ([]Property, error) {
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	config, err := readMcPropertiesFile(m.rt.DataDir(id))
+	if err != nil {
+		return nil, errors.Join(ErrProperties, err)
+	}
+	return config.All(), nil
+}
+
+// PatchProperties sets and removes the given keys, keeping the rest
+// of the file untouched. Managed keys can not be changed.
+func (m *Manager) PatchProperties(
+	ctx context.Context,
+	id dto.Snowflake,
+	set map[string]string,
+	unset []string,
+) ([]Property, error) {
+	for k, v := range set {
+		if err := validateProperty(k, v); err != nil {
+			return nil, errors.Join(ErrInvalidProperty, err)
+		}
+	}
+	for _, k := range unset {
+		if reason, ok := managedProperties[k]; ok {
+			return nil, errors.Join(
+				ErrInvalidProperty,
+				fmt.Errorf("property %q is %s", k, reason),
+			)
+		}
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	config, err := readMcPropertiesFile(dataDir)
+	if err != nil {
+		return nil, errors.Join(ErrProperties, err)
+	}
+
+	for _, k := range unset {
+		config.Delete(k)
+	}
+	for k, v := range set {
+		config.Set(k, v)
+	}
+
+	if err = os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return nil, errors.Join(ErrProperties, err)
+	}
+	if err = writeMcPropertiesFile(dataDir, config); err != nil {
+		return nil, errors.Join(ErrProperties, err)
+	}
+
+	slog.Info(
+		"Manager: Patched instance properties",
+		"id", id,
+		"set", len(set),
+		"unset", len(unset),
+	)
+
+	return config.All(), nil
+}
+
+func (m *Manager) GetPlayerList(
+	ctx context.Context,
+	id dto.Snowflake,
+	list pb.PlayerList,
+) ([]PlayerListEntry, error) {
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	entries, err := readPlayerList(m.rt.DataDir(id), list)
+	if err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+	return entries, nil
+}
+
+// AddToPlayerList adds the player to the list through the console if
+// the instance is running, editing the list file otherwise. Operators
+// with a level other than the server default can only be added while
+// the instance is stopped.
+func (m *Manager) AddToPlayerList(
+	ctx context.Context,
+	id dto.Snowflake,
+	c PlayerListChange,
+) ([]PlayerListEntry, error) {
+	if err := c.Validate(); err != nil {
+		return nil, errors.Join(ErrInvalidPlayerList, err)
+	}
+
+	if i, err := m.GetById(ctx, id); err == nil && i.GetState() == pb.InstanceState_STATE_RUNNING {
+		if c.List == pb.PlayerList_PLAYER_LIST_OPS && c.Level != 0 {
+			if err = m.checkOpLevel(id, c.Level); err != nil {
+				return nil, err
+			}
+		}
+		cmd, matches := c.addCommand()
+		if err = m.sendPlayerListCommand(ctx, i, cmd, matches); err != nil {
+			return nil, err
+		}
+		return m.GetPlayerList(ctx, id, c.List)
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	config, err := readMcPropertiesFile(dataDir)
+	if err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+
+	var uid uuid.UUID
+	if c.List != pb.PlayerList_PLAYER_LIST_BANNED_IPS {
+		uid, c.Name, err = m.uuids.Resolve(ctx, c.Name, isOnlineMode(config))
+		if err != nil {
+			return nil, errors.Join(ErrUUIDResolve, err)
+		}
+	}
+
+	if c.List == pb.PlayerList_PLAYER_LIST_OPS && c.Level == 0 {
+		c.Level = getDefaultOpLevel(config)
+	}
+
+	if err = os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+	if err = addToPlayerList(dataDir, c, uid); err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+
+	slog.Info(
+		"Manager: Added to player list",
+		"id", id,
+		"list", c.List,
+		"name", c.Name,
+	)
+
+	entries, err := readPlayerList(dataDir, c.List)
+	if err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+	return entries, nil
+}
+
+// RemoveFromPlayerList removes the player from the list through the
+// console if the instance is running, editing the list file otherwise.
+func (m *Manager) RemoveFromPlayerList(
+	ctx context.Context,
+	id dto.Snowflake,
+	c PlayerListChange,
+) ([]PlayerListEntry, error) {
+	if err := c.Validate(); err != nil {
+		return nil, errors.Join(ErrInvalidPlayerList, err)
+	}
+
+	if i, err := m.GetById(ctx, id); err == nil && i.GetState() == pb.InstanceState_STATE_RUNNING {
+		cmd, matches := c.removeCommand()
+		if err = m.sendPlayerListCommand(ctx, i, cmd, matches); err != nil {
+			return nil, err
+		}
+		return m.GetPlayerList(ctx, id, c.List)
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	if err := removeFromPlayerList(dataDir, c); err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+
+	slog.Info(
+		"Manager: Removed from player list",
+		"id", id,
+		"list", c.List,
+		"name", c.Name,
+	)
+
+	entries, err := readPlayerList(dataDir, c.List)
+	if err != nil {
+		return nil, errors.Join(ErrPlayerList, err)
+	}
+	return entries, nil
+}
+
+// checkOpLevel rejects the levels other than the op-permission-level of
+// the server, since the op console command always uses it and the
+// server only reads the levels of ops.json when launched.
+func (m *Manager) checkOpLevel(id dto.Snowflake, level uint8) error {
+	m.fmu.Lock()
+	config, err := readMcPropertiesFile(m.rt.DataDir(id))
+	m.fmu.Unlock()
+	if err != nil {
+		return errors.Join(ErrPlayerList, err)
+	}
+
+	if level != getDefaultOpLevel(config) {
+		return ErrOpLevelRunning
+	}
+	return nil
+}
+
+func (m *Manager) sendPlayerListCommand(
+	ctx context.Context,
+	i *Instance,
+	cmd string,
+	matches [][]byte,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	err := i.SendCommandWait(ctx, cmd, append(matches, playerListReplies...)...)
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	// The server may not reply in the expected format, the list
+	// file is returned anyway
+	if err != nil {
+		slog.Warn(
+			"Manager: Player list command reply not received",
+			"id", i.ID,
+			"command", cmd,
+		)
+	}
+	return nil
+}
+
+// opAdmin adds the instance admin to the ops list before the server is
+// launched. Failures are only logged, so the instance can still start.
+func (m *Manager) opAdmin(ctx context.Context, i *Instance) {
+	if i.Config.Admin == "" {
+		return
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(i.ID)
+
+	ops, err := readPlayerList(dataDir, pb.PlayerList_PLAYER_LIST_OPS)
+	if err == nil {
+		for _, op := range ops {
+			if strings.EqualFold(op.Name, i.Config.Admin) {
+				return
+			}
+		}
+
+		var uid uuid.UUID
+		c := PlayerListChange{List: pb.PlayerList_PLAYER_LIST_OPS, Level: 4}
+
+		uid, c.Name, err = m.uuids.Resolve(ctx, i.Config.Admin, !i.Config.AllowPirate)
+		if err == nil {
+			err = addToPlayerList(dataDir, c, uid)
+		}
+	}
+
+	if err != nil {
+		slog.Warn(
+			"Manager: Failed to op instance admin",
+			"id", i.ID,
+			"admin", i.Config.Admin,
+			"error", err,
+		)
+	}
+}
+
+// ResetWorld backups the instance and deletes the world, so a new one
+// is generated in the next launch. The instance must be stopped.
+func (m *Manager) ResetWorld(ctx context.Context, id dto.Snowflake, reason string) (Backup, error) {
+	if _, err := m.GetById(ctx, id); err == nil {
+		return Backup{}, ErrInstanceRunning
+	}
+
+	// Never launched, there is nothing to reset
+	if _, err := os.Stat(m.rt.DataDir(id)); errors.Is(err, os.ErrNotExist) {
+		return Backup{}, nil
+	}
+
+	b, err := m.Backup(ctx, id, reason)
+	if err != nil {
+		return Backup{}, err
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return Backup{}, errors.Join(ErrFileSystem, err)
+	}
+
+	for _, dir := range worldDirs(dataDir, levelName) {
+		if err = os.RemoveAll(dir); err != nil {
+			return Backup{}, errors.Join(ErrFileSystem, err)
+		}
+	}
+
+	slog.Info(
+		"Manager: Reset instance world",
+		"id", id,
+		"level_name", levelName,
+		"backup", b.Name,
+	)
+
+	return b, nil
+}
+
+// pauseSaving flushes the world and disables the automatic saving if
+// the instance is running, returning the function that enables it.
+func (m *Manager) pauseSaving(ctx context.Context, id dto.Snowflake) (func(), error) {
+	i, err := m.GetById(ctx, id)
+	if err != nil || i.GetState() != pb.InstanceState_STATE_RUNNING {
+		return func() {}, nil
+	}
+
+	if err = i.SendCommand("save-off"); err != nil {
+		return nil, err
+	}
+	resume := func() { i.SendCommand("save-on") }
+
+	saveCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	err = i.SendCommandWait(saveCtx, "save-all flush", []byte("Saved the game"))
+	if err != nil {
+		resume()
+		return nil, err
+	}
+
+	return resume, nil
+}
+
+func (m *Manager) GetWorlds(ctx context.Context, id dto.Snowflake) ([]World, error) {
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	worlds, err := listWorlds(m.rt.DataDir(id))
+	if err != nil {
+		return nil, errors.Join(ErrWorldRead, err)
+	}
+	return worlds, nil
+}
+
+// UploadWorld extracts the zipped world as a new named world of the
+// instance, optionally switching the level-name to it.
+func (m *Manager) UploadWorld(
+	ctx context.Context,
+	id dto.Snowflake,
+	name string,
+	activate bool,
+	r io.Reader,
+) (World, error) {
+	start := time.Now()
+
+	if !worldNameRegex.MatchString(name) {
+		return World{}, errors.Join(
+			ErrInvalidWorld,
+			fmt.Errorf("invalid world name %q", name),
+		)
+	}
+
+	if _, err := m.GetById(ctx, id); err == nil && activate {
+		return World{}, ErrInstanceRunning
+	}
+
+	dataDir := m.rt.DataDir(id)
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return World{}, errors.Join(ErrFileSystem, err)
+	}
+
+	if _, err := os.Stat(path.Join(dataDir, name)); err == nil {
+		return World{}, errors.Join(ErrWorldExists, errors.New(name))
+	}
+
+	file, err := os.CreateTemp(dataDir, ".upload-*")
+	if err != nil {
+		return World{}, errors.Join(ErrFileSystem, err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	n, err := io.Copy(file, io.LimitReader(r, maxWorldUploadSize+1))
+	if err != nil {
+		return World{}, err
+	}
+	if n > maxWorldUploadSize {
+		return World{}, errors.Join(
+			ErrInvalidWorld,
+			fmt.Errorf("the archive is bigger than %d bytes", maxWorldUploadSize),
+		)
+	}
+
+	if err = file.Close(); err != nil {
+		return World{}, errors.Join(ErrFileSystem, err)
+	}
+
+	tmpDir, err := os.MkdirTemp(dataDir, ".world-*")
+	if err != nil {
+		return World{}, errors.Join(ErrFileSystem, err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	tmpDirs := worldDirs(tmpDir, name)
+	if err = extractWorld(ctx, file.Name(), tmpDirs); err != nil {
+		return World{}, err
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dirs := worldDirs(dataDir, name)
+	for _, dir := range dirs {
+		if _, err = os.Stat(dir); err == nil {
+			return World{}, errors.Join(ErrWorldExists, errors.New(path.Base(dir)))
+		}
+	}
+
+	for i, dir := range tmpDirs {
+		if _, err = os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err = os.Rename(dir, dirs[i]); err != nil {
+			return World{}, errors.Join(ErrFileSystem, err)
+		}
+	}
+	worldDir := dirs[0]
+
+	if activate {
+		if err = setLevelName(dataDir, name); err != nil {
+			return World{}, errors.Join(ErrFileSystem, err)
+		}
+	}
+
+	v, err := readWorldDirVersion(worldDir)
+	if err != nil {
+		return World{}, errors.Join(ErrWorldRead, err)
+	}
+
+	slog.Info(
+		"Manager: Uploaded world",
+		"id", id,
+		"name", name,
+		"size", n,
+		"took", time.Since(start).Round(time.Millisecond),
+	)
+
+	return World{
+		Name:    name,
+		Active:  activate,
+		Size:    dirSize(worldDir),
+		Version: v,
+	}, nil
+}
+
+// DownloadWorld writes the zipped world into w, the active
+// world is used if the name is empty.
+func (m *Manager) DownloadWorld(
+	ctx context.Context,
+	id dto.Snowflake,
+	name string,
+	w io.Writer,
+) error {
+	dataDir := m.rt.DataDir(id)
+
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return errors.Join(ErrWorldRead, err)
+	}
+
+	if name, err = resolveWorldName(dataDir, name); err != nil {
+		return err
+	}
+
+	if _, err = readLevelDat(path.Join(dataDir, name)); err != nil {
+		return errors.Join(ErrWorldNotFound, errors.New(name))
+	}
+
+	if name == levelName {
+		resume, err := m.pauseSaving(ctx, id)
+		if err != nil {
+			return errors.Join(ErrWorldRead, err)
+		}
+		defer resume()
+	}
+
+	return zipWorld(ctx, w, dataDir, name)
+}
+
+// SwitchWorld changes the level-name of the instance. If the world
+// does not exist, a new one is generated in the next launch.
+func (m *Manager) SwitchWorld(ctx context.Context, id dto.Snowflake, name string) ([]World, error) {
+	if !worldNameRegex.MatchString(name) {
+		return nil, errors.Join(
+			ErrInvalidWorld,
+			fmt.Errorf("invalid world name %q", name),
+		)
+	}
+
+	if _, err := m.GetById(ctx, id); err == nil {
+		return nil, ErrInstanceRunning
+	}
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		return nil, errors.Join(ErrFileSystem, err)
+	}
+	if err := setLevelName(dataDir, name); err != nil {
+		return nil, errors.Join(ErrFileSystem, err)
+	}
+
+	slog.Info("Manager: Switched world", "id", id, "name", name)
+
+	worlds, err := listWorlds(dataDir)
+	if err != nil {
+		return nil, errors.Join(ErrWorldRead, err)
+	}
+	return worlds, nil
+}
+
+func (m *Manager) GetWorldInfo(ctx context.Context, id dto.Snowflake, name string) (WorldInfo, error) {
+	dataDir := m.rt.DataDir(id)
+
+	name, err := resolveWorldName(dataDir, name)
+	if err != nil {
+		return WorldInfo{}, err
+	}
+
+	info, err := readWorldInfo(path.Join(dataDir, name))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return WorldInfo{}, errors.Join(ErrWorldNotFound, errors.New(name))
+		}
+		return WorldInfo{}, errors.Join(ErrWorldRead, err)
+	}
+	return info, nil
+}
+
+// GetPlayerData reads the saved data of the players in the world,
+// or only of the player with the given uuid if it is not empty.
+func (m *Manager) GetPlayerData(
+	ctx context.Context,
+	id dto.Snowflake,
+	world string,
+	playerId string,
+) ([]PlayerData, error) {
+	dataDir := m.rt.DataDir(id)
+
+	world, err := resolveWorldName(dataDir, world)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := uuid.Nil
+	if playerId != "" {
+		if filter, err = uuid.Parse(playerId); err != nil {
+			return nil, errors.Join(ErrInvalidUUID, err)
+		}
+	}
+
+	players, err := readPlayerData(dataDir, path.Join(dataDir, world), filter)
+	if err != nil {
+		return nil, errors.Join(ErrWorldRead, err)
+	}
+	return players, nil
+}
+
+// GetGameRules reads the game rules of the active world, flushing it
+// first if the instance is running.
+func (m *Manager) GetGameRules(ctx context.Context, id dto.Snowflake) (map[string]string, error) {
+	resume, err := m.pauseSaving(ctx, id)
+	if err != nil {
+		return nil, errors.Join(ErrGameRules, err)
+	}
+	resume()
+
+	m.fmu.Lock()
+	defer m.fmu.Unlock()
+
+	dataDir := m.rt.DataDir(id)
+
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return nil, errors.Join(ErrGameRules, err)
+	}
+
+	rules, err := readGameRules(path.Join(dataDir, levelName))
+	if err != nil {
+		// Not generated yet
+		if errors.Is(err, os.ErrNotExist) {
+			return map[string]string{}, nil
+		}
+		return nil, errors.Join(ErrGameRules, err)
+	}
+	return rules, nil
+}
+
+// SetGameRules validates and applies the game rules through the console
+// if the instance is running, or in the level.dat otherwise. Nothing is
+// changed if the world was not generated yet.
+func (m *Manager) SetGameRules(
+	ctx context.Context,
+	id dto.Snowflake,
+	rules map[string]string,
+) (map[string]string, error) {
+	m.fmu.Lock()
+
+	worldDir, exists, current, err := m.checkGameRules(id, rules)
+	if err != nil {
+		m.fmu.Unlock()
+		return nil, err
+	}
+
+	i, err := m.GetById(ctx, id)
+	if err != nil {
+		defer m.fmu.Unlock()
+
+		if exists {
+			if err = writeGameRules(worldDir, rules); err != nil {
+				return nil, errors.Join(ErrGameRules, err)
+			}
+		}
+		return mergeGameRules(current, rules), nil
+	}
+
+	// The commands may take a while to be answered, the files are not
+	// touched anymore
+	m.fmu.Unlock()
+
+	if i.GetState() != pb.InstanceState_STATE_RUNNING {
+		return nil, ErrInstanceNotReady
+	}
+
+	for name, value := range rules {
+		err = m.sendGameRuleCommand(ctx, i, name, value)
+		if err != nil {
+			return nil, errors.Join(ErrGameRules, err)
+		}
+	}
+
+	return mergeGameRules(current, rules), nil
+}
+
+// checkGameRules reads the current game rules of the world and validates
+// the changes against them. Must be called with fmu held.
+func (m *Manager) checkGameRules(
+	id dto.Snowflake,
+	rules map[string]string,
+) (worldDir string, exists bool, current map[string]string, err error) {
+	dataDir := m.rt.DataDir(id)
+
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return "", false, nil, errors.Join(ErrGameRules, err)
+	}
+	worldDir = path.Join(dataDir, levelName)
+
+	v, err := readWorldDirVersion(worldDir)
+	if err != nil {
+		return "", false, nil, errors.Join(ErrGameRules, err)
+	}
+
+	current = map[string]string{}
+	if v.Exists {
+		if current, err = readGameRules(worldDir); err != nil {
+			return "", false, nil, errors.Join(ErrGameRules, err)
+		}
+	}
+
+	if err = validateGameRules(rules, v, current); err != nil {
+		return "", false, nil, errors.Join(ErrInvalidGameRule, err)
+	}
+	return worldDir, v.Exists, current, nil
+}
+
+func (m *Manager) sendGameRuleCommand(
+	ctx context.Context,
+	i *Instance,
+	name string,
+	value string,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cmd := "gamerule " + name + " " + value
+
+	err := i.SendCommandWait(ctx, cmd, []byte("Gamerule "+name))
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn(
+			"Manager: Game rule command reply not received",
+			"id", i.ID,
+			"command", cmd,
+		)
+		return nil
+	}
+	return err
+}
+
+// SetIcon converts the image into the server icon, updating the
+// proxy if the instance is running.
+func (m *Manager) SetIcon(ctx context.Context, id dto.Snowflake, data []byte) error {
+	icon, err := convertIcon(data)
+	if err != nil {
+		return err
+	}
+
+	m.fmu.Lock()
+	err = writeServerIcon(m.rt.DataDir(id), icon)
+	m.fmu.Unlock()
+
+	if err != nil {
+		return errors.Join(ErrFileSystem, err)
+	}
+
+	if i, err := m.GetById(ctx, id); err == nil && i.proxy != nil {
+		i.proxy.SetFavIcon(iconFavicon(icon))
+	}
+	return nil
+}
+
+// TransferPlayer sends the player, or all the players with @a, to
+// another server with the transfer command.
+func (m *Manager) TransferPlayer(
+	ctx context.Context,
+	id dto.Snowflake,
+	player string,
+	host string,
+	port uint16,
+) error {
+	if player != "@a" && !playerNameRegex.MatchString(player) {
+		return errors.Join(
+			ErrInvalidTransfer,
+			fmt.Errorf("invalid player name %q", player),
+		)
+	}
+	if host == "" || strings.ContainsAny(host, " \t\r\n") {
+		return errors.Join(ErrInvalidTransfer, fmt.Errorf("invalid host %q", host))
+	}
+
+	i, err := m.GetById(ctx, id)
+	if err != nil {
+		return err
+	}
+	if i.GetState() != pb.InstanceState_STATE_RUNNING {
+		return ErrInstanceNotReady
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+
+	cmd := fmt.Sprintf("transfer %s %d %s", host, port, player)
+
+	reply, err := i.SendCommandReply(ctx, cmd,
+		[]byte("Transferring "),
+		[]byte("No player was found"),
+		[]byte("Unknown or incomplete command"),
+	)
+	if errors.Is(err, context.DeadlineExceeded) {
+		slog.Warn(
+			"Manager: Transfer command reply not received",
+			"id", id,
+			"command", cmd,
+		)
+		return errors.Join(ErrTransferTimeout, err)
+	} else if err != nil {
+		return err
+	}
+
+	switch {
+	case bytes.Contains(reply, []byte("No player was found")):
+		return errors.Join(ErrPlayerNotFound, errors.New(player))
+	case bytes.Contains(reply, []byte("Unknown or incomplete command")):
+		return ErrTransferUnsupported
+	}
+
+	slog.Info(
+		"Manager: Transferred player",
+		"id", id,
+		"player", player,
+		"host", host,
+		"port", port,
+	)
+	return nil
+}
@@ -1,15 +1,16 @@
 package runner
 
 import (
-	"bufio"
 	"errors"
-	"io"
+	"fmt"
 	"os"
 	"path"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/proxy"
 )
 
 type mcOperator struct {
@@ -25,29 +26,19 @@ func sanitizeEula(dataDir string) error {
 }
 
 func sanitizeMcProperties(dataDir string, instance *Instance) error {
-	filePath := path.Join(dataDir, "server.properties")
-	file, err := os.Open(filePath)
-
-	config := make(map[string]string)
+	config, err := readMcPropertiesFile(dataDir)
 	if err != nil {
-		if !errors.Is(err, os.ErrNotExist) {
-			return err
-		}
-	} else {
-		config, err = readMcProperties(file)
-		if err != nil {
-			return err
-		}
+		return err
 	}
 
 	if instance.Config.Difficulty != "" {
-		config["difficulty"] = instance.Config.Difficulty
+		config.Set("difficulty", instance.Config.Difficulty)
 	} else {
-		config["difficulty"] = "easy"
+		config.Set("difficulty", "easy")
 	}
 
 	if instance.Limits.MaxPlayers != 0 {
-		config["max-players"] = strconv.Itoa(int(instance.Limits.MaxPlayers))
+		config.Set("max-players", strconv.Itoa(int(instance.Limits.MaxPlayers)))
 	}
 
 	if instance.Config.ViewDistance == 0 {
@@ -57,59 +48,172 @@ func sanitizeMcProperties(dataDir string, instance *Instance) error {
 		instance.Config.SimulationDistance = 7
 	}
 
-	config["motd"] = instance.Name
+	if instance.Config.MOTD != "" {
+		config.Set("motd", proxy.ParseText(instance.Config.MOTD).Legacy())
+	} else {
+		config.Set("motd", instance.Name)
+	}
 
-	config["view-distance"] = strconv.Itoa(int(instance.Config.ViewDistance))
-	config["simulation-distance"] = strconv.Itoa(int(instance.Config.SimulationDistance))
+	config.Set("view-distance", strconv.Itoa(int(instance.Config.ViewDistance)))
+	config.Set("simulation-distance", strconv.Itoa(int(instance.Config.SimulationDistance)))
 
-	config["online-mode"] = strconv.FormatBool(!instance.Config.AllowPirate)
-	config["query.port"] = strconv.Itoa(int(instance.Config.Port))
-	config["spawn-protection"] = "0"
+	config.Set("online-mode", strconv.FormatBool(!instance.Config.AllowPirate))
+	config.Set("server-port", strconv.Itoa(int(instance.Config.Port)))
+	// Used by the runner to list the players and plugins
+	config.Set("enable-query", "true")
+	config.Set("query.port", strconv.Itoa(int(instance.Config.Port)))
+	config.Set("accepts-transfers", strconv.FormatBool(instance.Config.AcceptTransfers))
+	config.SetDefault("spawn-protection", "0")
 
-	file, err = os.Create(filePath)
-	if err != nil {
-		return err
+	levelName, _ := config.Get("level-name")
+	if levelName == "" {
+		levelName = "world"
 	}
 
-	return writeMcProperties(file, config)
-}
+	_, err = os.Stat(path.Join(dataDir, levelName, "level.dat"))
+	if errors.Is(err, os.ErrNotExist) {
+		instance.WorldSettings.apply(config)
+	}
 
-func writeMcProperties(file io.WriteCloser, config map[string]string) error {
-	defer file.Close()
+	return writeMcPropertiesFile(dataDir, config)
+}
 
-	for k, v := range config {
-		_, err := file.Write([]byte(k + "=" + v + "\n"))
-		if err != nil {
-			return err
-		}
+// apply writes the settings used by the server when generating
+// the world. Empty values keep the ones already in the file.
+func (w *WorldSettings) apply(config *mcProperties) {
+	if w.Seed != "" {
+		config.Set("level-seed", w.Seed)
 	}
-	return nil
+	if w.LevelType != "" {
+		config.Set("level-type", w.LevelType)
+	}
+	if w.GeneratorSettings != "" {
+		config.Set("generator-settings", w.GeneratorSettings)
+	}
+	if w.Gamemode != "" {
+		config.Set("gamemode", w.Gamemode)
+	}
+	config.Set("hardcore", strconv.FormatBool(w.Hardcore))
+}
+
+type propertyKind uint8
+
+const (
+	propertyString propertyKind = iota
+	propertyBool
+	propertyInt
+	propertyEnum
+)
+
+type propertyRule struct {
+	kind     propertyKind
+	min, max int64
+	values   []string
 }
 
-func readMcProperties(file io.ReadCloser) (map[string]string, error) {
-	defer file.Close()
+// Keys overwritten by the runner on every launch.
+var managedProperties = map[string]string{
+	"server-port":         "managed by the runner",
+	"query.port":          "managed by the runner",
+	"online-mode":         "set by the instance allow_pirate config",
+	"difficulty":          "set by the instance difficulty config",
+	"max-players":         "set by the instance max_players limit",
+	"view-distance":       "set by the instance view_distance config",
+	"simulation-distance": "set by the instance simulation_distance config",
+	"motd":                "set by the instance motd config, or its name",
+	"accepts-transfers":   "set by the instance accept_transfers config",
+	"enable-query":        "required by the runner to list the players and plugins",
+}
+
+var propertyRules = map[string]propertyRule{
+	"gamemode": {kind: propertyEnum, values: []string{
+		"survival", "creative", "adventure", "spectator",
+	}},
+	"level-name": {kind: propertyString},
+	"level-seed": {kind: propertyString},
+	"level-type": {kind: propertyString},
+
+	"allow-flight":                      {kind: propertyBool},
+	"allow-nether":                      {kind: propertyBool},
+	"broadcast-console-to-ops":          {kind: propertyBool},
+	"broadcast-rcon-to-ops":             {kind: propertyBool},
+	"enable-command-block":              {kind: propertyBool},
+	"enable-jmx-monitoring":             {kind: propertyBool},
+	"enable-rcon":                       {kind: propertyBool},
+	"enable-status":                     {kind: propertyBool},
+	"enforce-secure-profile":            {kind: propertyBool},
+	"enforce-whitelist":                 {kind: propertyBool},
+	"force-gamemode":                    {kind: propertyBool},
+	"generate-structures":               {kind: propertyBool},
+	"hardcore":                          {kind: propertyBool},
+	"hide-online-players":               {kind: propertyBool},
+	"log-ips":                           {kind: propertyBool},
+	"prevent-proxy-connections":         {kind: propertyBool},
+	"pvp":                               {kind: propertyBool},
+	"require-resource-pack":             {kind: propertyBool},
+	"spawn-animals":                     {kind: propertyBool},
+	"spawn-monsters":                    {kind: propertyBool},
+	"spawn-npcs":                        {kind: propertyBool},
+	"sync-chunk-writes":                 {kind: propertyBool},
+	"use-native-transport":              {kind: propertyBool},
+	"white-list":                        {kind: propertyBool},
+	"entity-broadcast-range-percentage": {kind: propertyInt, min: 10, max: 1000},
+	"function-permission-level":         {kind: propertyInt, min: 1, max: 4},
+	"max-chained-neighbor-updates":      {kind: propertyInt, min: -1, max: 1 << 31},
+	"max-tick-time":                     {kind: propertyInt, min: -1, max: 1 << 62},
+	"max-world-size":                    {kind: propertyInt, min: 1, max: 29999984},
+	"network-compression-threshold":     {kind: propertyInt, min: -1, max: 1 << 31},
+	"op-permission-level":               {kind: propertyInt, min: 0, max: 4},
+	"player-idle-timeout":               {kind: propertyInt, min: 0, max: 1 << 31},
+	"rate-limit":                        {kind: propertyInt, min: 0, max: 1 << 31},
+	"rcon.port":                         {kind: propertyInt, min: 1, max: 65535},
+	"spawn-protection":                  {kind: propertyInt, min: 0, max: 1 << 31},
+}
+
+func validateProperty(key string, value string) error {
+	if reason, ok := managedProperties[key]; ok {
+		return fmt.Errorf("property %q is %s", key, reason)
+	}
+
+	if key == "" || strings.ContainsAny(key, "\r\n") {
+		return fmt.Errorf("invalid property key %q", key)
+	}
 
-	config := make(map[string]string)
-	reader := bufio.NewReader(file)
+	rule, ok := propertyRules[key]
+	if !ok {
+		return nil
+	}
 
-	for {
-		line, err := reader.ReadString('\n')
+	switch rule.kind {
+	case propertyBool:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("property %q must be true or false", key)
+		}
 
-		if equal := strings.Index(line, "="); equal >= 0 {
-			if key := strings.TrimSpace(line[:equal]); len(key) > 0 {
-				value := ""
-				if len(line) > equal {
-					value = strings.TrimSpace(line[equal+1:])
-				}
-				config[key] = value
-			}
+	case propertyInt:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < rule.min || n > rule.max {
+			return fmt.Errorf(
+				"property %q must be an integer between %d and %d",
+				key, rule.min, rule.max,
+			)
 		}
-		if err == io.EOF {
-			break
+
+	case propertyEnum:
+		if !slices.Contains(rule.values, value) {
+			return fmt.Errorf(
+				"property %q must be one of %s",
+				key, strings.Join(rule.values, ", "),
+			)
 		}
-		if err != nil {
-			return nil, err
+	}
+
+	if key == "level-name" {
+		if value == "" || value == "." || value == ".." ||
+			strings.ContainsAny(value, "/\\") {
+			return fmt.Errorf("property %q must be a valid directory name", key)
 		}
 	}
-	return config, nil
+
+	return nil
 }
@@ -0,0 +1,128 @@
+package runner
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const mojangProfileURL = "https://api.mojang.com/users/profiles/minecraft/"
+
+var playerNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]{1,16}$`)
+
+// offlineUUID returns the uuid the server gives to the players
+// when online-mode is disabled.
+func offlineUUID(name string) uuid.UUID {
+	// java UUID.nameUUIDFromBytes
+	h := md5.Sum([]byte("OfflinePlayer:" + name))
+	h[6] = (h[6] & 0x0f) | 0x30
+	h[8] = (h[8] & 0x3f) | 0x80
+	return uuid.UUID(h)
+}
+
+type mojangProfile struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// uuidResolver resolves the online uuids through the mojang api,
+// caching the results since the api is rate limited.
+type uuidResolver struct {
+	c     *http.Client
+	cache map[string]mojangProfile
+	mu    sync.Mutex
+}
+
+func newUUIDResolver(c *http.Client) *uuidResolver {
+	if c == nil {
+		c = http.DefaultClient
+	}
+	return &uuidResolver{
+		c:     c,
+		cache: make(map[string]mojangProfile),
+	}
+}
+
+// Resolve returns the player uuid and the name with the correct case.
+func (r *uuidResolver) Resolve(
+	ctx context.Context,
+	name string,
+	online bool,
+) (uuid.UUID, string, error) {
+	if !playerNameRegex.MatchString(name) {
+		return uuid.Nil, "", fmt.Errorf("invalid player name %q", name)
+	}
+
+	if !online {
+		return offlineUUID(name), name, nil
+	}
+
+	p, err := r.getProfile(ctx, name)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	id, err := uuid.Parse(p.ID)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+	return id, p.Name, nil
+}
+
+func (r *uuidResolver) getProfile(ctx context.Context, name string) (mojangProfile, error) {
+	key := strings.ToLower(name)
+
+	r.mu.Lock()
+	p, ok := r.cache[key]
+	r.mu.Unlock()
+
+	if ok {
+		return p, nil
+	}
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodGet,
+		mojangProfileURL+url.PathEscape(name),
+		nil,
+	)
+	if err != nil {
+		return mojangProfile{}, err
+	}
+
+	res, err := r.c.Do(req)
+	if err != nil {
+		return mojangProfile{}, err
+	}
+	defer res.Body.Close()
+
+	switch res.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound, http.StatusNoContent:
+		return mojangProfile{}, fmt.Errorf("player %q does not exist", name)
+	default:
+		return mojangProfile{}, fmt.Errorf("mojang api returned %s", res.Status)
+	}
+
+	if err = json.NewDecoder(res.Body).Decode(&p); err != nil {
+		return mojangProfile{}, err
+	}
+	if p.ID == "" {
+		return mojangProfile{}, errors.New("mojang api returned an empty id")
+	}
+
+	r.mu.Lock()
+	r.cache[key] = p
+	r.mu.Unlock()
+
+	return p, nil
+}
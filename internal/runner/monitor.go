@@ -0,0 +1,184 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/zanz1n/mc-manager/config"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const (
+	defaultMonitorTimeout      = 5 * time.Second
+	defaultUnresponsiveAfter   = 2 * time.Minute
+	monitorRestartAttempts     = 3
+	monitorRestartAttemptDelay = 5 * time.Second
+)
+
+// Health is the result of the last status ping of an instance.
+type Health struct {
+	CheckedAt      time.Time
+	PublicLatency  time.Duration
+	BackendLatency time.Duration
+
+	Version         string
+	ProtocolVersion int32
+	Online          int32
+	MaxPlayers      int32
+
+	// zero while the server answers
+	UnresponsiveSince time.Time
+	LastError         string
+}
+
+func (h *Health) IntoPB() *pb.InstanceHealth {
+	res := &pb.InstanceHealth{
+		CheckedAt:       timestamppb.New(h.CheckedAt),
+		Version:         h.Version,
+		ProtocolVersion: h.ProtocolVersion,
+		Online:          h.Online,
+		MaxPlayers:      h.MaxPlayers,
+		LastError:       h.LastError,
+	}
+	if h.PublicLatency > 0 {
+		res.PublicLatency = durationpb.New(h.PublicLatency)
+	}
+	if h.BackendLatency > 0 {
+		res.BackendLatency = durationpb.New(h.BackendLatency)
+	}
+	if !h.UnresponsiveSince.IsZero() {
+		res.UnresponsiveSince = timestamppb.New(h.UnresponsiveSince)
+	}
+	return res
+}
+
+func monitorDefaults(cfg config.MonitorConfig) config.MonitorConfig {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultMonitorTimeout
+	}
+	if cfg.UnresponsiveAfter <= 0 {
+		cfg.UnresponsiveAfter = defaultUnresponsiveAfter
+	}
+	return cfg
+}
+
+// monitorInstance pings the instance periodically once it is running,
+// until it is closed. The instance is unresponsive when the server does
+// not answer for the configured time, while the public pings only
+// record the errors of the proxy.
+func (m *Manager) monitorInstance(i *Instance) {
+	ticker := time.NewTicker(m.monitor.Interval)
+	defer ticker.Stop()
+
+	reported := false
+	for range ticker.C {
+		if i.closed.Load() {
+			return
+		}
+		if i.GetState() != pb.InstanceState_STATE_RUNNING {
+			continue
+		}
+
+		h := m.checkHealth(i)
+		i.health.Store(&h)
+
+		if h.UnresponsiveSince.IsZero() {
+			if reported {
+				slog.Info("Manager: Instance is responsive again", "id", i.ID)
+				reported = false
+			}
+			continue
+		}
+
+		if reported || time.Since(h.UnresponsiveSince) < m.monitor.UnresponsiveAfter {
+			continue
+		}
+		reported = true
+
+		slog.Warn(
+			"Manager: Instance is unresponsive",
+			"id", i.ID,
+			"since", h.UnresponsiveSince,
+			"error", h.LastError,
+		)
+		i.SendEvent(Event{
+			Type: pb.EventType_EVENT_UNRESPONSIVE,
+			Data: []byte(h.LastError),
+		})
+
+		if m.monitor.Restart {
+			go m.restart(i)
+			return
+		}
+	}
+}
+
+func (m *Manager) checkHealth(i *Instance) Health {
+	h := Health{CheckedAt: time.Now()}
+	if prev := i.health.Load(); prev != nil {
+		h.UnresponsiveSince = prev.UnresponsiveSince
+	}
+
+	backend, err := i.proxy.PingBackend(m.monitor.Timeout)
+	if err != nil {
+		h.LastError = "backend: " + err.Error()
+		if h.UnresponsiveSince.IsZero() {
+			h.UnresponsiveSince = h.CheckedAt
+		}
+		return h
+	}
+
+	h.UnresponsiveSince = time.Time{}
+	h.BackendLatency = backend.Latency
+	h.Version = backend.Status.Version.Name
+	h.ProtocolVersion = backend.Status.Version.Protocol
+	h.Online = backend.Status.Players.Online
+	h.MaxPlayers = backend.Status.Players.Max
+
+	public, err := i.proxy.PingPublic(m.monitor.Timeout)
+	if err != nil {
+		h.LastError = "public: " + err.Error()
+	} else {
+		h.PublicLatency = public.Latency
+	}
+	return h
+}
+
+// restart stops the unresponsive instance and launches it again with
+// the same data, retrying while the old container is removed.
+func (m *Manager) restart(i *Instance) {
+	ctx := context.Background()
+	data := i.createData()
+
+	if err := m.Stop(ctx, i.ID); err != nil {
+		slog.Error(
+			"Manager: Failed to stop unresponsive instance",
+			"id", i.ID,
+			"error", err,
+		)
+	}
+
+	var err error
+	for attempt := 0; attempt < monitorRestartAttempts; attempt++ {
+		time.Sleep(monitorRestartAttemptDelay)
+
+		if _, err = m.Launch(ctx, data); err == nil {
+			slog.Info("Manager: Restarted unresponsive instance", "id", i.ID)
+			return
+		}
+		if errors.Is(err, ErrInstanceAlreadyLaunched) {
+			return
+		}
+	}
+
+	slog.Error(
+		"Manager: Failed to restart unresponsive instance",
+		"id", i.ID,
+		"attempts", monitorRestartAttempts,
+		"error", err,
+	)
+}
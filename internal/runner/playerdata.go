@@ -0,0 +1,297 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/nbt"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var mcDifficulties = []string{"peaceful", "easy", "normal", "hard"}
+
+var mcGamemodes = []string{"survival", "creative", "adventure", "spectator"}
+
+type WorldInfo struct {
+	Name             string
+	Seed             int64
+	Version          WorldVersion
+	SpawnX           int32
+	SpawnY           int32
+	SpawnZ           int32
+	GameRules        map[string]string
+	DayTime          int64
+	Time             int64
+	Difficulty       string
+	DifficultyLocked bool
+	Hardcore         bool
+	Raining          bool
+	Thundering       bool
+}
+
+func (w *WorldInfo) IntoPB() *pb.WorldInfo {
+	return &pb.WorldInfo{
+		Name:             w.Name,
+		Seed:             w.Seed,
+		DataVersion:      w.Version.DataVersion,
+		VersionName:      w.Version.Name,
+		SpawnX:           w.SpawnX,
+		SpawnY:           w.SpawnY,
+		SpawnZ:           w.SpawnZ,
+		GameRules:        w.GameRules,
+		DayTime:          w.DayTime,
+		Time:             w.Time,
+		Difficulty:       w.Difficulty,
+		DifficultyLocked: w.DifficultyLocked,
+		Hardcore:         w.Hardcore,
+		Raining:          w.Raining,
+		Thundering:       w.Thundering,
+	}
+}
+
+type ItemSummary struct {
+	Slot  int32
+	ID    string
+	Count int32
+}
+
+type PlayerData struct {
+	UUID       uuid.UUID
+	Name       string
+	X, Y, Z    float64
+	Dimension  string
+	Health     float32
+	FoodLevel  int32
+	XPLevel    int32
+	Gamemode   string
+	Inventory  []ItemSummary
+	ModifiedAt time.Time
+}
+
+func (p *PlayerData) IntoPB() *pb.PlayerData {
+	inventory := make([]*pb.ItemSummary, len(p.Inventory))
+	for i, item := range p.Inventory {
+		inventory[i] = &pb.ItemSummary{
+			Slot:  item.Slot,
+			Id:    item.ID,
+			Count: item.Count,
+		}
+	}
+
+	return &pb.PlayerData{
+		Uuid:      p.UUID.String(),
+		Name:      p.Name,
+		X:         p.X,
+		Y:         p.Y,
+		Z:         p.Z,
+		Dimension: p.Dimension,
+		Health:    p.Health,
+		FoodLevel: p.FoodLevel,
+		XpLevel:   p.XPLevel,
+		Gamemode:  p.Gamemode,
+		Inventory: inventory,
+		UpdatedAt: timestamppb.New(p.ModifiedAt),
+	}
+}
+
+// readWorldInfo reads the level.dat of the world, handling the
+// fields that were moved or changed type between versions.
+func readWorldInfo(worldDir string) (WorldInfo, error) {
+	data, err := readLevelDat(worldDir)
+	if err != nil {
+		return WorldInfo{}, err
+	}
+
+	info := WorldInfo{
+		Name:      path.Base(worldDir),
+		GameRules: make(map[string]string),
+	}
+
+	v, err := readWorldDirVersion(worldDir)
+	if err != nil {
+		return WorldInfo{}, err
+	}
+	info.Version = v
+
+	// 1.16+ stores the seed in the world gen settings
+	if settings, ok := data.Compound("WorldGenSettings"); ok {
+		info.Seed, _ = settings.Long("seed")
+	} else {
+		info.Seed, _ = data.Long("RandomSeed")
+	}
+
+	if spawn, ok := data.Compound("spawn"); ok {
+		if pos, ok := spawn["pos"].([]int32); ok && len(pos) == 3 {
+			info.SpawnX, info.SpawnY, info.SpawnZ = pos[0], pos[1], pos[2]
+		}
+	} else {
+		info.SpawnX, _ = data.Int("SpawnX")
+		info.SpawnY, _ = data.Int("SpawnY")
+		info.SpawnZ, _ = data.Int("SpawnZ")
+	}
+
+	if rules, ok := data.Compound("GameRules"); ok {
+		for k := range rules {
+			if v, ok := rules.String(k); ok {
+				info.GameRules[k] = v
+			}
+		}
+	}
+
+	info.DayTime, _ = data.Long("DayTime")
+	info.Time, _ = data.Long("Time")
+
+	if d, ok := data.Number("Difficulty"); ok && d >= 0 && int(d) < len(mcDifficulties) {
+		info.Difficulty = mcDifficulties[d]
+	}
+	info.DifficultyLocked, _ = data.Bool("DifficultyLocked")
+	info.Hardcore, _ = data.Bool("hardcore")
+	info.Raining, _ = data.Bool("raining")
+	info.Thundering, _ = data.Bool("thundering")
+
+	return info, nil
+}
+
+// readPlayerData reads the player files of the world, filtering by
+// the uuid if it is not nil.
+func readPlayerData(dataDir string, worldDir string, filter uuid.UUID) ([]PlayerData, error) {
+	dir := path.Join(worldDir, "playerdata")
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []PlayerData{}, nil
+		}
+		return nil, err
+	}
+
+	names := readUserCache(dataDir)
+
+	players := []PlayerData{}
+	for _, e := range entries {
+		idStr, ok := strings.CutSuffix(e.Name(), ".dat")
+		if !ok || !e.Type().IsRegular() {
+			continue
+		}
+
+		id, err := uuid.Parse(idStr)
+		if err != nil || (filter != uuid.Nil && filter != id) {
+			continue
+		}
+
+		p, err := readPlayerFile(path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		p.UUID = id
+		p.Name = names[id]
+		if info, err := e.Info(); err == nil {
+			p.ModifiedAt = info.ModTime()
+		}
+
+		players = append(players, p)
+	}
+
+	return players, nil
+}
+
+func readPlayerFile(p string) (PlayerData, error) {
+	file, err := os.Open(p)
+	if err != nil {
+		return PlayerData{}, err
+	}
+	defer file.Close()
+
+	_, data, err := nbt.Decode(file)
+	if err != nil {
+		return PlayerData{}, err
+	}
+
+	var res PlayerData
+
+	if pos, ok := data.List("Pos"); ok && len(pos.Values) == 3 {
+		res.X, _ = pos.Values[0].(float64)
+		res.Y, _ = pos.Values[1].(float64)
+		res.Z, _ = pos.Values[2].(float64)
+	}
+
+	// Before 1.16 the dimension was stored as an integer
+	if dim, ok := data.String("Dimension"); ok {
+		res.Dimension = dim
+	} else if dim, ok := data.Number("Dimension"); ok {
+		switch dim {
+		case -1:
+			res.Dimension = "minecraft:the_nether"
+		case 1:
+			res.Dimension = "minecraft:the_end"
+		default:
+			res.Dimension = "minecraft:overworld"
+		}
+	}
+
+	res.Health, _ = data.Float("Health")
+	res.FoodLevel, _ = data.Int("foodLevel")
+	res.XPLevel, _ = data.Int("XpLevel")
+
+	if gm, ok := data.Int("playerGameType"); ok && gm >= 0 && int(gm) < len(mcGamemodes) {
+		res.Gamemode = mcGamemodes[gm]
+	}
+
+	if inv, ok := data.List("Inventory"); ok {
+		res.Inventory = make([]ItemSummary, 0, len(inv.Values))
+		for _, v := range inv.Values {
+			item, ok := v.(nbt.Compound)
+			if !ok {
+				continue
+			}
+
+			// 1.20.5 renamed Count to count and changed its type to int
+			count, ok := item.Number("count")
+			if !ok {
+				count, _ = item.Number("Count")
+			}
+			slot, _ := item.Number("Slot")
+			id, _ := item.String("id")
+
+			res.Inventory = append(res.Inventory, ItemSummary{
+				Slot:  int32(slot),
+				ID:    id,
+				Count: int32(count),
+			})
+		}
+	}
+
+	return res, nil
+}
+
+type userCacheEntry struct {
+	Name string    `json:"name"`
+	UUID uuid.UUID `json:"uuid"`
+}
+
+// readUserCache returns the player names known by the server.
+func readUserCache(dataDir string) map[uuid.UUID]string {
+	res := make(map[uuid.UUID]string)
+
+	b, err := os.ReadFile(path.Join(dataDir, "usercache.json"))
+	if err != nil {
+		return res
+	}
+
+	var entries []userCacheEntry
+	if err = json.Unmarshal(b, &entries); err != nil {
+		return res
+	}
+
+	for _, e := range entries {
+		res[e.UUID] = e.Name
+	}
+	return res
+}
@@ -0,0 +1,372 @@
+package runner
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/netip"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+const mcDateFormat = "2006-01-02 15:04:05 -0700"
+
+type mcWhitelistEntry struct {
+	UUID uuid.UUID `json:"uuid"`
+	Name string    `json:"name"`
+}
+
+type mcBannedPlayer struct {
+	UUID    uuid.UUID `json:"uuid"`
+	Name    string    `json:"name"`
+	Created string    `json:"created"`
+	Source  string    `json:"source"`
+	Expires string    `json:"expires"`
+	Reason  string    `json:"reason"`
+}
+
+type mcBannedIP struct {
+	IP      string `json:"ip"`
+	Created string `json:"created"`
+	Source  string `json:"source"`
+	Expires string `json:"expires"`
+	Reason  string `json:"reason"`
+}
+
+type PlayerListEntry struct {
+	UUID                uuid.UUID
+	Name                string
+	IP                  string
+	Level               uint8
+	BypassesPlayerLimit bool
+	Reason              string
+	Source              string
+	CreatedAt           time.Time
+	// zero when the ban is permanent
+	ExpiresAt time.Time
+}
+
+func (e *PlayerListEntry) IntoPB() *pb.PlayerListEntry {
+	res := &pb.PlayerListEntry{
+		Name:                e.Name,
+		Ip:                  e.IP,
+		Level:               int32(e.Level),
+		BypassesPlayerLimit: e.BypassesPlayerLimit,
+		Reason:              e.Reason,
+		Source:              e.Source,
+	}
+	if e.UUID != uuid.Nil {
+		res.Uuid = e.UUID.String()
+	}
+	if !e.CreatedAt.IsZero() {
+		res.CreatedAt = timestamppb.New(e.CreatedAt)
+	}
+	if !e.ExpiresAt.IsZero() {
+		res.ExpiresAt = timestamppb.New(e.ExpiresAt)
+	}
+	return res
+}
+
+type PlayerListChange struct {
+	List   pb.PlayerList
+	Name   string
+	Level  uint8
+	Reason string
+}
+
+func (c *PlayerListChange) Validate() error {
+	if c.List == pb.PlayerList_PLAYER_LIST_BANNED_IPS {
+		if _, err := netip.ParseAddr(c.Name); err != nil {
+			return fmt.Errorf("invalid ip address %q", c.Name)
+		}
+	} else if !playerNameRegex.MatchString(c.Name) {
+		return fmt.Errorf("invalid player name %q", c.Name)
+	}
+
+	if c.Level > 4 {
+		return errors.New("the operator level must be between 0 and 4")
+	}
+	if strings.ContainsAny(c.Reason, "\r\n") {
+		return errors.New("the reason must be a single line")
+	}
+	return nil
+}
+
+func (c *PlayerListChange) addCommand() (string, [][]byte) {
+	switch c.List {
+	case pb.PlayerList_PLAYER_LIST_OPS:
+		return "op " + c.Name, [][]byte{[]byte("a server operator")}
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		return "whitelist add " + c.Name, [][]byte{
+			[]byte("to the whitelist"),
+			[]byte("already whitelisted"),
+		}
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		return strings.TrimSpace("ban " + c.Name + " " + c.Reason),
+			[][]byte{[]byte("Banned ")}
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		return strings.TrimSpace("ban-ip " + c.Name + " " + c.Reason),
+			[][]byte{[]byte("Banned IP")}
+	}
+	return "", nil
+}
+
+func (c *PlayerListChange) removeCommand() (string, [][]byte) {
+	switch c.List {
+	case pb.PlayerList_PLAYER_LIST_OPS:
+		return "deop " + c.Name, [][]byte{[]byte("no longer a server operator")}
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		return "whitelist remove " + c.Name, [][]byte{
+			[]byte("from the whitelist"),
+			[]byte("not whitelisted"),
+		}
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		return "pardon " + c.Name, [][]byte{[]byte("Unbanned ")}
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		return "pardon-ip " + c.Name, [][]byte{[]byte("Unbanned IP")}
+	}
+	return "", nil
+}
+
+// Replies common to all the player list commands.
+var playerListReplies = [][]byte{
+	[]byte("Nothing changed"),
+	[]byte("does not exist"),
+	[]byte("No player was found"),
+	[]byte("Invalid IP"),
+}
+
+func playerListFile(list pb.PlayerList) string {
+	switch list {
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		return "whitelist.json"
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		return "banned-players.json"
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		return "banned-ips.json"
+	}
+	return "ops.json"
+}
+
+func readPlayerList(dataDir string, list pb.PlayerList) ([]PlayerListEntry, error) {
+	p := path.Join(dataDir, playerListFile(list))
+
+	switch list {
+	case pb.PlayerList_PLAYER_LIST_OPS:
+		ops, err := readJSONList[mcOperator](p)
+		res := make([]PlayerListEntry, len(ops))
+		for i, op := range ops {
+			res[i] = PlayerListEntry{
+				UUID:                op.UUID,
+				Name:                op.Name,
+				Level:               op.Level,
+				BypassesPlayerLimit: op.BypassesPlayerLimit,
+			}
+		}
+		return res, err
+
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		entries, err := readJSONList[mcWhitelistEntry](p)
+		res := make([]PlayerListEntry, len(entries))
+		for i, e := range entries {
+			res[i] = PlayerListEntry{UUID: e.UUID, Name: e.Name}
+		}
+		return res, err
+
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		bans, err := readJSONList[mcBannedPlayer](p)
+		res := make([]PlayerListEntry, len(bans))
+		for i, b := range bans {
+			res[i] = PlayerListEntry{
+				UUID:      b.UUID,
+				Name:      b.Name,
+				Reason:    b.Reason,
+				Source:    b.Source,
+				CreatedAt: parseMcDate(b.Created),
+				ExpiresAt: parseMcDate(b.Expires),
+			}
+		}
+		return res, err
+
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		bans, err := readJSONList[mcBannedIP](p)
+		res := make([]PlayerListEntry, len(bans))
+		for i, b := range bans {
+			res[i] = PlayerListEntry{
+				IP:        b.IP,
+				Reason:    b.Reason,
+				Source:    b.Source,
+				CreatedAt: parseMcDate(b.Created),
+				ExpiresAt: parseMcDate(b.Expires),
+			}
+		}
+		return res, err
+	}
+
+	return nil, fmt.Errorf("invalid player list %s", list)
+}
+
+// addToPlayerList edits the list file directly, it must only
+// be used while the server is not running.
+func addToPlayerList(dataDir string, c PlayerListChange, id uuid.UUID) error {
+	p := path.Join(dataDir, playerListFile(c.List))
+
+	now := time.Now().Format(mcDateFormat)
+	reason := c.Reason
+	if reason == "" {
+		reason = "Banned by an operator."
+	}
+
+	switch c.List {
+	case pb.PlayerList_PLAYER_LIST_OPS:
+		return upsertJSONList(p, mcOperator{
+			UUID:  id,
+			Name:  c.Name,
+			Level: c.Level,
+		}, func(op mcOperator) bool { return op.UUID == id })
+
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		return upsertJSONList(p, mcWhitelistEntry{
+			UUID: id,
+			Name: c.Name,
+		}, func(e mcWhitelistEntry) bool { return e.UUID == id })
+
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		return upsertJSONList(p, mcBannedPlayer{
+			UUID:    id,
+			Name:    c.Name,
+			Created: now,
+			Source:  "Server",
+			Expires: "forever",
+			Reason:  reason,
+		}, func(b mcBannedPlayer) bool { return b.UUID == id })
+
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		return upsertJSONList(p, mcBannedIP{
+			IP:      c.Name,
+			Created: now,
+			Source:  "Server",
+			Expires: "forever",
+			Reason:  reason,
+		}, func(b mcBannedIP) bool { return b.IP == c.Name })
+	}
+
+	return fmt.Errorf("invalid player list %s", c.List)
+}
+
+// removeFromPlayerList edits the list file directly, it must only
+// be used while the server is not running. The players are matched
+// by name, since the uuid depends on the online-mode in use when
+// the entry was added.
+func removeFromPlayerList(dataDir string, c PlayerListChange) error {
+	p := path.Join(dataDir, playerListFile(c.List))
+
+	switch c.List {
+	case pb.PlayerList_PLAYER_LIST_OPS:
+		return removeJSONList(p, func(op mcOperator) bool {
+			return strings.EqualFold(op.Name, c.Name)
+		})
+	case pb.PlayerList_PLAYER_LIST_WHITELIST:
+		return removeJSONList(p, func(e mcWhitelistEntry) bool {
+			return strings.EqualFold(e.Name, c.Name)
+		})
+	case pb.PlayerList_PLAYER_LIST_BANNED_PLAYERS:
+		return removeJSONList(p, func(b mcBannedPlayer) bool {
+			return strings.EqualFold(b.Name, c.Name)
+		})
+	case pb.PlayerList_PLAYER_LIST_BANNED_IPS:
+		return removeJSONList(p, func(b mcBannedIP) bool {
+			return b.IP == c.Name
+		})
+	}
+
+	return fmt.Errorf("invalid player list %s", c.List)
+}
+
+// getDefaultOpLevel returns the level the server gives to the
+// players op'd through the console.
+func getDefaultOpLevel(config *mcProperties) uint8 {
+	v, _ := config.Get("op-permission-level")
+	level, err := strconv.ParseUint(v, 10, 8)
+	if err != nil || level < 1 || level > 4 {
+		return 4
+	}
+	return uint8(level)
+}
+
+func isOnlineMode(config *mcProperties) bool {
+	v, ok := config.Get("online-mode")
+	return !ok || v != "false"
+}
+
+func parseMcDate(s string) time.Time {
+	t, err := time.Parse(mcDateFormat, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func readJSONList[T any](p string) ([]T, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []T{}, nil
+		}
+		return nil, err
+	}
+
+	var res []T
+	if err = json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func writeJSONList[T any](p string, list []T) error {
+	if list == nil {
+		list = []T{}
+	}
+
+	b, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := p + ".tmp"
+	if err = os.WriteFile(tmp, append(b, '\n'), 0666); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func upsertJSONList[T any](p string, v T, match func(T) bool) error {
+	list, err := readJSONList[T](p)
+	if err != nil {
+		return err
+	}
+
+	if i := slices.IndexFunc(list, match); i >= 0 {
+		list[i] = v
+	} else {
+		list = append(list, v)
+	}
+	return writeJSONList(p, list)
+}
+
+func removeJSONList[T any](p string, match func(T) bool) error {
+	list, err := readJSONList[T](p)
+	if err != nil {
+		return err
+	}
+
+	return writeJSONList(p, slices.DeleteFunc(list, match))
+}
@@ -0,0 +1,113 @@
+package runner
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+type PortMapping struct {
+	Protocol      pb.PortProtocol `json:"protocol"`
+	PublicPort    uint16          `json:"public_port"`
+	ContainerPort uint16          `json:"container_port"`
+}
+
+func (p *PortMapping) FromPB(data *pb.PortMapping) {
+	*p = PortMapping{
+		Protocol:      data.Protocol,
+		PublicPort:    uint16(data.PublicPort),
+		ContainerPort: uint16(data.ContainerPort),
+	}
+}
+
+func (p *PortMapping) IntoPB() *pb.PortMapping {
+	return &pb.PortMapping{
+		Protocol:      p.Protocol,
+		PublicPort:    uint32(p.PublicPort),
+		ContainerPort: uint32(p.ContainerPort),
+	}
+}
+
+func PortMappingsFromPB(data []*pb.PortMapping) []PortMapping {
+	ports := make([]PortMapping, len(data))
+	for i, p := range data {
+		ports[i].FromPB(p)
+	}
+	return ports
+}
+
+func PortMappingsIntoPB(ports []PortMapping) []*pb.PortMapping {
+	res := make([]*pb.PortMapping, len(ports))
+	for i, p := range ports {
+		res[i] = p.IntoPB()
+	}
+	return res
+}
+
+type publicPort struct {
+	Protocol pb.PortProtocol
+	Port     uint16
+}
+
+func (p publicPort) String() string {
+	protocol := strings.TrimPrefix(p.Protocol.String(), "PORT_PROTOCOL_")
+	return fmt.Sprintf("%d/%s", p.Port, strings.ToLower(protocol))
+}
+
+// publicPorts returns the ports of the node used by the instance, the
+// minecraft one included.
+func (c *InstanceConfig) publicPorts() []publicPort {
+	ports := make([]publicPort, 0, len(c.Ports)+1)
+	ports = append(ports, publicPort{pb.PortProtocol_PORT_PROTOCOL_TCP, c.Port})
+	for _, p := range c.Ports {
+		ports = append(ports, publicPort{p.Protocol, p.PublicPort})
+	}
+	return ports
+}
+
+func (c *InstanceConfig) validatePorts() error {
+	seen := make(map[publicPort]struct{}, len(c.Ports)+1)
+	for _, p := range c.publicPorts() {
+		if p.Port == 0 {
+			return errors.New("the public ports must not be zero")
+		}
+		if _, ok := seen[p]; ok {
+			return fmt.Errorf("port %s is mapped more than once", p)
+		}
+		seen[p] = struct{}{}
+	}
+
+	for _, p := range c.Ports {
+		if p.ContainerPort == 0 {
+			return errors.New("the container ports must not be zero")
+		}
+	}
+	return nil
+}
+
+// checkPorts returns an error if any of the public ports of the
+// instance is used by another instance of the node. It must be called
+// with the lock held.
+func (m *Manager) checkPorts(instance *Instance) error {
+	used := make(map[publicPort]*Instance)
+	for _, i := range m.m {
+		if i.ID == instance.ID {
+			continue
+		}
+		for _, p := range i.Config.publicPorts() {
+			used[p] = i
+		}
+	}
+
+	for _, p := range instance.Config.publicPorts() {
+		if i, ok := used[p]; ok {
+			return errors.Join(
+				ErrPortConflict,
+				fmt.Errorf("port %s is used by instance %s", p, i.ID),
+			)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,315 @@
+package runner
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+// mcProperties is a server.properties file that keeps the order of
+// the keys and the comments when written back. Unchanged lines are
+// written exactly as they were read.
+type mcProperties struct {
+	lines []mcPropertiesLine
+	keys  map[string]int
+}
+
+type mcPropertiesLine struct {
+	// empty for comments and blank lines
+	key   string
+	value string
+	// the original line, cleared when the value changes
+	raw string
+}
+
+type Property struct {
+	Key   string
+	Value string
+}
+
+func PropertiesIntoPB(props []Property) *pb.ServerProperties {
+	res := make([]*pb.ServerProperty, len(props))
+	for i, p := range props {
+		res[i] = &pb.ServerProperty{Key: p.Key, Value: p.Value}
+	}
+	return &pb.ServerProperties{Properties: res}
+}
+
+func newMcProperties() *mcProperties {
+	return &mcProperties{keys: make(map[string]int)}
+}
+
+func (p *mcProperties) Get(key string) (string, bool) {
+	i, ok := p.keys[key]
+	if !ok {
+		return "", false
+	}
+	return p.lines[i].value, true
+}
+
+// Set updates the value of the key in place, or appends it to the
+// end of the file if it is not present.
+func (p *mcProperties) Set(key string, value string) {
+	if i, ok := p.keys[key]; ok {
+		if p.lines[i].value != value {
+			p.lines[i].value = value
+			p.lines[i].raw = ""
+		}
+		return
+	}
+
+	p.keys[key] = len(p.lines)
+	p.lines = append(p.lines, mcPropertiesLine{key: key, value: value})
+}
+
+// SetDefault sets the value only if the key is not present.
+func (p *mcProperties) SetDefault(key string, value string) {
+	if _, ok := p.keys[key]; !ok {
+		p.Set(key, value)
+	}
+}
+
+func (p *mcProperties) Delete(key string) {
+	i, ok := p.keys[key]
+	if !ok {
+		return
+	}
+
+	p.lines = append(p.lines[:i], p.lines[i+1:]...)
+	delete(p.keys, key)
+
+	for k, j := range p.keys {
+		if j > i {
+			p.keys[k] = j - 1
+		}
+	}
+}
+
+// All returns the properties in the file order.
+func (p *mcProperties) All() []Property {
+	res := make([]Property, 0, len(p.keys))
+	for _, line := range p.lines {
+		if line.key != "" {
+			res = append(res, Property{Key: line.key, Value: line.value})
+		}
+	}
+	return res
+}
+
+// WriteTo implements io.WriterTo.
+func (p *mcProperties) WriteTo(w io.Writer) (int64, error) {
+	bw := bufio.NewWriter(w)
+
+	var written int64
+	for _, line := range p.lines {
+		s := line.raw
+		if line.key != "" && s == "" {
+			s = escapeProperty(line.key, true) + "=" + escapeProperty(line.value, false)
+		}
+
+		n, err := bw.WriteString(s + "\n")
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+
+	return written, bw.Flush()
+}
+
+func readMcProperties(file io.ReadCloser) (*mcProperties, error) {
+	defer file.Close()
+
+	p := newMcProperties()
+	reader := bufio.NewReader(file)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		eof := err == io.EOF
+
+		if eof && line == "" {
+			break
+		}
+
+		raw := strings.TrimRight(line, "\r\n")
+		logical := strings.TrimLeft(raw, " \t\f")
+
+		// Lines ending with an odd number of backslashes continue
+		// in the next line
+		for !eof && isContinued(logical) {
+			next, err := reader.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return nil, err
+			}
+			eof = err == io.EOF
+
+			next = strings.TrimRight(next, "\r\n")
+			raw += "\n" + next
+			logical = logical[:len(logical)-1] + strings.TrimLeft(next, " \t\f")
+		}
+
+		if logical == "" || logical[0] == '#' || logical[0] == '!' {
+			p.lines = append(p.lines, mcPropertiesLine{raw: raw})
+		} else {
+			key, value := splitProperty(logical)
+			if i, ok := p.keys[key]; ok {
+				// Duplicated keys are overwritten, like in java
+				p.lines[i] = mcPropertiesLine{key: key, value: value, raw: raw}
+			} else {
+				p.keys[key] = len(p.lines)
+				p.lines = append(p.lines, mcPropertiesLine{key: key, value: value, raw: raw})
+			}
+		}
+
+		if eof {
+			break
+		}
+	}
+
+	return p, nil
+}
+
+func readMcPropertiesFile(dataDir string) (*mcProperties, error) {
+	file, err := os.Open(path.Join(dataDir, "server.properties"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return newMcProperties(), nil
+		}
+		return nil, err
+	}
+
+	return readMcProperties(file)
+}
+
+func writeMcPropertiesFile(dataDir string, p *mcProperties) error {
+	file, err := os.CreateTemp(dataDir, ".server.properties-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err = p.WriteTo(file); err != nil {
+		return err
+	}
+
+	if err = file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path.Join(dataDir, "server.properties"))
+}
+
+func isContinued(line string) bool {
+	slashes := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		slashes++
+	}
+	return slashes%2 == 1
+}
+
+func splitProperty(line string) (string, string) {
+	end := len(line)
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		if c == '\\' {
+			i++
+			continue
+		}
+		if c == '=' || c == ':' || c == ' ' || c == '\t' || c == '\f' {
+			end = i
+			break
+		}
+	}
+
+	key := line[:end]
+	rest := strings.TrimLeft(line[end:], " \t\f")
+	if len(rest) > 0 && (rest[0] == '=' || rest[0] == ':') {
+		rest = strings.TrimLeft(rest[1:], " \t\f")
+	}
+
+	return unescapeProperty(key), unescapeProperty(rest)
+}
+
+func unescapeProperty(s string) string {
+	if !strings.ContainsRune(s, '\\') {
+		return s
+	}
+
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '\\' || i+1 >= len(s) {
+			b.WriteByte(c)
+			continue
+		}
+
+		i++
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if i+4 < len(s) {
+				if r, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+					b.WriteRune(rune(r))
+					i += 4
+					continue
+				}
+			}
+			b.WriteByte('u')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
+
+// escapeProperty escapes the string the same way java Properties.store
+// does, except for non ascii characters, which are written as UTF-8.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	b.Grow(len(s))
+
+	for i, r := range s {
+		switch r {
+		case ' ':
+			if i == 0 || isKey {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(' ')
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '=', ':', '#', '!', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return b.String()
+}
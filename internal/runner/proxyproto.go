@@ -0,0 +1,162 @@
+package runner
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"gopkg.in/yaml.v3"
+)
+
+// sanitizeProxyProtocol makes the server expect the PROXY protocol
+// header sent by the proxy, or stop expecting it when disabled.
+// Vanilla servers do not support it, so it is turned off for them.
+func sanitizeProxyProtocol(dataDir string, instance *Instance) error {
+	enabled := instance.Config.ProxyProtocol
+
+	if enabled && instance.Version.Distribution == pb.Distribution_VANILLA {
+		slog.Warn(
+			"DockerRunner: PROXY protocol is not supported by vanilla servers",
+			"id", instance.ID,
+		)
+		instance.Config.ProxyProtocol = false
+		return nil
+	}
+
+	// Written before the first launch of paper servers, so they
+	// generate the rest of the file around it
+	err := setPaperProxyProtocol(
+		dataDir,
+		enabled,
+		enabled && instance.Version.Distribution == pb.Distribution_PAPER,
+	)
+	if err != nil {
+		return err
+	}
+
+	return setVelocityProxyProtocol(dataDir, enabled)
+}
+
+// setPaperProxyProtocol sets proxies.proxy-protocol in the global
+// config of paper 1.19+, creating the file if create is true.
+func setPaperProxyProtocol(dataDir string, enabled, create bool) error {
+	filePath := path.Join(dataDir, "config", "paper-global.yml")
+
+	buf, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		if !create {
+			return nil
+		}
+		if err = os.MkdirAll(path.Dir(filePath), os.ModePerm); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	var doc yaml.Node
+	if err = yaml.Unmarshal(buf, &doc); err != nil {
+		return err
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{
+			Kind:    yaml.DocumentNode,
+			Content: []*yaml.Node{{Kind: yaml.MappingNode}},
+		}
+	}
+
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return errors.New("paper-global.yml: root is not a mapping")
+	}
+
+	proxies := yamlMapGet(root, "proxies")
+	if proxies == nil {
+		proxies = &yaml.Node{Kind: yaml.MappingNode}
+		yamlMapSet(root, "proxies", proxies)
+	}
+	if proxies.Kind != yaml.MappingNode {
+		return errors.New("paper-global.yml: proxies is not a mapping")
+	}
+
+	yamlMapSet(proxies, "proxy-protocol", &yaml.Node{
+		Kind:  yaml.ScalarNode,
+		Tag:   "!!bool",
+		Value: strconv.FormatBool(enabled),
+	})
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err = enc.Encode(&doc); err != nil {
+		return err
+	}
+	if err = enc.Close(); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filePath, out.Bytes(), 0666)
+}
+
+// setVelocityProxyProtocol sets haproxy-protocol in velocity.toml, if
+// the server is a velocity proxy.
+func setVelocityProxyProtocol(dataDir string, enabled bool) error {
+	filePath := path.Join(dataDir, "velocity.toml")
+
+	buf, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	line := "haproxy-protocol = " + strconv.FormatBool(enabled)
+	lines := strings.Split(string(buf), "\n")
+
+	// The key belongs to the root table, before the first section
+	section := len(lines)
+	for i, l := range lines {
+		l = strings.TrimSpace(l)
+		if strings.HasPrefix(l, "[") {
+			section = i
+			break
+		}
+
+		key, _, ok := strings.Cut(l, "=")
+		if ok && strings.TrimSpace(key) == "haproxy-protocol" {
+			lines[i] = line
+			return os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0666)
+		}
+	}
+
+	lines = append(lines[:section], append([]string{line}, lines[section:]...)...)
+	return os.WriteFile(filePath, []byte(strings.Join(lines, "\n")), 0666)
+}
+
+func yamlMapGet(m *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return m.Content[i+1]
+		}
+	}
+	return nil
+}
+
+func yamlMapSet(m *yaml.Node, key string, value *yaml.Node) {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			m.Content[i+1] = value
+			return
+		}
+	}
+
+	m.Content = append(m.Content,
+		&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key},
+		value,
+	)
+}
@@ -7,7 +7,6 @@ import (
 	"fmt"
 	"log/slog"
 	"net"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
@@ -19,6 +18,8 @@ import (
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
 	"github.com/zanz1n/mc-manager/config"
+	"github.com/zanz1n/mc-manager/internal/distribution"
+	"github.com/zanz1n/mc-manager/internal/dto"
 	"github.com/zanz1n/mc-manager/internal/pb"
 	"github.com/zanz1n/mc-manager/internal/proxy"
 )
@@ -27,6 +28,11 @@ type Runtime interface {
 	Create(ctx context.Context, instance *Instance) error
 	Launch(ctx context.Context, instance *Instance) error
 	Stop(ctx context.Context, instance *Instance) error
+
+	// The directory the instance files are stored, mounted
+	// in the server working directory.
+	DataDir(id dto.Snowflake) string
+	BackupDir(id dto.Snowflake) string
 }
 
 type dockerRuntime struct {
@@ -37,7 +43,11 @@ type dockerRuntime struct {
 
 	docker *client.Client
 	java   JavaVariant
-	c      *http.Client
+	dl     *distribution.Downloader
+
+	inbound proxy.Inbound
+	// nil when the shared listener is disabled
+	router *proxy.Router
 }
 
 func NewDockerRuntime(
@@ -45,11 +55,13 @@ func NewDockerRuntime(
 	dockerCfg config.DockerConfig,
 	dataCfg config.DataConfig,
 	docker *client.Client,
-	c *http.Client,
+	dl *distribution.Downloader,
 	java JavaVariant,
+	inbound proxy.Inbound,
+	router *proxy.Router,
 ) (Runtime, error) {
-	if c == nil {
-		c = http.DefaultClient
+	if dl == nil {
+		dl = distribution.NewDownloader(nil, config.DownloadConfig{})
 	}
 
 	dir, err := filepath.Abs(dataCfg.DataDir)
@@ -63,7 +75,9 @@ func NewDockerRuntime(
 		dir:           dir,
 		docker:        docker,
 		java:          java,
-		c:             c,
+		dl:            dl,
+		inbound:       inbound,
+		router:        router,
 	}
 
 	if err := r.createNetwork(ctx); err != nil {
@@ -119,7 +133,7 @@ func (r *dockerRuntime) Create(ctx context.Context, instance *Instance) error {
 		return err
 	}
 
-	dataDir := path.Join(r.dir, instance.ID.String())
+	dataDir := r.DataDir(instance.ID)
 	if err = os.MkdirAll(dataDir, os.ModePerm); err != nil {
 		return errors.Join(ErrFileSystem, err)
 	}
@@ -141,7 +155,7 @@ func (r *dockerRuntime) Create(ctx context.Context, instance *Instance) error {
 
 	if _, err = os.Stat(jarDir); err != nil {
 		if os.IsNotExist(err) {
-			err = instance.Version.DownloadTo(ctx, r.c, jarDir)
+			err = r.dl.DownloadTo(ctx, &instance.Version, jarDir)
 			if err != nil {
 				return errors.Join(ErrInstanceCreate, err)
 			}
@@ -154,6 +168,10 @@ func (r *dockerRuntime) Create(ctx context.Context, instance *Instance) error {
 		return errors.Join(ErrFileSystem, err)
 	}
 
+	if err = sanitizeProxyProtocol(dataDir, instance); err != nil {
+		return errors.Join(ErrFileSystem, err)
+	}
+
 	if err = sanitizeEula(dataDir); err != nil {
 		return errors.Join(ErrFileSystem, err)
 	}
@@ -215,6 +233,12 @@ func (r *dockerRuntime) Launch(ctx context.Context, instance *Instance) error {
 		)
 	}
 
+	if r.router != nil {
+		if err := r.router.Check(instance.ID, instance.Config.Domains); err != nil {
+			return errors.Join(ErrDomainConflict, err)
+		}
+	}
+
 	err := r.docker.ContainerStart(ctx, instance.ContainerID, container.StartOptions{})
 	if err != nil {
 		return errors.Join(ErrInstanceLaunch, err)
@@ -233,19 +257,54 @@ func (r *dockerRuntime) Launch(ctx context.Context, instance *Instance) error {
 		)
 	}
 
-	proxy, err := proxy.New(
+	px, err := proxy.New(
 		instance.Limits.MaxPlayers,
 		instance.ID,
 		net.TCPAddr{
 			IP:   net.ParseIP(nw.IPAddress),
 			Port: int(instance.Config.Port),
 		},
+		r.inbound,
 	)
 	if err != nil {
 		return errors.Join(ErrInstanceLaunch, err)
 	}
 
-	instance.proxy = proxy
+	px.SetProxyProtocol(instance.Config.ProxyProtocol)
+	px.SetAcceptTransfers(instance.Config.AcceptTransfers)
+	px.SetLoginFilter(newPlayerAccess(
+		r.DataDir(instance.ID),
+		instance.Config.WhitelistMessage,
+	).Filter)
+	px.SetFavIcon(readServerIcon(r.DataDir(instance.ID)))
+	if instance.Config.OfflineMOTD != "" {
+		px.SetOfflineMOTD(proxy.ParseText(instance.Config.OfflineMOTD))
+	}
+	instance.proxy = px
+
+	// The listeners are closed if the launch fails, since the instance
+	// is removed and its ports are considered free
+	defer func() {
+		if err == nil {
+			return
+		}
+		for _, f := range instance.forwards {
+			f.Close()
+		}
+		px.Close()
+	}()
+
+	instance.forwards, err = r.forwardPorts(instance, net.ParseIP(nw.IPAddress))
+	if err != nil {
+		return errors.Join(ErrInstanceLaunch, err)
+	}
+
+	// Another instance may have taken the domains since checked
+	if r.router != nil && len(instance.Config.Domains) > 0 {
+		if err = r.router.Add(px, instance.Config.Domains); err != nil {
+			return errors.Join(ErrDomainConflict, err)
+		}
+	}
 
 	res, err := r.docker.ContainerAttach(ctx, instance.ContainerID, container.AttachOptions{
 		Stream: true,
@@ -303,6 +362,52 @@ func (r *dockerRuntime) Stop(ctx context.Context, instance *Instance) error {
 	return nil
 }
 
+// forwardPorts listens on the extra ports of the instance, closing
+// the ones already opened if any fails.
+func (r *dockerRuntime) forwardPorts(instance *Instance, ip net.IP) ([]proxy.Forwarder, error) {
+	forwards := make([]proxy.Forwarder, 0, len(instance.Config.Ports))
+
+	for _, p := range instance.Config.Ports {
+		var (
+			f   proxy.Forwarder
+			err error
+		)
+		switch p.Protocol {
+		case pb.PortProtocol_PORT_PROTOCOL_UDP:
+			f, err = proxy.NewUDPForwarder(
+				instance.ID,
+				int(p.PublicPort),
+				net.UDPAddr{IP: ip, Port: int(p.ContainerPort)},
+				r.inbound.Guard,
+			)
+		default:
+			f, err = proxy.NewTCPForwarder(
+				instance.ID,
+				int(p.PublicPort),
+				net.TCPAddr{IP: ip, Port: int(p.ContainerPort)},
+				r.inbound.Guard,
+			)
+		}
+		if err != nil {
+			for _, f := range forwards {
+				f.Close()
+			}
+			return nil, err
+		}
+		forwards = append(forwards, f)
+	}
+
+	return forwards, nil
+}
+
+func (r *dockerRuntime) DataDir(id dto.Snowflake) string {
+	return path.Join(r.dir, id.String())
+}
+
+func (r *dockerRuntime) BackupDir(id dto.Snowflake) string {
+	return path.Join(r.dir, "backups", id.String())
+}
+
 func (r *dockerRuntime) pullImage(v pb.JavaVersion) (string, error) {
 	ref, err := r.java.GetImage(v)
 	if err != nil {
@@ -1,14 +1,19 @@
 package runner
 
 import (
+	"bufio"
+	"cmp"
 	"context"
+	"errors"
 	"log/slog"
+	"slices"
 	"strconv"
 	"time"
 
 	"github.com/zanz1n/mc-manager/internal/distribution"
 	"github.com/zanz1n/mc-manager/internal/dto"
 	"github.com/zanz1n/mc-manager/internal/pb"
+	"github.com/zanz1n/mc-manager/internal/proxy"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/protobuf/types/known/emptypb"
@@ -17,13 +22,20 @@ import (
 var _ pb.RunnerServiceServer = (*Server)(nil)
 
 type Server struct {
-	m        *Manager
-	versions *distribution.Repository
+	m         *Manager
+	versions  *distribution.Repository
+	guard     *proxy.Guard
+	blocklist *Blocklist
 	pb.UnimplementedRunnerServiceServer
 }
 
-func NewServer(m *Manager, v *distribution.Repository) *Server {
-	return &Server{m: m, versions: v}
+func NewServer(
+	m *Manager,
+	v *distribution.Repository,
+	guard *proxy.Guard,
+	blocklist *Blocklist,
+) *Server {
+	return &Server{m: m, versions: v, guard: guard, blocklist: blocklist}
 }
 
 // GetById implements pb.RunnerServiceServer.
@@ -69,10 +81,23 @@ func (s *Server) Launch(
 		version distribution.Version
 		err     error
 	)
-	if req.Version == "" {
+	if req.VersionDistro == pb.Distribution_CUSTOM {
+		if req.CustomVersion == nil {
+			return nil, errors.Join(
+				distribution.ErrVersionNotFound,
+				errors.New("custom version not provided"),
+			)
+		}
+		version.FromPB(req.CustomVersion)
+	} else if req.Version == "" {
 		version, err = s.versions.GetLatest(ctx, req.VersionDistro)
 	} else {
-		version, err = s.versions.GetVersion(ctx, req.VersionDistro, req.Version)
+		version, err = s.versions.GetBuild(
+			ctx,
+			req.VersionDistro,
+			req.Version,
+			req.VersionBuild,
+		)
 	}
 
 	if err != nil {
@@ -82,16 +107,20 @@ func (s *Server) Launch(
 	var (
 		limits InstanceLimits
 		config InstanceConfig
+		world  WorldSettings
 	)
 	limits.FromPB(req.Limits)
 	config.FromPB(req.Config)
+	world.FromPB(req.WorldSettings)
 
 	i, err := s.m.Launch(ctx, InstanceCreateData{
-		ID:      dto.Snowflake(req.Id),
-		Name:    req.Name,
-		Version: version,
-		Limits:  limits,
-		Config:  config,
+		ID:            dto.Snowflake(req.Id),
+		Name:          req.Name,
+		Version:       version,
+		Limits:        limits,
+		Config:        config,
+		WorldSettings: world,
+		GameRules:     req.GameRules,
 	})
 	if err != nil {
 		return nil, err
@@ -232,3 +261,404 @@ func (s *Server) ListenMany(
 
 	return nil
 }
+
+// GetWorldVersion implements pb.RunnerServiceServer.
+func (s *Server) GetWorldVersion(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.RunnerWorldVersionResponse, error) {
+	v, err := s.m.WorldVersion(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return v.IntoPB(), nil
+}
+
+// Backup implements pb.RunnerServiceServer.
+func (s *Server) Backup(
+	ctx context.Context,
+	req *pb.RunnerBackupRequest,
+) (*pb.RunnerBackup, error) {
+	b, err := s.m.Backup(ctx, dto.Snowflake(req.InstanceId), req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.IntoPB(), nil
+}
+
+// GetProperties implements pb.RunnerServiceServer.
+func (s *Server) GetProperties(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.ServerProperties, error) {
+	props, err := s.m.GetProperties(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return PropertiesIntoPB(props), nil
+}
+
+// PatchProperties implements pb.RunnerServiceServer.
+func (s *Server) PatchProperties(
+	ctx context.Context,
+	req *pb.InstancePatchPropertiesRequest,
+) (*pb.ServerProperties, error) {
+	props, err := s.m.PatchProperties(
+		ctx,
+		dto.Snowflake(req.InstanceId),
+		req.Set,
+		req.Unset,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return PropertiesIntoPB(props), nil
+}
+
+// GetPlayerList implements pb.RunnerServiceServer.
+func (s *Server) GetPlayerList(
+	ctx context.Context,
+	req *pb.InstanceGetPlayerListRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	entries, err := s.m.GetPlayerList(ctx, dto.Snowflake(req.InstanceId), req.List)
+	if err != nil {
+		return nil, err
+	}
+
+	return playerListIntoPB(entries), nil
+}
+
+// AddToPlayerList implements pb.RunnerServiceServer.
+func (s *Server) AddToPlayerList(
+	ctx context.Context,
+	req *pb.InstancePlayerListAddRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	entries, err := s.m.AddToPlayerList(ctx, dto.Snowflake(req.InstanceId), PlayerListChange{
+		List:   req.List,
+		Name:   req.Name,
+		Level:  uint8(req.Level),
+		Reason: req.Reason,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playerListIntoPB(entries), nil
+}
+
+// RemoveFromPlayerList implements pb.RunnerServiceServer.
+func (s *Server) RemoveFromPlayerList(
+	ctx context.Context,
+	req *pb.InstancePlayerListRemoveRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	entries, err := s.m.RemoveFromPlayerList(ctx, dto.Snowflake(req.InstanceId), PlayerListChange{
+		List: req.List,
+		Name: req.Name,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return playerListIntoPB(entries), nil
+}
+
+func playerListIntoPB(entries []PlayerListEntry) *pb.InstancePlayerListResponse {
+	res := make([]*pb.PlayerListEntry, len(entries))
+	for i := range entries {
+		res[i] = entries[i].IntoPB()
+	}
+	return &pb.InstancePlayerListResponse{Entries: res}
+}
+
+// ResetWorld implements pb.RunnerServiceServer.
+func (s *Server) ResetWorld(
+	ctx context.Context,
+	req *pb.RunnerResetWorldRequest,
+) (*pb.RunnerBackup, error) {
+	b, err := s.m.ResetWorld(ctx, dto.Snowflake(req.InstanceId), req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return b.IntoPB(), nil
+}
+
+// GetWorlds implements pb.RunnerServiceServer.
+func (s *Server) GetWorlds(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceWorldsResponse, error) {
+	worlds, err := s.m.GetWorlds(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return worldsIntoPB(worlds), nil
+}
+
+// UploadWorld implements pb.RunnerServiceServer.
+func (s *Server) UploadWorld(
+	stream grpc.ClientStreamingServer[pb.InstanceWorldUploadRequest, pb.InstanceWorld],
+) error {
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	info := req.GetInfo()
+	if info == nil {
+		return errors.Join(
+			ErrInvalidWorld,
+			errors.New("the first message must contain the upload info"),
+		)
+	}
+
+	w, err := s.m.UploadWorld(
+		stream.Context(),
+		dto.Snowflake(info.InstanceId),
+		info.Name,
+		info.Activate,
+		&worldUploadReader{stream: stream},
+	)
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(w.IntoPB())
+}
+
+// DownloadWorld implements pb.RunnerServiceServer.
+func (s *Server) DownloadWorld(
+	req *pb.InstanceWorldRequest,
+	stream grpc.ServerStreamingServer[pb.InstanceWorldDownloadResponse],
+) error {
+	w := bufio.NewWriterSize(&worldDownloadWriter{stream: stream}, worldChunkSize)
+
+	err := s.m.DownloadWorld(stream.Context(), dto.Snowflake(req.InstanceId), req.Name, w)
+	if err != nil {
+		return err
+	}
+
+	return w.Flush()
+}
+
+// SwitchWorld implements pb.RunnerServiceServer.
+func (s *Server) SwitchWorld(
+	ctx context.Context,
+	req *pb.InstanceWorldRequest,
+) (*pb.InstanceWorldsResponse, error) {
+	worlds, err := s.m.SwitchWorld(ctx, dto.Snowflake(req.InstanceId), req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return worldsIntoPB(worlds), nil
+}
+
+// SetIcon implements pb.RunnerServiceServer.
+func (s *Server) SetIcon(
+	ctx context.Context,
+	req *pb.InstanceSetIconRequest,
+) (*emptypb.Empty, error) {
+	err := s.m.SetIcon(ctx, dto.Snowflake(req.InstanceId), req.Icon)
+	if err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// GetGameRules implements pb.RunnerServiceServer.
+func (s *Server) GetGameRules(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceGameRulesResponse, error) {
+	rules, err := s.m.GetGameRules(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.InstanceGameRulesResponse{Rules: rules}, nil
+}
+
+// SetGameRules implements pb.RunnerServiceServer.
+func (s *Server) SetGameRules(
+	ctx context.Context,
+	req *pb.InstanceSetGameRulesRequest,
+) (*pb.InstanceGameRulesResponse, error) {
+	rules, err := s.m.SetGameRules(ctx, dto.Snowflake(req.InstanceId), req.Rules)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.InstanceGameRulesResponse{Rules: rules}, nil
+}
+
+// GetWorldInfo implements pb.RunnerServiceServer.
+func (s *Server) GetWorldInfo(
+	ctx context.Context,
+	req *pb.InstanceWorldRequest,
+) (*pb.WorldInfo, error) {
+	info, err := s.m.GetWorldInfo(ctx, dto.Snowflake(req.InstanceId), req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return info.IntoPB(), nil
+}
+
+// GetPlayerData implements pb.RunnerServiceServer.
+func (s *Server) GetPlayerData(
+	ctx context.Context,
+	req *pb.InstancePlayerDataRequest,
+) (*pb.InstancePlayerDataResponse, error) {
+	players, err := s.m.GetPlayerData(
+		ctx,
+		dto.Snowflake(req.InstanceId),
+		req.World,
+		req.Uuid,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*pb.PlayerData, len(players))
+	for i := range players {
+		res[i] = players[i].IntoPB()
+	}
+	return &pb.InstancePlayerDataResponse{Players: res}, nil
+}
+
+// GetInstanceStats implements pb.RunnerServiceServer.
+func (s *Server) GetInstanceStats(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceStats, error) {
+	i, err := s.m.GetById(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return instanceStatsIntoPB(i), nil
+}
+
+// GetNodeStats implements pb.RunnerServiceServer.
+func (s *Server) GetNodeStats(
+	ctx context.Context,
+	req *emptypb.Empty,
+) (*pb.NodeStats, error) {
+	stats := s.guard.Stats()
+
+	instances := s.m.GetAll(ctx)
+	res := make([]*pb.InstanceStats, len(instances))
+	for j, i := range instances {
+		res[j] = instanceStatsIntoPB(i)
+	}
+
+	return &pb.NodeStats{
+		Connections:          stats.Conns,
+		BlockedConnections:   stats.Blocked,
+		ThrottledConnections: stats.ThrottledConns,
+		ThrottledHandshakes:  stats.ThrottledHandshakes,
+		RejectedConnections:  stats.Rejected,
+		Instances:            res,
+	}, nil
+}
+
+// GetBlocklist implements pb.RunnerServiceServer.
+func (s *Server) GetBlocklist(
+	ctx context.Context,
+	req *emptypb.Empty,
+) (*pb.Blocklist, error) {
+	return BlocklistIntoPB(s.blocklist.Get()), nil
+}
+
+// Block implements pb.RunnerServiceServer.
+func (s *Server) Block(
+	ctx context.Context,
+	req *pb.RunnerBlockRequest,
+) (*pb.Blocklist, error) {
+	list, err := s.blocklist.Block(req.Address, req.Reason)
+	if err != nil {
+		return nil, err
+	}
+
+	return BlocklistIntoPB(list), nil
+}
+
+// Unblock implements pb.RunnerServiceServer.
+func (s *Server) Unblock(
+	ctx context.Context,
+	req *pb.RunnerUnblockRequest,
+) (*pb.Blocklist, error) {
+	list, err := s.blocklist.Unblock(req.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	return BlocklistIntoPB(list), nil
+}
+
+// TransferPlayer implements pb.RunnerServiceServer.
+func (s *Server) TransferPlayer(
+	ctx context.Context,
+	req *pb.RunnerTransferPlayerRequest,
+) (*emptypb.Empty, error) {
+	err := s.m.TransferPlayer(
+		ctx,
+		dto.Snowflake(req.InstanceId),
+		req.Player,
+		req.Host,
+		uint16(req.Port),
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func instanceStatsIntoPB(i *Instance) *pb.InstanceStats {
+	res := &pb.InstanceStats{InstanceId: uint64(i.ID)}
+	if i.proxy == nil {
+		return res
+	}
+
+	stats := i.proxy.Stats()
+	res.BytesIn = stats.BytesIn
+	res.BytesOut = stats.BytesOut
+	res.Connections = stats.Conns
+	res.FailedDials = stats.FailedDials
+
+	if h := i.health.Load(); h != nil {
+		res.Health = h.IntoPB()
+	}
+
+	res.Handshakes = make([]*pb.HandshakeCount, 0, len(stats.Handshakes))
+	for key, count := range stats.Handshakes {
+		res.Handshakes = append(res.Handshakes, &pb.HandshakeCount{
+			Intent:          pb.HandshakeIntent(key.Intent),
+			ProtocolVersion: key.ProtocolVersion,
+			Count:           count,
+		})
+	}
+	slices.SortFunc(res.Handshakes, func(a, b *pb.HandshakeCount) int {
+		if a.Intent != b.Intent {
+			return cmp.Compare(a.Intent, b.Intent)
+		}
+		return cmp.Compare(a.ProtocolVersion, b.ProtocolVersion)
+	})
+
+	return res
+}
+
+func worldsIntoPB(worlds []World) *pb.InstanceWorldsResponse {
+	res := make([]*pb.InstanceWorld, len(worlds))
+	for i := range worlds {
+		res[i] = worlds[i].IntoPB()
+	}
+	return &pb.InstanceWorldsResponse{Worlds: res}
+}
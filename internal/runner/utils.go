@@ -1,5 +1,66 @@
 package runner
 
-import "github.com/go-playground/validator/v10"
+import (
+	"errors"
+	"io"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/grpc"
+)
 
 var validate = validator.New()
+
+const worldChunkSize = 64 << 10
+
+var _ io.Reader = (*worldUploadReader)(nil)
+
+type worldUploadReader struct {
+	stream grpc.ClientStreamingServer[pb.InstanceWorldUploadRequest, pb.InstanceWorld]
+	buf    []byte
+}
+
+// Read implements io.Reader.
+func (r *worldUploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		req, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+
+		if req.GetInfo() != nil {
+			return 0, errors.Join(
+				ErrInvalidWorld,
+				errors.New("upload info sent more than once"),
+			)
+		}
+		r.buf = req.GetChunk()
+	}
+
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+var _ io.Writer = (*worldDownloadWriter)(nil)
+
+type worldDownloadWriter struct {
+	stream grpc.ServerStreamingServer[pb.InstanceWorldDownloadResponse]
+}
+
+// Write implements io.Writer.
+func (w *worldDownloadWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		chunk := p[:min(len(p), worldChunkSize)]
+
+		err := w.stream.Send(&pb.InstanceWorldDownloadResponse{Chunk: chunk})
+		if err != nil {
+			return written, err
+		}
+
+		written += len(chunk)
+		p = p[len(chunk):]
+	}
+	return written, nil
+}
@@ -0,0 +1,403 @@
+package runner
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/zanz1n/mc-manager/internal/nbt"
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+const (
+	// Upper bound of the uploaded archive size
+	maxWorldUploadSize = 16 << 30
+	// Upper bound of the extracted world size
+	maxWorldSize = 32 << 30
+)
+
+var worldNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+type WorldVersion struct {
+	Exists bool
+	// zero for worlds created before 1.9
+	DataVersion int32
+	Name        string
+	Snapshot    bool
+}
+
+func (v *WorldVersion) IntoPB() *pb.RunnerWorldVersionResponse {
+	return &pb.RunnerWorldVersionResponse{
+		Exists:      v.Exists,
+		DataVersion: v.DataVersion,
+		VersionName: v.Name,
+		Snapshot:    v.Snapshot,
+	}
+}
+
+type World struct {
+	Name    string
+	Active  bool
+	Size    int64
+	Version WorldVersion
+}
+
+func (w *World) IntoPB() *pb.InstanceWorld {
+	return &pb.InstanceWorld{
+		Name:        w.Name,
+		Active:      w.Active,
+		Size:        uint64(w.Size),
+		DataVersion: w.Version.DataVersion,
+		VersionName: w.Version.Name,
+	}
+}
+
+func getLevelName(dataDir string) (string, error) {
+	config, err := readMcPropertiesFile(dataDir)
+	if err != nil {
+		return "", err
+	}
+
+	if name, _ := config.Get("level-name"); name != "" {
+		return name, nil
+	}
+	return "world", nil
+}
+
+// resolveWorldName validates the world name, returning the
+// active world if it is empty.
+func resolveWorldName(dataDir string, name string) (string, error) {
+	if name == "" {
+		return getLevelName(dataDir)
+	}
+
+	if !worldNameRegex.MatchString(name) {
+		return "", errors.Join(
+			ErrInvalidWorld,
+			fmt.Errorf("invalid world name %q", name),
+		)
+	}
+	return name, nil
+}
+
+func setLevelName(dataDir string, name string) error {
+	config, err := readMcPropertiesFile(dataDir)
+	if err != nil {
+		return err
+	}
+
+	config.Set("level-name", name)
+	return writeMcPropertiesFile(dataDir, config)
+}
+
+func readLevelDat(worldDir string) (nbt.Compound, error) {
+	file, err := os.Open(path.Join(worldDir, "level.dat"))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	_, root, err := nbt.Decode(file)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := root.Compound("Data")
+	if !ok {
+		return nil, errors.New("level.dat: missing Data compound")
+	}
+	return data, nil
+}
+
+func readWorldVersion(dataDir string) (WorldVersion, error) {
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return WorldVersion{}, err
+	}
+
+	return readWorldDirVersion(path.Join(dataDir, levelName))
+}
+
+func readWorldDirVersion(worldDir string) (WorldVersion, error) {
+	data, err := readLevelDat(worldDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return WorldVersion{Exists: false}, nil
+		}
+		return WorldVersion{}, err
+	}
+
+	v := WorldVersion{Exists: true}
+	v.DataVersion, _ = data.Int("DataVersion")
+
+	if version, ok := data.Compound("Version"); ok {
+		v.Name, _ = version.String("Name")
+		v.Snapshot, _ = version.Bool("Snapshot")
+	}
+
+	return v, nil
+}
+
+// worldDirs returns the directories of the world dimensions, bukkit
+// based servers store each dimension in a separate directory.
+func worldDirs(dataDir string, levelName string) []string {
+	return []string{
+		path.Join(dataDir, levelName),
+		path.Join(dataDir, levelName+"_nether"),
+		path.Join(dataDir, levelName+"_the_end"),
+	}
+}
+
+// listWorlds returns the directories of the data dir with a level.dat
+// file. The active world is always returned, even if not generated yet.
+func listWorlds(dataDir string) ([]World, error) {
+	levelName, err := getLevelName(dataDir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dataDir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	names := make(map[string]struct{}, len(entries))
+	for _, e := range entries {
+		if e.IsDir() {
+			names[e.Name()] = struct{}{}
+		}
+	}
+
+	worlds := []World{}
+	activeFound := false
+
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || strings.HasPrefix(name, ".") {
+			continue
+		}
+
+		// Bukkit dimension directories also have a level.dat
+		if isDimensionDir(name, names) {
+			continue
+		}
+
+		v, err := readWorldDirVersion(path.Join(dataDir, name))
+		if err != nil || !v.Exists {
+			continue
+		}
+
+		var size int64
+		for _, dir := range worldDirs(dataDir, name) {
+			size += dirSize(dir)
+		}
+
+		active := name == levelName
+		activeFound = activeFound || active
+
+		worlds = append(worlds, World{
+			Name:    name,
+			Active:  active,
+			Size:    size,
+			Version: v,
+		})
+	}
+
+	if !activeFound {
+		worlds = append(worlds, World{Name: levelName, Active: true})
+	}
+
+	return worlds, nil
+}
+
+func isDimensionDir(name string, dirs map[string]struct{}) bool {
+	for _, suffix := range []string{"_nether", "_the_end"} {
+		if base, ok := strings.CutSuffix(name, suffix); ok {
+			if _, ok = dirs[base]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.Type().IsRegular() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
+
+// zipWorld writes the world and its dimension directories into
+// the archive, skipping the session lock.
+func zipWorld(ctx context.Context, w io.Writer, dataDir string, levelName string) error {
+	zw := zip.NewWriter(w)
+
+	for _, dir := range worldDirs(dataDir, levelName) {
+		if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		err := zipDir(ctx, zw, dir, path.Base(dir)+"/", func(rel string) bool {
+			return rel == "session.lock"
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// extractWorld extracts the world from the archive into the
+// directories of the dimensions, as returned by worldDirs. The
+// directory containing the shallowest level.dat is used as the world
+// root, so both archives of the world directory and of its contents
+// are accepted. The sibling <root>_nether and <root>_the_end
+// directories of the bukkit based servers are extracted as well.
+func extractWorld(ctx context.Context, zipPath string, dests []string) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return errors.Join(ErrInvalidWorld, err)
+	}
+	defer zr.Close()
+
+	root, depth := "", -1
+	for _, f := range zr.File {
+		name := cleanZipName(f.Name)
+		if path.Base(name) != "level.dat" {
+			continue
+		}
+
+		dir, d := path.Dir(name), 0
+		if dir == "." {
+			dir = ""
+		} else {
+			d = strings.Count(dir, "/") + 1
+		}
+
+		if depth < 0 || d < depth || d == depth && preferWorldRoot(dir, root) {
+			root, depth = dir, d
+		}
+	}
+
+	if depth < 0 {
+		return errors.Join(
+			ErrInvalidWorld,
+			errors.New("the archive does not contain a level.dat file"),
+		)
+	}
+
+	// The prefixes of the archive extracted into each of the dests
+	prefixes := []string{""}
+	if root != "" {
+		prefixes = []string{root + "/", root + "_nether/", root + "_the_end/"}
+	}
+
+	var total uint64
+	for _, f := range zr.File {
+		if err = ctx.Err(); err != nil {
+			return err
+		}
+
+		name := cleanZipName(f.Name)
+		dest := ""
+		for i, prefix := range prefixes {
+			if rel, ok := strings.CutPrefix(name, prefix); ok && i < len(dests) {
+				name, dest = rel, dests[i]
+				break
+			}
+		}
+
+		if dest == "" || name == "" || name == "session.lock" || !f.Mode().IsRegular() {
+			continue
+		}
+
+		if total += f.UncompressedSize64; total > maxWorldSize {
+			return errors.Join(
+				ErrInvalidWorld,
+				fmt.Errorf("the world is bigger than %d bytes", maxWorldSize),
+			)
+		}
+
+		if err = extractZipFile(f, path.Join(dest, name)); err != nil {
+			return err
+		}
+	}
+
+	if _, err = readLevelDat(dests[0]); err != nil {
+		return errors.Join(ErrInvalidWorld, err)
+	}
+	return nil
+}
+
+// preferWorldRoot reports whether dir is a better world root than
+// current, both at the same depth. The dimension directories are only
+// used when no overworld is found, and the order of the entries does
+// not matter otherwise.
+func preferWorldRoot(dir string, current string) bool {
+	isDim := func(s string) bool {
+		return strings.HasSuffix(s, "_nether") || strings.HasSuffix(s, "_the_end")
+	}
+
+	if isDim(dir) != isDim(current) {
+		return !isDim(dir)
+	}
+	return dir < current
+}
+
+// cleanZipName returns the relative slash separated name of the entry.
+// Cleaning it as an absolute path removes any ".." element.
+func cleanZipName(name string) string {
+	name = strings.ReplaceAll(name, "\\", "/")
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+func extractZipFile(f *zip.File, target string) error {
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	r, err := f.Open()
+	if err != nil {
+		return errors.Join(ErrInvalidWorld, err)
+	}
+	defer r.Close()
+
+	file, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The declared size can not be trusted
+	n, err := io.Copy(file, io.LimitReader(r, int64(f.UncompressedSize64)+1))
+	if err != nil {
+		return errors.Join(ErrInvalidWorld, err)
+	}
+	if uint64(n) > f.UncompressedSize64 {
+		return errors.Join(
+			ErrInvalidWorld,
+			fmt.Errorf("%s: size mismatch", f.Name),
+		)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,42 @@
+package server
+
+import (
+	"github.com/zanz1n/mc-manager/internal/auth"
+	"github.com/zanz1n/mc-manager/internal/distribution"
+	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/grpc"
+)
+
+var _ pb.DistributionServiceServer = (*DistributionServer)(nil)
+
+type DistributionServer struct {
+	ar *auth.Respository
+
+	*distribution.Server
+}
+
+func NewDistributionServer(
+	ar *auth.Respository,
+	r *distribution.Repository,
+) *DistributionServer {
+	return &DistributionServer{
+		ar:     ar,
+		Server: distribution.NewServer(r),
+	}
+}
+
+// Upload implements pb.DistributionServiceServer.
+func (s *DistributionServer) Upload(
+	stream grpc.ClientStreamingServer[pb.DistributionUploadRequest, pb.Version],
+) error {
+	authed, err := s.ar.Authenticate(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	if !authed.IsAdmin() {
+		return ErrPermissionDenied
+	}
+
+	return s.Server.Upload(stream)
+}
@@ -11,6 +11,16 @@ var (
 		"instance not found",
 	)
 
+	ErrInstanceRunning = status.Error(
+		codes.FailedPrecondition,
+		"the instance must be stopped",
+	)
+
+	ErrInvalidUpload = status.Error(
+		codes.InvalidArgument,
+		"the first message must contain the upload info",
+	)
+
 	ErrNodeNotFound = status.Error(
 		codes.NotFound,
 		"node not found",
@@ -26,6 +36,31 @@ var (
 		"local node can not be deleted",
 	)
 
+	ErrInvalidPortRange = status.Error(
+		codes.InvalidArgument,
+		"invalid port range",
+	)
+
+	ErrPortInUse = status.Error(
+		codes.AlreadyExists,
+		"the port is used by another instance of the node",
+	)
+
+	ErrNoFreePort = status.Error(
+		codes.ResourceExhausted,
+		"no free port in the range of the node",
+	)
+
+	ErrTransfersDisabled = status.Error(
+		codes.FailedPrecondition,
+		"the target instance does not accept transfers",
+	)
+
+	ErrTransferHost = status.Error(
+		codes.InvalidArgument,
+		"the target instance has no domain or node endpoint, the host must be given",
+	)
+
 	ErrPermissionDenied = status.Error(
 		codes.PermissionDenied,
 		"permission denied",
@@ -40,4 +75,14 @@ var (
 		codes.PermissionDenied,
 		"user does not exist or password mismatches",
 	)
+
+	ErrVersionDowngrade = status.Error(
+		codes.FailedPrecondition,
+		"the world was saved by a newer version, use force to downgrade",
+	)
+
+	ErrVersionUnverifiable = status.Error(
+		codes.FailedPrecondition,
+		"could not verify the world version, use force to change it",
+	)
 )
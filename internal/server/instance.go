@@ -4,12 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"io"
 	"log/slog"
+	"maps"
+	"strings"
 	"time"
 
 	"github.com/zanz1n/mc-manager/internal/auth"
 	"github.com/zanz1n/mc-manager/internal/db"
+	"github.com/zanz1n/mc-manager/internal/distribution"
 	"github.com/zanz1n/mc-manager/internal/dto"
 	"github.com/zanz1n/mc-manager/internal/pb"
 	"google.golang.org/grpc"
@@ -22,15 +26,22 @@ type InstanceServer struct {
 	db db.Querier
 	ar *auth.Respository
 	r  *Runners
+	d  *distribution.Repository
 
 	pb.UnimplementedInstanceServiceServer
 }
 
-func NewInstanceServer(db db.Querier, ar *auth.Respository, r *Runners) *InstanceServer {
+func NewInstanceServer(
+	db db.Querier,
+	ar *auth.Respository,
+	r *Runners,
+	d *distribution.Repository,
+) *InstanceServer {
 	return &InstanceServer{
 		db: db,
 		ar: ar,
 		r:  r,
+		d:  d,
 	}
 }
 
@@ -115,18 +126,42 @@ func (s *InstanceServer) Launch(ctx context.Context, req *pb.Snowflake) (*emptyp
 		return nil, err
 	}
 
-	_, err = runner.Launch(ctx, &pb.RunnerLaunchRequest{
+	var customVersion *pb.Version
+	if i.VersionDistro == pb.Distribution_CUSTOM {
+		v, err := s.d.GetVersion(ctx, i.VersionDistro, i.Version)
+		if err != nil {
+			return nil, err
+		}
+		customVersion = v.IntoPB()
+	}
+
+	ri, err := runner.Launch(ctx, &pb.RunnerLaunchRequest{
 		Id:            uint64(i.ID),
 		Name:          i.Name,
 		Version:       i.Version,
 		VersionDistro: i.VersionDistro,
 		Limits:        i.Limits,
 		Config:        i.Config,
+		CustomVersion: customVersion,
+		VersionBuild:  i.VersionBuild,
+		WorldSettings: i.WorldSettings,
+		GameRules:     i.GameRules.GetRules(),
 	})
 	if err != nil {
 		return nil, err
 	}
 
+	if build := ri.GetVersion().GetBuild(); build != i.ResolvedBuild {
+		err = s.db.InstanceUpdateResolvedBuild(ctx, id, build)
+		if err != nil {
+			slog.Error(
+				"InstanceServer: Failed to update `resolved_build`",
+				"id", id,
+				"error", err,
+			)
+		}
+	}
+
 	if err = s.db.InstanceUpdateLastLaunched(ctx, id); err != nil {
 		slog.Error(
 			"InstanceServer: Failed to update `last_launched`",
@@ -185,19 +220,48 @@ func (s *InstanceServer) Create(
 	}
 	id := dto.NewSnowflake()
 
-	i, err := s.db.InstanceCreate(ctx, db.InstanceCreateParams{
-		ID:            id,
-		UserID:        dto.Snowflake(req.UserId),
-		NodeID:        dto.Snowflake(req.NodeId),
-		Name:          req.Name,
-		Description:   req.Description,
-		Version:       req.Version,
-		VersionDistro: req.VersionDistro,
-		Config:        req.Config,
-		Limits:        req.Limits,
-	})
-	if err != nil {
-		return nil, err
+	worldSettings := req.WorldSettings
+	if worldSettings == nil {
+		worldSettings = &pb.InstanceWorldSettings{}
+	}
+
+	nodeId := dto.Snowflake(req.NodeId)
+	config := req.Config
+	requestedPort := config.Port
+
+	// Retried when the allocated port is taken by a concurrent create
+	var i db.Instance
+	for attempt := 0; ; attempt++ {
+		config.Port, err = s.allocatePort(ctx, nodeId, requestedPort, config.Ports)
+		if err != nil {
+			return nil, err
+		}
+		port := int32(config.Port)
+
+		i, err = s.db.InstanceCreate(ctx, db.InstanceCreateParams{
+			ID:            id,
+			UserID:        dto.Snowflake(req.UserId),
+			NodeID:        nodeId,
+			Name:          req.Name,
+			Description:   req.Description,
+			Version:       req.Version,
+			VersionDistro: req.VersionDistro,
+			Config:        config,
+			Limits:        req.Limits,
+			VersionBuild:  req.VersionBuild,
+			WorldSettings: worldSettings,
+			Port:          &port,
+		})
+		if err == nil {
+			break
+		}
+
+		if !isUniqueViolation(err) {
+			return nil, err
+		}
+		if requestedPort != 0 || attempt >= 2 {
+			return nil, errors.Join(ErrPortInUse, fmt.Errorf("port %d", config.Port))
+		}
 	}
 
 	return i.IntoPB(pb.InstanceState_STATE_OFFLINE, 0), nil
@@ -330,6 +394,557 @@ func (s *InstanceServer) Delete(ctx context.Context, req *pb.Snowflake) (*pb.Ins
 	return i.IntoPB(pb.InstanceState_STATE_OFFLINE, 0), nil
 }
 
+// ChangeVersion implements pb.InstanceServiceServer.
+func (s *InstanceServer) ChangeVersion(
+	ctx context.Context,
+	req *pb.InstanceChangeVersionRequest,
+) (*pb.Instance, error) {
+	authed, err := s.ar.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	id := dto.Snowflake(req.InstanceId)
+
+	i, err := s.instanceGetById(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !authed.IsAdmin() {
+		if authed.GetId() != i.UserID {
+			return nil, ErrPermissionDenied
+		}
+	}
+
+	// Checks if the target version exists before touching anything
+	target, err := s.d.GetBuild(ctx, req.VersionDistro, req.Version, req.VersionBuild)
+	if err != nil {
+		return nil, err
+	}
+
+	runner, err := s.r.Get(ctx, i.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	wv, err := runner.GetWorldVersion(ctx, &pb.Snowflake{Id: req.InstanceId})
+	if err != nil {
+		return nil, err
+	}
+
+	if wv.Exists && !req.Force {
+		if err = s.checkDowngrade(ctx, wv, target); err != nil {
+			return nil, err
+		}
+	}
+
+	backup, err := runner.Backup(ctx, &pb.RunnerBackupRequest{
+		InstanceId: req.InstanceId,
+		Reason:     "pre-upgrade",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info(
+		"InstanceServer: Changing instance version",
+		"id", id,
+		"from", i.Version,
+		"to", target.ID,
+		"world_version", wv.VersionName,
+		"backup", backup.Name,
+	)
+
+	i, err = s.db.InstanceUpdate(ctx, db.InstanceUpdateParams{
+		ID:            id,
+		Name:          i.Name,
+		Description:   i.Description,
+		Version:       target.ID,
+		VersionDistro: req.VersionDistro,
+		VersionBuild:  req.VersionBuild,
+		Maintenance:   i.Maintenance,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	state, players := pb.InstanceState_STATE_OFFLINE, int32(0)
+	ri, err := runner.GetStateById(ctx, &pb.Snowflake{Id: req.InstanceId})
+	if err == nil {
+		state, players = ri.State, ri.Players
+	}
+
+	return i.IntoPB(state, players), nil
+}
+
+// RegenerateWorld implements pb.InstanceServiceServer.
+func (s *InstanceServer) RegenerateWorld(
+	ctx context.Context,
+	req *pb.InstanceRegenerateWorldRequest,
+) (*pb.Instance, error) {
+	id := dto.Snowflake(req.InstanceId)
+
+	i, runner, err := s.instanceRunner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = runner.GetStateById(ctx, &pb.Snowflake{Id: req.InstanceId}); err == nil {
+		return nil, ErrInstanceRunning
+	}
+
+	backup, err := runner.ResetWorld(ctx, &pb.RunnerResetWorldRequest{
+		InstanceId: req.InstanceId,
+		Reason:     "pre-regenerate",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	i, err = s.db.InstanceUpdateWorldSettings(ctx, id, req.WorldSettings)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info(
+		"InstanceServer: Regenerating instance world",
+		"id", id,
+		"backup", backup.Name,
+	)
+
+	return i.IntoPB(pb.InstanceState_STATE_OFFLINE, 0), nil
+}
+
+// GetWorlds implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetWorlds(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceWorldsResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetWorlds(ctx, req)
+}
+
+// UploadWorld implements pb.InstanceServiceServer.
+func (s *InstanceServer) UploadWorld(
+	stream grpc.ClientStreamingServer[pb.InstanceWorldUploadRequest, pb.InstanceWorld],
+) error {
+	ctx := stream.Context()
+
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	info := req.GetInfo()
+	if info == nil {
+		return ErrInvalidUpload
+	}
+
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(info.InstanceId))
+	if err != nil {
+		return err
+	}
+
+	upstream, err := runner.UploadWorld(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err = upstream.Send(req); err != nil {
+		return err
+	}
+
+	for {
+		req, err = stream.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+
+		if err = upstream.Send(req); err != nil {
+			// The actual error is returned by CloseAndRecv
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return err
+		}
+	}
+
+	w, err := upstream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+
+	return stream.SendAndClose(w)
+}
+
+// DownloadWorld implements pb.InstanceServiceServer.
+func (s *InstanceServer) DownloadWorld(
+	req *pb.InstanceWorldRequest,
+	stream grpc.ServerStreamingServer[pb.InstanceWorldDownloadResponse],
+) error {
+	ctx := stream.Context()
+
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return err
+	}
+
+	res, err := runner.DownloadWorld(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	for {
+		chunk, err := res.Recv()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		if err = stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+}
+
+// ResetWorld implements pb.InstanceServiceServer.
+func (s *InstanceServer) ResetWorld(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*emptypb.Empty, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = runner.ResetWorld(ctx, &pb.RunnerResetWorldRequest{
+		InstanceId: req.Id,
+		Reason:     "pre-reset",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+// SwitchWorld implements pb.InstanceServiceServer.
+func (s *InstanceServer) SwitchWorld(
+	ctx context.Context,
+	req *pb.InstanceWorldRequest,
+) (*pb.InstanceWorldsResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.SwitchWorld(ctx, req)
+}
+
+// SetIcon implements pb.InstanceServiceServer.
+func (s *InstanceServer) SetIcon(
+	ctx context.Context,
+	req *pb.InstanceSetIconRequest,
+) (*emptypb.Empty, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.SetIcon(ctx, req)
+}
+
+// GetGameRules implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetGameRules(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceGameRulesResponse, error) {
+	i, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := runner.GetGameRules(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	res.Desired = i.GameRules.GetRules()
+	return res, nil
+}
+
+// SetGameRules implements pb.InstanceServiceServer.
+func (s *InstanceServer) SetGameRules(
+	ctx context.Context,
+	req *pb.InstanceSetGameRulesRequest,
+) (*pb.InstanceGameRulesResponse, error) {
+	id := dto.Snowflake(req.InstanceId)
+
+	i, runner, err := s.instanceRunner(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &pb.InstanceGameRulesResponse{}
+	if len(req.Rules) > 0 {
+		if res, err = runner.SetGameRules(ctx, req); err != nil {
+			return nil, err
+		}
+	}
+
+	desired := maps.Clone(i.GameRules.GetRules())
+	if desired == nil {
+		desired = make(map[string]string, len(req.Rules))
+	}
+	maps.Copy(desired, req.Rules)
+	for _, name := range req.Unset {
+		delete(desired, name)
+	}
+
+	i, err = s.db.InstanceUpdateGameRules(ctx, id, &pb.GameRules{Rules: desired})
+	if err != nil {
+		return nil, err
+	}
+
+	res.Desired = i.GameRules.GetRules()
+	return res, nil
+}
+
+// GetWorldInfo implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetWorldInfo(
+	ctx context.Context,
+	req *pb.InstanceWorldRequest,
+) (*pb.WorldInfo, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetWorldInfo(ctx, req)
+}
+
+// GetPlayerData implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetPlayerData(
+	ctx context.Context,
+	req *pb.InstancePlayerDataRequest,
+) (*pb.InstancePlayerDataResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetPlayerData(ctx, req)
+}
+
+// GetProperties implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetProperties(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.ServerProperties, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetProperties(ctx, req)
+}
+
+// PatchProperties implements pb.InstanceServiceServer.
+func (s *InstanceServer) PatchProperties(
+	ctx context.Context,
+	req *pb.InstancePatchPropertiesRequest,
+) (*pb.ServerProperties, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.PatchProperties(ctx, req)
+}
+
+// GetPlayerList implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetPlayerList(
+	ctx context.Context,
+	req *pb.InstanceGetPlayerListRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetPlayerList(ctx, req)
+}
+
+// AddToPlayerList implements pb.InstanceServiceServer.
+func (s *InstanceServer) AddToPlayerList(
+	ctx context.Context,
+	req *pb.InstancePlayerListAddRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.AddToPlayerList(ctx, req)
+}
+
+// RemoveFromPlayerList implements pb.InstanceServiceServer.
+func (s *InstanceServer) RemoveFromPlayerList(
+	ctx context.Context,
+	req *pb.InstancePlayerListRemoveRequest,
+) (*pb.InstancePlayerListResponse, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.RemoveFromPlayerList(ctx, req)
+}
+
+// GetStats implements pb.InstanceServiceServer.
+func (s *InstanceServer) GetStats(
+	ctx context.Context,
+	req *pb.Snowflake,
+) (*pb.InstanceStats, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetInstanceStats(ctx, req)
+}
+
+// TransferPlayer implements pb.InstanceServiceServer.
+func (s *InstanceServer) TransferPlayer(
+	ctx context.Context,
+	req *pb.InstanceTransferPlayerRequest,
+) (*emptypb.Empty, error) {
+	_, runner, err := s.instanceRunner(ctx, dto.Snowflake(req.InstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	// The user must also own the target
+	target, _, err := s.instanceRunner(ctx, dto.Snowflake(req.TargetInstanceId))
+	if err != nil {
+		return nil, err
+	}
+
+	if !target.Config.GetAcceptTransfers() {
+		return nil, errors.Join(
+			ErrTransfersDisabled,
+			errors.New(target.ID.String()),
+		)
+	}
+
+	host, err := s.transferHost(ctx, target, req.Host)
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.TransferPlayer(ctx, &pb.RunnerTransferPlayerRequest{
+		InstanceId: req.InstanceId,
+		Player:     req.Player,
+		Host:       host,
+		Port:       target.Config.GetPort(),
+	})
+}
+
+// transferHost returns the address the transferred players connect to,
+// the first domain of the target that is not a wildcard, or the
+// endpoint of its node.
+func (s *InstanceServer) transferHost(
+	ctx context.Context,
+	target db.Instance,
+	host string,
+) (string, error) {
+	if host != "" {
+		return host, nil
+	}
+
+	for _, domain := range target.Config.GetDomains() {
+		if !strings.Contains(domain, "*") {
+			return domain, nil
+		}
+	}
+
+	node, err := s.db.NodeGetById(ctx, target.NodeID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errors.Join(ErrTransferHost, errors.New(target.ID.String()))
+		}
+		return "", err
+	}
+	return node.Endpoint, nil
+}
+
+// checkDowngrade compares the data version of the world with the one of
+// the target jar. When the data version of the jar is unknown, the
+// release dates of the versions are compared using the vanilla manifest,
+// since the other distributions share the version ids.
+func (s *InstanceServer) checkDowngrade(
+	ctx context.Context,
+	wv *pb.RunnerWorldVersionResponse,
+	target distribution.Version,
+) error {
+	if wv.DataVersion > 0 && target.DataVersion > 0 {
+		if target.DataVersion < wv.DataVersion {
+			return errors.Join(
+				ErrVersionDowngrade,
+				fmt.Errorf(
+					"world data version %d, target data version %d",
+					wv.DataVersion, target.DataVersion,
+				),
+			)
+		}
+		return nil
+	}
+
+	worldVersion := wv.VersionName
+	if worldVersion == target.ID {
+		return nil
+	}
+
+	versions, err := s.d.GetAll(ctx, pb.Distribution_VANILLA, distribution.GetAllOptions{})
+	if err != nil {
+		return errors.Join(ErrVersionUnverifiable, err)
+	}
+
+	var worldTime, targetTime time.Time
+	for _, v := range versions {
+		switch v.ID {
+		case worldVersion:
+			worldTime = v.ReleaseTime
+		case target.ID:
+			targetTime = v.ReleaseTime
+		}
+	}
+
+	if worldTime.IsZero() || targetTime.IsZero() {
+		return errors.Join(
+			ErrVersionUnverifiable,
+			fmt.Errorf("world version %q, target version %q", worldVersion, target.ID),
+		)
+	}
+
+	if targetTime.Before(worldTime) {
+		return errors.Join(
+			ErrVersionDowngrade,
+			fmt.Errorf("world version %q, target version %q", worldVersion, target.ID),
+		)
+	}
+	return nil
+}
+
 func (s *InstanceServer) instanceGetById(
 	ctx context.Context,
 	id dto.Snowflake,
@@ -343,3 +958,33 @@ func (s *InstanceServer) instanceGetById(
 
 	return i, err
 }
+
+// instanceRunner fetches the instance, checking if the user is its owner,
+// and returns the runner of the node the instance is in.
+func (s *InstanceServer) instanceRunner(
+	ctx context.Context,
+	id dto.Snowflake,
+) (db.Instance, pb.RunnerServiceClient, error) {
+	authed, err := s.ar.Authenticate(ctx)
+	if err != nil {
+		return db.Instance{}, nil, err
+	}
+
+	i, err := s.instanceGetById(ctx, id)
+	if err != nil {
+		return db.Instance{}, nil, err
+	}
+
+	if !authed.IsAdmin() {
+		if authed.GetId() != i.UserID {
+			return db.Instance{}, nil, ErrPermissionDenied
+		}
+	}
+
+	runner, err := s.r.Get(ctx, i.NodeID)
+	if err != nil {
+		return db.Instance{}, nil, err
+	}
+
+	return i, runner, nil
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/zanz1n/mc-manager/internal/db"
 	"github.com/zanz1n/mc-manager/internal/dto"
 	"github.com/zanz1n/mc-manager/internal/pb"
+	"google.golang.org/protobuf/types/known/emptypb"
 	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
@@ -18,15 +19,22 @@ var _ pb.NodeServiceServer = (*NodeServer)(nil)
 type NodeServer struct {
 	db          db.Querier
 	ar          *auth.Respository
+	r           *Runners
 	localNodeId dto.Snowflake
 
 	pb.UnimplementedNodeServiceServer
 }
 
-func NewNodeServer(db db.Querier, ar *auth.Respository, localNode dto.Snowflake) *NodeServer {
+func NewNodeServer(
+	db db.Querier,
+	ar *auth.Respository,
+	r *Runners,
+	localNode dto.Snowflake,
+) *NodeServer {
 	return &NodeServer{
 		db:          db,
 		ar:          ar,
+		r:           r,
 		localNodeId: localNode,
 	}
 }
@@ -43,7 +51,7 @@ func (s *NodeServer) GetById(ctx context.Context, req *pb.Snowflake) (*pb.Node,
 	}
 
 	if req.Id == uint64(s.localNodeId) {
-		return s.localNodeInformation(), nil
+		return s.localNodeInformation(ctx), nil
 	}
 
 	id := dto.Snowflake(req.Id)
@@ -99,15 +107,22 @@ func (s *NodeServer) Create(ctx context.Context, req *pb.NodeCreateRequest) (*pb
 	}
 	id := dto.NewSnowflake()
 
+	ports, err := NewPortRange(req.PortRangeStart, req.PortRangeEnd)
+	if err != nil {
+		return nil, err
+	}
+
 	node, err := s.db.NodeCreate(ctx, db.NodeCreateParams{
-		ID:          id,
-		Name:        req.Name,
-		Description: req.Description,
-		Token:       req.Token,
-		Endpoint:    req.Endpoint,
-		EndpointTls: req.EndpointTls,
-		FtpPort:     int32(req.FtpPort),
-		GrpcPort:    int32(req.GrpcPort),
+		ID:             id,
+		Name:           req.Name,
+		Description:    req.Description,
+		Token:          req.Token,
+		Endpoint:       req.Endpoint,
+		EndpointTls:    req.EndpointTls,
+		FtpPort:        int32(req.FtpPort),
+		GrpcPort:       int32(req.GrpcPort),
+		PortRangeStart: int32(ports.Start),
+		PortRangeEnd:   int32(ports.End),
 	})
 	if err != nil {
 		return nil, err
@@ -143,20 +158,84 @@ func (s *NodeServer) Delete(ctx context.Context, req *pb.Snowflake) (*pb.Node, e
 	return node.IntoPB(), nil
 }
 
-func (s *NodeServer) localNodeInformation() *pb.Node {
+// GetStats implements pb.NodeServiceServer.
+func (s *NodeServer) GetStats(ctx context.Context, req *pb.Snowflake) (*pb.NodeStats, error) {
+	runner, err := s.nodeRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetNodeStats(ctx, &emptypb.Empty{})
+}
+
+// GetBlocklist implements pb.NodeServiceServer.
+func (s *NodeServer) GetBlocklist(ctx context.Context, req *pb.Snowflake) (*pb.Blocklist, error) {
+	runner, err := s.nodeRunner(ctx, dto.Snowflake(req.Id))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.GetBlocklist(ctx, &emptypb.Empty{})
+}
+
+// Block implements pb.NodeServiceServer.
+func (s *NodeServer) Block(ctx context.Context, req *pb.NodeBlockRequest) (*pb.Blocklist, error) {
+	runner, err := s.nodeRunner(ctx, dto.Snowflake(req.NodeId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.Block(ctx, &pb.RunnerBlockRequest{
+		Address: req.Address,
+		Reason:  req.Reason,
+	})
+}
+
+// Unblock implements pb.NodeServiceServer.
+func (s *NodeServer) Unblock(ctx context.Context, req *pb.NodeUnblockRequest) (*pb.Blocklist, error) {
+	runner, err := s.nodeRunner(ctx, dto.Snowflake(req.NodeId))
+	if err != nil {
+		return nil, err
+	}
+
+	return runner.Unblock(ctx, &pb.RunnerUnblockRequest{Address: req.Address})
+}
+
+// nodeRunner checks if the user is an admin and returns the runner
+// of the node.
+func (s *NodeServer) nodeRunner(
+	ctx context.Context,
+	id dto.Snowflake,
+) (pb.RunnerServiceClient, error) {
+	authed, err := s.ar.Authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !authed.IsAdmin() {
+		return nil, ErrPermissionDenied
+	}
+
+	return s.r.Get(ctx, id)
+}
+
+func (s *NodeServer) localNodeInformation(ctx context.Context) *pb.Node {
 	now := time.Now()
+	ports, _ := s.r.PortRange(ctx, s.localNodeId)
 
 	return &pb.Node{
-		Id:          uint64(s.localNodeId),
-		CreatedAt:   timestamppb.New(now),
-		UpdatedAt:   timestamppb.New(now),
-		Name:        "Local Node",
-		Description: "",
-		Maintenance: false,
-		Token:       "",
-		Endpoint:    "localhost",
-		EndpointTls: false,
-		FtpPort:     0,
-		GrpcPort:    0,
+		Id:             uint64(s.localNodeId),
+		CreatedAt:      timestamppb.New(now),
+		UpdatedAt:      timestamppb.New(now),
+		Name:           "Local Node",
+		Description:    "",
+		Maintenance:    false,
+		Token:          "",
+		Endpoint:       "localhost",
+		EndpointTls:    false,
+		FtpPort:        0,
+		GrpcPort:       0,
+		PortRangeStart: int32(ports.Start),
+		PortRangeEnd:   int32(ports.End),
 	}
 }
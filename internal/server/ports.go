@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/zanz1n/mc-manager/internal/dto"
+	"github.com/zanz1n/mc-manager/internal/pb"
+)
+
+const (
+	// Starts after 25565, used by the shared listener of the nodes
+	DefaultPortRangeStart = 25566
+	DefaultPortRangeEnd   = 25665
+
+	// sqlstate of the unique constraint violations
+	pgUniqueViolation = "23505"
+)
+
+// PortRange is the ports allocated to the instances of a node,
+// inclusive.
+type PortRange struct {
+	Start uint16
+	End   uint16
+	// Never allocated when not zero. Only known for the local node,
+	// whose shared listener port is in the api config, the other nodes
+	// must keep it outside of their range
+	Reserved uint16
+}
+
+// NewPortRange returns the default range when start and end are zero.
+func NewPortRange(start, end uint32) (PortRange, error) {
+	if start == 0 && end == 0 {
+		return PortRange{Start: DefaultPortRangeStart, End: DefaultPortRangeEnd}, nil
+	}
+
+	if start == 0 || end > 65535 || start > end {
+		return PortRange{}, errors.Join(
+			ErrInvalidPortRange,
+			fmt.Errorf("%d-%d", start, end),
+		)
+	}
+	return PortRange{Start: uint16(start), End: uint16(end)}, nil
+}
+
+// SetPortRange sets the port range of a node that is not stored
+// in the database, like the local one.
+func (r *Runners) SetPortRange(id dto.Snowflake, pr PortRange) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ports[id] = pr
+}
+
+func (r *Runners) PortRange(ctx context.Context, id dto.Snowflake) (PortRange, error) {
+	r.mu.Lock()
+	pr, ok := r.ports[id]
+	r.mu.Unlock()
+	if ok {
+		return pr, nil
+	}
+
+	node, err := r.db.NodeGetById(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errors.Join(ErrNodeNotFound, errors.New(id.String()))
+		}
+		return PortRange{}, err
+	}
+
+	return PortRange{
+		Start: uint16(node.PortRangeStart),
+		End:   uint16(node.PortRangeEnd),
+	}, nil
+}
+
+// allocatePort returns the requested port if no other instance of the
+// node uses it, or the first free port of the range of the node when
+// zero. The ports outside of the range can be requested, except the
+// reserved one. The public ports of the mappings must not be used by
+// the other instances either, as the minecraft port or a mapping.
+func (s *InstanceServer) allocatePort(
+	ctx context.Context,
+	nodeId dto.Snowflake,
+	requested uint32,
+	mappings []*pb.PortMapping,
+) (uint32, error) {
+	rows, err := s.db.InstanceGetPortsByNode(ctx, nodeId)
+	if err != nil {
+		return 0, err
+	}
+
+	used := make(map[uint32]struct{}, len(rows))
+	for _, row := range rows {
+		if row.Port != nil {
+			used[uint32(*row.Port)] = struct{}{}
+		}
+		if row.Config != nil {
+			for _, m := range row.Config.Ports {
+				used[m.PublicPort] = struct{}{}
+			}
+		}
+	}
+
+	pr, err := s.r.PortRange(ctx, nodeId)
+	if err != nil {
+		return 0, err
+	}
+	if pr.Reserved != 0 {
+		used[uint32(pr.Reserved)] = struct{}{}
+	}
+
+	for _, m := range mappings {
+		if _, ok := used[m.PublicPort]; ok {
+			return 0, errors.Join(
+				ErrPortInUse,
+				fmt.Errorf("mapped port %d", m.PublicPort),
+			)
+		}
+	}
+
+	// The minecraft port is used for both tcp and the udp query, so it
+	// can't be mapped by the instance itself
+	for _, m := range mappings {
+		used[m.PublicPort] = struct{}{}
+	}
+
+	if requested != 0 {
+		if _, ok := used[requested]; ok {
+			return 0, errors.Join(ErrPortInUse, fmt.Errorf("port %d", requested))
+		}
+		return requested, nil
+	}
+
+	for port := uint32(pr.Start); port <= uint32(pr.End); port++ {
+		if _, ok := used[port]; !ok {
+			return port, nil
+		}
+	}
+	return 0, errors.Join(
+		ErrNoFreePort,
+		fmt.Errorf("range %d-%d", pr.Start, pr.End),
+	)
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgUniqueViolation
+}
@@ -20,14 +20,16 @@ import (
 type Runners struct {
 	db db.Querier
 
-	m  map[dto.Snowflake]pb.RunnerServiceClient
-	mu sync.Mutex
+	m     map[dto.Snowflake]pb.RunnerServiceClient
+	ports map[dto.Snowflake]PortRange
+	mu    sync.Mutex
 }
 
 func NewRunners(db db.Querier) *Runners {
 	return &Runners{
-		db: db,
-		m:  make(map[dto.Snowflake]pb.RunnerServiceClient),
+		db:    db,
+		m:     make(map[dto.Snowflake]pb.RunnerServiceClient),
+		ports: make(map[dto.Snowflake]PortRange),
 	}
 }
 
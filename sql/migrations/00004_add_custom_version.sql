@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+CREATE TABLE custom_versions (
+    version varchar(16) NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    name varchar(128) NOT NULL,
+    java_version integer NOT NULL,
+    hash bytea NOT NULL,
+    size bigint NOT NULL,
+
+    PRIMARY KEY (version)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+DROP TABLE IF EXISTS custom_versions;
+
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+ALTER TABLE instances
+    ADD COLUMN version_build integer NOT NULL DEFAULT 0,
+    ADD COLUMN resolved_build integer NOT NULL DEFAULT 0;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE instances
+    DROP COLUMN IF EXISTS version_build,
+    DROP COLUMN IF EXISTS resolved_build;
+
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+SELECT 'up SQL query';
+
+ALTER TABLE nodes
+    ADD COLUMN port_range_start integer NOT NULL DEFAULT 25566,
+    ADD COLUMN port_range_end integer NOT NULL DEFAULT 25665;
+
+ALTER TABLE instances
+    ADD COLUMN port integer;
+
+UPDATE instances SET port = NULLIF((config->>'port')::integer, 0);
+
+-- Only the oldest instance of the node keeps a duplicated port, the
+-- others are left without one and rejected by the node when launched
+-- at the same time
+UPDATE instances SET port = NULL
+FROM (
+    SELECT id, row_number() OVER (
+        PARTITION BY node_id, port ORDER BY created_at, id
+    ) AS n
+    FROM instances
+    WHERE port IS NOT NULL
+) AS duplicates
+WHERE instances.id = duplicates.id AND duplicates.n > 1;
+
+ALTER TABLE instances
+    ADD CONSTRAINT instances_node_id_port_key UNIQUE (node_id, port);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+SELECT 'down SQL query';
+
+ALTER TABLE instances
+    DROP CONSTRAINT IF EXISTS instances_node_id_port_key,
+    DROP COLUMN IF EXISTS port;
+
+ALTER TABLE nodes
+    DROP COLUMN IF EXISTS port_range_start,
+    DROP COLUMN IF EXISTS port_range_end;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- name: CustomVersionGetByVersion :one
+SELECT * FROM custom_versions WHERE version = $1;
+
+-- name: CustomVersionGetLatest :one
+SELECT * FROM custom_versions ORDER BY created_at DESC LIMIT 1;
+
+-- name: CustomVersionGetAll :many
+SELECT * FROM custom_versions ORDER BY created_at DESC;
+
+-- name: CustomVersionUpsert :one
+INSERT INTO custom_versions (
+    version,
+    name,
+    java_version,
+    hash,
+    size,
+    data_version
+) VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (version) DO UPDATE SET
+    updated_at = now(),
+    name = EXCLUDED.name,
+    java_version = EXCLUDED.java_version,
+    hash = EXCLUDED.hash,
+    size = EXCLUDED.size,
+    data_version = EXCLUDED.data_version
+RETURNING *;
+
+-- name: CustomVersionDelete :one
+DELETE FROM custom_versions WHERE version = $1 RETURNING *;
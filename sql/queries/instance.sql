@@ -1,6 +1,9 @@
 -- name: InstanceGetById :one
 SELECT * FROM instances WHERE id = $1;
 
+-- name: InstanceGetPortsByNode :many
+SELECT port, config FROM instances WHERE node_id = $1;
+
 -- name: InstanceCreate :one
 INSERT INTO instances (
     id,
@@ -11,8 +14,11 @@ INSERT INTO instances (
     version,
     version_distro,
     config,
-    limits
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *;
+    limits,
+    version_build,
+    world_settings,
+    port
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12) RETURNING *;
 
 -- name: InstanceUpdate :one
 UPDATE instances SET
@@ -21,6 +27,7 @@ UPDATE instances SET
     description = sqlc.arg(description),
     version = sqlc.arg(version),
     version_distro = sqlc.arg(version_distro),
+    version_build = sqlc.arg(version_build),
     maintenance = sqlc.arg(maintenance)
 WHERE id = $1
 RETURNING *;
@@ -28,7 +35,8 @@ RETURNING *;
 -- name: InstanceUpdateConfig :one
 UPDATE instances SET
     updated_at = now(),
-    config = sqlc.arg(config)
+    config = sqlc.arg(config),
+    port = sqlc.arg(port)
 WHERE id = $1
 RETURNING *;
 
@@ -39,8 +47,25 @@ UPDATE instances SET
 WHERE id = $1
 RETURNING *;
 
+-- name: InstanceUpdateWorldSettings :one
+UPDATE instances SET
+    updated_at = now(),
+    world_settings = sqlc.arg(world_settings)
+WHERE id = $1
+RETURNING *;
+
+-- name: InstanceUpdateGameRules :one
+UPDATE instances SET
+    updated_at = now(),
+    game_rules = sqlc.arg(game_rules)
+WHERE id = $1
+RETURNING *;
+
 -- name: InstanceUpdateLastLaunched :exec
 UPDATE instances SET last_launched = now() WHERE id = $1;
 
+-- name: InstanceUpdateResolvedBuild :exec
+UPDATE instances SET resolved_build = sqlc.arg(resolved_build) WHERE id = $1;
+
 -- name: InstanceDelete :one
 DELETE FROM instances WHERE id = $1 RETURNING *;
@@ -1,6 +1,9 @@
 -- name: NodeGetById :one
 SELECT * FROM nodes WHERE id = $1;
 
+-- name: NodeGetByToken :one
+SELECT * FROM nodes WHERE token = $1 LIMIT 1;
+
 -- name: NodeGetMany :many
 SELECT * FROM nodes
 WHERE id < sqlc.arg(last_seen)
@@ -16,8 +19,10 @@ INSERT INTO nodes (
     endpoint,
     endpoint_tls,
     ftp_port,
-    grpc_port
-) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING *;
+    grpc_port,
+    port_range_start,
+    port_range_end
+) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING *;
 
 -- name: NodeDelete :one
 DELETE FROM nodes WHERE id = $1 RETURNING *;